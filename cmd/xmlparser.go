@@ -13,13 +13,10 @@ func main() {
 		return
 	}
 	path := os.Args[1]
-	raw, err := os.ReadFile(path)
-	if err != nil {
-		fmt.Printf("error reading file at '%s'. %v\n", path, err)
-	}
-	root, err := xmlparser.Parse(string(raw))
+	root, err := xmlparser.ParseFile(path)
 	if err != nil {
 		fmt.Printf("error parsing xml. %v\n", err)
+		return
 	}
 	root.PrettyPrint(os.Stdout)
 }
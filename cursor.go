@@ -0,0 +1,124 @@
+package xmlparser
+
+// Cursor is a position in a tree that can move up and across it as well
+// as down. The children it moves over are those of the XPath data model,
+// so a run of text and CDATA is one child. Moving off the tree gives nil.
+type Cursor struct {
+	n *navNode
+}
+
+// NewCursor gives a cursor at root, over a tree of its own. Changes to
+// root made afterwards are not seen by the cursor.
+func NewCursor(root XmlNode) *Cursor {
+	doc := newNavTree(&root)
+	return &Cursor{doc.children[0]}
+}
+
+func newCursor(n *navNode) *Cursor {
+	if n.kind == rootNav {
+		n = n.children[0]
+	}
+	return &Cursor{n}
+}
+
+// Node gives the node at the cursor. An attribute comes back as an
+// AttributeNode.
+func (c *Cursor) Node() XmlNode {
+	return c.n.xmlNode(XmlNode{})
+}
+
+// Parent gives the element containing the node, or nil at the root. The
+// parent of an attribute is the element it is on.
+func (c *Cursor) Parent() *Cursor {
+	if c.n.parent.kind == rootNav {
+		return nil
+	}
+	return newCursor(c.n.parent)
+}
+
+// Children gives a cursor for each child of the node.
+func (c *Cursor) Children() []*Cursor {
+	out := make([]*Cursor, len(c.n.children))
+	for i, child := range c.n.children {
+		out[i] = newCursor(child)
+	}
+	return out
+}
+
+// Attributes gives a cursor for each attribute of the node, leaving out
+// namespace declarations.
+func (c *Cursor) Attributes() []*Cursor {
+	out := make([]*Cursor, len(c.n.attrs))
+	for i, a := range c.n.attrs {
+		out[i] = newCursor(a)
+	}
+	return out
+}
+
+// NextSibling gives the child after this one in its parent, or nil if it
+// is the last. Attributes and the root have no siblings.
+func (c *Cursor) NextSibling() *Cursor {
+	siblings := c.siblings()
+	if c.n.index+1 >= len(siblings) {
+		return nil
+	}
+	return newCursor(siblings[c.n.index+1])
+}
+
+// PrevSibling gives the child before this one in its parent, or nil if it
+// is the first.
+func (c *Cursor) PrevSibling() *Cursor {
+	siblings := c.siblings()
+	if c.n.index == 0 || len(siblings) == 0 {
+		return nil
+	}
+	return newCursor(siblings[c.n.index-1])
+}
+
+func (c *Cursor) siblings() []*navNode {
+	if c.n.kind == attributeNav || c.n.kind == namespaceNav || c.n.parent.kind == rootNav {
+		return nil
+	}
+	return c.n.parent.children
+}
+
+// Index gives the position of the node among its parent's children, or
+// of an attribute among its element's attributes, counting from 0.
+func (c *Cursor) Index() int {
+	return c.n.index
+}
+
+// Path locates the node from the root with a position at every step, such
+// as /rss[1]/channel[1]/item[2] or /rss[1]/@version. Positions count the
+// siblings with the same name, or of the same kind for text, comments and
+// processing instructions.
+func (c *Cursor) Path() string {
+	return c.n.path()
+}
+
+// Query evaluates the XPath 1.0 expression expr with the cursor as the
+// context node, giving a cursor for each node selected. Absolute paths
+// start from the root of the whole tree, and "/" gives the root element.
+func (c *Cursor) Query(expr string) ([]*Cursor, error) {
+	p, err := CompilePath(expr)
+	if err != nil {
+		return nil, err
+	}
+	doc := c.n
+	for doc.kind != rootNav {
+		doc = doc.parent
+	}
+	v, err := evalXPath(p.expr, p.source, doc, c.n, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.(nodeSet)
+	if !ok {
+		return nil, &PathError{expr, 0, "the result is not a node-set"}
+	}
+	out := make([]*Cursor, len(nodes))
+	for i, n := range nodes {
+		out[i] = newCursor(n)
+	}
+	return out, nil
+}
@@ -0,0 +1,139 @@
+package xmlparser
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// describeCursor prints where a cursor is, or nil.
+func describeCursor(c *Cursor) string {
+	if c == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("%s #%d", c.Path(), c.Index())
+}
+
+func TestCursor(t *testing.T) {
+	root, err := Parse(feedXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCursor(root)
+	channel := c.Children()[1]
+	children := channel.Children()
+	items := []*Cursor{children[3], children[5], children[7]}
+
+	table := []struct {
+		move func() *Cursor
+		want string
+	}{
+		{func() *Cursor { return c }, "/rss[1] #0"},
+		{func() *Cursor { return c.Parent() }, "nil"},
+		{func() *Cursor { return c.NextSibling() }, "nil"},
+		{func() *Cursor { return channel }, "/rss[1]/channel[1] #1"},
+		{func() *Cursor { return items[1] }, "/rss[1]/channel[1]/item[2] #5"},
+		{func() *Cursor { return items[1].Parent() }, "/rss[1]/channel[1] #1"},
+		{func() *Cursor { return items[1].NextSibling() }, "/rss[1]/channel[1]/text()[4] #6"},
+		{func() *Cursor { return items[1].NextSibling().NextSibling() }, "/rss[1]/channel[1]/item[3] #7"},
+		{func() *Cursor { return items[1].PrevSibling().PrevSibling() }, "/rss[1]/channel[1]/item[1] #3"},
+		{func() *Cursor { return items[0].PrevSibling().PrevSibling() }, "/rss[1]/channel[1]/title[1] #1"},
+		{func() *Cursor { return children[0].PrevSibling() }, "nil"},
+		{func() *Cursor { return items[2].NextSibling().NextSibling() }, "nil"},
+		{func() *Cursor { return items[1].Children()[1] }, "/rss[1]/channel[1]/item[2]/comment()[1] #1"},
+		{func() *Cursor { return items[1].Children()[1].NextSibling().Children()[0] }, "/rss[1]/channel[1]/item[2]/desc[1]/text()[1] #0"},
+		{func() *Cursor { return items[1].Children()[0].Children()[0] }, "/rss[1]/channel[1]/item[2]/title[1]/text()[1] #0"},
+		{func() *Cursor { return c.Attributes()[0] }, "/rss[1]/@version #0"},
+		{func() *Cursor { return c.Attributes()[0].Parent() }, "/rss[1] #0"},
+		{func() *Cursor { return c.Attributes()[0].NextSibling() }, "nil"},
+		{func() *Cursor { return c.Attributes()[0].PrevSibling() }, "nil"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			if diff := cmp.Diff(tst.want, describeCursor(tst.move())); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCursorNode(t *testing.T) {
+	root, err := Parse(feedXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCursor(root)
+	item := c.Children()[1].Children()[5]
+
+	got := printNodes([]XmlNode{
+		item.Node(),
+		item.Attributes()[0].Node(),
+		item.Children()[2].Children()[0].Node(),
+	})
+	want := []string{
+		`<item id="b"><title>Two</title><!--hidden--><desc>Hi <b>bold</b> there</desc></item>`,
+		`id="b"`,
+		"Hi ",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestCursorQuery(t *testing.T) {
+	root, err := Parse(feedXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCursor(root)
+
+	durations, err := c.Query("//itunes:duration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range durations {
+		item := d.Parent()
+		title := item.Children()[0]
+		got = append(got, fmt.Sprintf("%s %s", item.Path(), title.Node().Text()))
+	}
+	want := []string{"/rss[1]/channel[1]/item[1] One", "/rss[1]/channel[1]/item[3] Three"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+
+	table := []struct {
+		from *Cursor
+		expr string
+		want []string
+	}{
+		{durations[0], "../following-sibling::item/title", []string{"/rss[1]/channel[1]/item[2]/title[1] #0", "/rss[1]/channel[1]/item[3]/title[1] #0"}},
+		{durations[0], "ancestor::channel/@*", []string{"/rss[1]/channel[1]/@xml:lang #0"}},
+		{durations[1], "/", []string{"/rss[1] #0"}},
+		{durations[1], "preceding::title[1]/text()", []string{"/rss[1]/channel[1]/item[3]/title[1]/text()[1] #0"}},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			found, err := tst.from.Query(tst.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range found {
+				got = append(got, describeCursor(f))
+			}
+			if diff := cmp.Diff(tst.want, got); diff != "" {
+				t.Errorf("%s: %s", tst.expr, diff)
+			}
+		})
+	}
+
+	_, err = c.Query("count(//item)")
+	wantErr := "xpath 'count(//item)' at 1: the result is not a node-set"
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("wanted %s but got %v", wantErr, err)
+	}
+}
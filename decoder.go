@@ -0,0 +1,93 @@
+package xmlparser
+
+import (
+	"io"
+	"iter"
+
+	"github.com/danwhitford/xmlparser/tokeniser"
+)
+
+// Token is one of StartElement, EndElement, CharData, Comment, ProcInst
+// or Doctype.
+type Token any
+
+type StartElement struct {
+	Name       string
+	Namespace  string
+	Attributes []Attribute
+	Span       Span
+}
+
+// EndElement closes the most recent StartElement. A self closing tag
+// gives an EndElement with an empty Span straight after its StartElement.
+type EndElement struct {
+	Name      string
+	Namespace string
+	Span      Span
+}
+
+// CharData is a run of text, with references already decoded. CData is
+// set if any of it came from a CDATA section.
+type CharData struct {
+	Text  string
+	CData bool
+	Span  Span
+}
+
+type Comment struct {
+	Text string
+	Span Span
+}
+
+// ProcInst is a processing instruction. Data is everything after the
+// target, up to the closing "?>". Only the XML declaration has its
+// pseudo-attributes split out into Attributes.
+type ProcInst struct {
+	Target     string
+	Data       string
+	Attributes []Attribute
+	Span       Span
+}
+
+// Decoder reads a document one token at a time without building a tree.
+// Entity can be set before the first call to Token to expand named
+// entities beyond the predefined ones.
+type Decoder struct {
+	Entity map[string]string
+
+	t tokeniser.Tokeniser
+	p parser
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	d := &Decoder{t: tokeniser.NewReaderTokeniser(r)}
+	d.p = newStreamParser(&d.t)
+	return d
+}
+
+// Token returns the next token in the document, or io.EOF once it has
+// all been read.
+func (d *Decoder) Token() (Token, error) {
+	d.p.entities = d.Entity
+	tok, err := d.p.nextEvent()
+	if err == io.EOF && len(d.p.stack) > 0 {
+		return nil, d.p.unclosedError()
+	}
+	return tok, err
+}
+
+// Tokens ranges over the rest of the document. Iteration stops after the
+// first error, which is yielded with a nil Token.
+func (d *Decoder) Tokens() iter.Seq2[Token, error] {
+	return func(yield func(Token, error) bool) {
+		for {
+			tok, err := d.Token()
+			if err == io.EOF {
+				return
+			}
+			if !yield(tok, err) || err != nil {
+				return
+			}
+		}
+	}
+}
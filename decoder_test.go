@@ -0,0 +1,165 @@
+package xmlparser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/danwhitford/xmlparser/tokeniser"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestDecoderTokens(t *testing.T) {
+	table := []struct {
+		input string
+		want  []Token
+	}{
+		{
+			`<foo>bar</foo>`,
+			[]Token{
+				StartElement{Name: "foo"},
+				CharData{Text: "bar"},
+				EndElement{Name: "foo"},
+			},
+		},
+		{
+			`<?xml version="1.0"?><a x="1"><b/><!-- note --><![CDATA[<raw>]]></a>`,
+			[]Token{
+				ProcInst{Target: "xml", Data: `version="1.0"`, Attributes: []Attribute{{Key: "version", Value: "1.0"}}},
+				StartElement{Name: "a", Attributes: []Attribute{{Key: "x", Value: "1"}}},
+				StartElement{Name: "b"},
+				EndElement{Name: "b"},
+				Comment{Text: " note "},
+				CharData{Text: "<raw>", CData: true},
+				EndElement{Name: "a"},
+			},
+		},
+		{
+			"<a><?pi  if (x < 1) ?></a>",
+			[]Token{
+				StartElement{Name: "a"},
+				ProcInst{Target: "pi", Data: "if (x < 1) "},
+				EndElement{Name: "a"},
+			},
+		},
+		{
+			"<a>\n\t<b>Tom &amp; Jerry</b>\n</a>",
+			[]Token{
+				StartElement{Name: "a"},
+				CharData{Text: "\n\t"},
+				StartElement{Name: "b"},
+				CharData{Text: "Tom & Jerry"},
+				EndElement{Name: "b"},
+				CharData{Text: "\n"},
+				EndElement{Name: "a"},
+			},
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			d := NewDecoder(strings.NewReader(tst.input))
+			var got []Token
+			for tok, err := range d.Tokens() {
+				if err != nil {
+					t.Fatalf("failed on input '%v'. %v.", tst.input, err)
+				}
+				got = append(got, tok)
+			}
+			if diff := cmp.Diff(tst.want, got, cmpopts.EquateEmpty(), cmpopts.IgnoreTypes(Span{})); diff != "" {
+				t.Fatalf("failed on input '%v' with diff '%v'", tst.input, diff)
+			}
+		})
+	}
+}
+
+func TestDecoderSpans(t *testing.T) {
+	d := NewDecoder(strings.NewReader("<a>\n<b/></a>"))
+	var got []Token
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, tok)
+	}
+	want := []Token{
+		StartElement{Name: "a", Span: Span{tokeniser.Position{Offset: 0, Line: 1, Col: 1}, tokeniser.Position{Offset: 3, Line: 1, Col: 4}}},
+		CharData{Text: "\n", Span: Span{tokeniser.Position{Offset: 3, Line: 1, Col: 4}, tokeniser.Position{Offset: 4, Line: 2, Col: 1}}},
+		StartElement{Name: "b", Span: Span{tokeniser.Position{Offset: 4, Line: 2, Col: 1}, tokeniser.Position{Offset: 8, Line: 2, Col: 5}}},
+		EndElement{Name: "b", Span: Span{tokeniser.Position{Offset: 8, Line: 2, Col: 5}, tokeniser.Position{Offset: 8, Line: 2, Col: 5}}},
+		EndElement{Name: "a", Span: Span{tokeniser.Position{Offset: 8, Line: 2, Col: 5}, tokeniser.Position{Offset: 12, Line: 2, Col: 9}}},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Fatalf("wrong tokens with diff '%v'", diff)
+	}
+}
+
+func TestDecoderStopEarly(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`<list><item>1</item><item>2</item><broken</list>`))
+	var items int
+	for tok, err := range d.Tokens() {
+		if err != nil {
+			t.Fatalf("did not want an error. %v", err)
+		}
+		if start, ok := tok.(StartElement); ok && start.Name == "item" {
+			items++
+			if items == 2 {
+				break
+			}
+		}
+	}
+	if items != 2 {
+		t.Fatalf("wanted to see 2 items but saw %d", items)
+	}
+}
+
+func TestDecoderEntity(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`<a>&me;</a>`))
+	d.Entity = map[string]string{"me": "Dan"}
+	d.Token()
+	tok, err := d.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(CharData{Text: "Dan"}, tok, cmpopts.IgnoreTypes(Span{})); diff != "" {
+		t.Fatalf("wrong token with diff '%v'", diff)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	table := []struct {
+		input string
+		want  string
+	}{
+		{"<a><b></b>", "1:11: at end of input but 'a' is still open (in /a)"},
+		{"<a></b>", "1:4: closing tag 'b' does not match 'a' opened at 1:1"},
+		{"<a></a></a>", "1:8: closing tag with no element open"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			d := NewDecoder(strings.NewReader(tst.input))
+			var err error
+			for _, err = range d.Tokens() {
+			}
+			if err == nil {
+				t.Fatalf("wanted an error for input '%v'", tst.input)
+			}
+			var syntaxErr *SyntaxError
+			var mismatchErr *MismatchedTagError
+			if !errors.As(err, &syntaxErr) && !errors.As(err, &mismatchErr) {
+				t.Fatalf("wanted a structured error but got %#v", err)
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Fatalf("wrong error for input '%v' with diff '%v'", tst.input, diff)
+			}
+		})
+	}
+}
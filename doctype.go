@@ -0,0 +1,195 @@
+package xmlparser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/danwhitford/xmlparser/dtd"
+	"github.com/danwhitford/xmlparser/tokeniser"
+)
+
+// Doctype is a <!DOCTYPE> declaration. InternalSubset is the raw text
+// between the square brackets, if there were any, and DTD holds the
+// declarations read from it. Raw is the whole declaration as it was
+// written, which PrettyPrint gives back unchanged for as long as the
+// other fields still match it.
+type Doctype struct {
+	Name           string
+	PublicID       string
+	SystemID       string
+	InternalSubset string
+	DTD            *dtd.DTD
+	Raw            string
+	Span           Span
+
+	// parsed is what parts gave when the declaration was read.
+	parsed [4]string
+}
+
+func (doctype Doctype) parts() [4]string {
+	return [4]string{doctype.Name, doctype.PublicID, doctype.SystemID, doctype.InternalSubset}
+}
+
+const doctypeSpace = " \t\r\n"
+
+func (p *parser) readDoctype() (Doctype, error) {
+	t, err := p.readNext(tokeniser.Doctype)
+	if err != nil {
+		return Doctype{}, err
+	}
+	doctype := Doctype{Raw: "<!DOCTYPE" + t.Val + ">", Span: Span{t.Pos, t.End}}
+
+	rest := strings.TrimLeft(t.Val, doctypeSpace)
+	end := strings.IndexAny(rest, doctypeSpace+"[")
+	if end < 0 {
+		end = len(rest)
+	}
+	doctype.Name, rest = rest[:end], strings.TrimLeft(rest[end:], doctypeSpace)
+	if doctype.Name == "" {
+		return doctype, p.errorIn(doctype.Span, "DOCTYPE needs a root element name")
+	}
+
+	var ok bool
+	switch {
+	case strings.HasPrefix(rest, "PUBLIC"):
+		doctype.PublicID, rest, ok = readQuoted(rest[len("PUBLIC"):])
+		if !ok {
+			return doctype, p.errorIn(doctype.Span, "expected a quoted public ID after PUBLIC")
+		}
+		doctype.SystemID, rest, ok = readQuoted(rest)
+		if !ok {
+			return doctype, p.errorIn(doctype.Span, "expected a quoted system ID after the public ID")
+		}
+	case strings.HasPrefix(rest, "SYSTEM"):
+		doctype.SystemID, rest, ok = readQuoted(rest[len("SYSTEM"):])
+		if !ok {
+			return doctype, p.errorIn(doctype.Span, "expected a quoted system ID after SYSTEM")
+		}
+	}
+
+	rest = strings.TrimLeft(rest, doctypeSpace)
+	if strings.HasPrefix(rest, "[") {
+		end := strings.LastIndexByte(rest, ']')
+		if end < 0 {
+			return doctype, p.errorIn(doctype.Span, "internal subset is missing its closing ']'")
+		}
+		subsetStart := advancePosition(t.Pos, "<!DOCTYPE"+t.Val[:len(t.Val)-len(rest)+1])
+		doctype.InternalSubset, rest = rest[1:end], strings.TrimLeft(rest[end+1:], doctypeSpace)
+		doctype.DTD, err = dtd.ParseAt(doctype.InternalSubset, subsetStart)
+		if err != nil {
+			var dtdErr *dtd.Error
+			if errors.As(err, &dtdErr) {
+				return doctype, p.errorIn(Span{dtdErr.Pos, dtdErr.Pos}, "%s", dtdErr.Msg)
+			}
+			return doctype, err
+		}
+	} else {
+		doctype.DTD = dtd.New()
+	}
+	if rest != "" {
+		return doctype, p.errorIn(doctype.Span, "unexpected '%s' in DOCTYPE", rest)
+	}
+	doctype.parsed = doctype.parts()
+	return doctype, nil
+}
+
+// advancePosition moves pos over s, as the tokeniser would.
+func advancePosition(pos tokeniser.Position, s string) tokeniser.Position {
+	for _, r := range s {
+		pos.Offset += utf8.RuneLen(r)
+		if r == '\n' {
+			pos.Line++
+			pos.Col = 1
+		} else {
+			pos.Col++
+		}
+	}
+	return pos
+}
+
+// useDTD makes the parser expand the entities declared in d as they are
+// referenced. An entity holding markup is read in place of a reference to
+// it in content, but cannot be used in an attribute value.
+func (p *parser) useDTD(d *dtd.DTD) {
+	p.expander = newEntityExpander(d, p.entities)
+	p.dtd = d
+}
+
+// applyAttlist adds the default value of any attribute declared for node
+// that it leaves out, and normalises the whitespace in the value of
+// attributes declared with a type other than CDATA.
+func (p *parser) applyAttlist(node *XmlNode) error {
+	if p.dtd == nil {
+		return nil
+	}
+
+	for i := range node.Attributes {
+		attr := &node.Attributes[i]
+		decl, ok := p.dtd.Attribute(node.Name, attr.Key)
+		if ok && decl.Type != dtd.CDATA {
+			attr.Value = strings.Join(strings.Fields(attr.Value), " ")
+		}
+	}
+
+	for _, decl := range p.dtd.Attlists[node.Name] {
+		if decl.Default != dtd.Default && decl.Default != dtd.Fixed {
+			continue
+		}
+		if slices.ContainsFunc(node.Attributes, func(attr Attribute) bool { return attr.Key == decl.Name }) {
+			continue
+		}
+		val, err := p.decodeEntities(decl.Value)
+		if err != nil {
+			return p.errorIn(node.Span, "default value of '%s': %v", decl.Name, err)
+		}
+		if decl.Type != dtd.CDATA {
+			val = strings.Join(strings.Fields(val), " ")
+		}
+		node.Attributes = append(node.Attributes, Attribute{Key: decl.Name, Value: val})
+	}
+	return nil
+}
+
+// readQuoted reads a string in single or double quotes after any leading
+// whitespace, returning it and whatever follows.
+func readQuoted(s string) (string, string, bool) {
+	s = strings.TrimLeft(s, doctypeSpace)
+	if s == "" || (s[0] != '"' && s[0] != '\'') {
+		return "", s, false
+	}
+	end := strings.IndexByte(s[1:], s[0])
+	if end < 0 {
+		return "", s, false
+	}
+	return s[1 : end+1], s[end+2:], true
+}
+
+func quoteLiteral(s string) string {
+	if strings.Contains(s, `"`) {
+		return "'" + s + "'"
+	}
+	return `"` + s + `"`
+}
+
+// PrettyPrint writes Raw if the declaration has not been changed since it
+// was parsed, and otherwise builds it from its parts.
+func (doctype Doctype) PrettyPrint(sb io.Writer) {
+	if doctype.Raw != "" && doctype.parts() == doctype.parsed {
+		fmt.Fprintln(sb, doctype.Raw)
+		return
+	}
+	fmt.Fprintf(sb, "<!DOCTYPE %s", doctype.Name)
+	if doctype.PublicID != "" {
+		fmt.Fprintf(sb, " PUBLIC %s %s", quoteLiteral(doctype.PublicID), quoteLiteral(doctype.SystemID))
+	} else if doctype.SystemID != "" {
+		fmt.Fprintf(sb, " SYSTEM %s", quoteLiteral(doctype.SystemID))
+	}
+	if doctype.InternalSubset != "" {
+		fmt.Fprintf(sb, " [%s]", doctype.InternalSubset)
+	}
+	fmt.Fprintln(sb, ">")
+}
@@ -0,0 +1,345 @@
+package xmlparser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseDoctype(t *testing.T) {
+	table := []struct {
+		input string
+		want  Doctype
+	}{
+		{
+			"<!DOCTYPE html><html/>",
+			Doctype{Name: "html"},
+		},
+		{
+			"<!DOCTYPE note SYSTEM \"note.dtd\"><note/>",
+			Doctype{Name: "note", SystemID: "note.dtd"},
+		},
+		{
+			"<!DOCTYPE html PUBLIC \"-//W3C//DTD XHTML 1.0 Strict//EN\"\n\t'http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd'><html/>",
+			Doctype{
+				Name:     "html",
+				PublicID: "-//W3C//DTD XHTML 1.0 Strict//EN",
+				SystemID: "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd",
+			},
+		},
+		{
+			"<!DOCTYPE note [\n<!ELEMENT note (#PCDATA)>\n]>\n<note>hi</note>",
+			Doctype{Name: "note", InternalSubset: "\n<!ELEMENT note (#PCDATA)>\n"},
+		},
+		{
+			"<!DOCTYPE note SYSTEM \"note.dtd\" [<!ENTITY who \"me\">]><note/>",
+			Doctype{Name: "note", SystemID: "note.dtd", InternalSubset: "<!ENTITY who \"me\">"},
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			doc, err := ParseDocument(tst.input)
+			if err != nil {
+				t.Fatalf("failed on input '%v'. %v.", tst.input, err)
+			}
+			if doc.Doctype == nil {
+				t.Fatalf("wanted a DOCTYPE for input '%v'", tst.input)
+			}
+			if diff := cmp.Diff(tst.want, *doc.Doctype, cmpopts.IgnoreTypes(Span{}), cmpopts.IgnoreFields(Doctype{}, "DTD", "Raw"), cmpopts.IgnoreUnexported(Doctype{})); diff != "" {
+				t.Fatalf("failed on input '%v' with diff '%v'", tst.input, diff)
+			}
+
+			// Parse accepts the DOCTYPE even though it has nowhere to keep it
+			_, err = Parse(tst.input)
+			if err != nil {
+				t.Fatalf("failed on input '%v'. %v.", tst.input, err)
+			}
+		})
+	}
+}
+
+func TestParseDoctypeErrors(t *testing.T) {
+	table := []struct {
+		input string
+		want  string
+	}{
+		{"<!DOCTYPE><a/>", "1:1: DOCTYPE needs a root element name"},
+		{"<!DOCTYPE a SYSTEM><a/>", "1:1: expected a quoted system ID after SYSTEM"},
+		{"<!DOCTYPE a PUBLIC \"pub\"><a/>", "1:1: expected a quoted system ID after the public ID"},
+		{"<!DOCTYPE a junk><a/>", "1:1: unexpected 'junk' in DOCTYPE"},
+		{"<!DOCTYPE a><!DOCTYPE a><a/>", "1:13: a document can only have one DOCTYPE"},
+		{"<a/><!DOCTYPE a>", "1:5: DOCTYPE must come before the root element"},
+		{"<a><!DOCTYPE a></a>", "1:4: DOCTYPE is not allowed inside an element (in /a)"},
+		{"<!DOCTYPE a [<!ELEMENT a ANY>", "1:1: unterminated DOCTYPE declaration"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := ParseDocument(tst.input)
+			if err == nil {
+				t.Fatalf("wanted an error for input '%v'", tst.input)
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Fatalf("wrong error for input '%v' with diff '%v'", tst.input, diff)
+			}
+		})
+	}
+}
+
+func TestParseWithDTD(t *testing.T) {
+	table := []struct {
+		input string
+		want  XmlNode
+	}{
+		{
+			`<!DOCTYPE note [
+				<!ENTITY who "Dan">
+				<!ENTITY sig "&who; &amp; co&#x21;">
+			]>
+			<note from="&sig;">Hi &sig;</note>`,
+			XmlNode{
+				Name:       "note",
+				Contents:   "Hi Dan & co!",
+				Attributes: []Attribute{{Key: "from", Value: "Dan & co!"}},
+			},
+		},
+		{
+			`<!DOCTYPE img [
+				<!ENTITY base "http://example.com">
+				<!ATTLIST img
+					src CDATA "&base;/a.png"
+					align (left | right) "left"
+					version CDATA #FIXED "1.0"
+					alt CDATA #IMPLIED
+					ids IDREFS #IMPLIED>
+			]>
+			<img align="right" ids="  a
+				b  "/>`,
+			XmlNode{
+				Name: "img",
+				Attributes: []Attribute{
+					{Key: "align", Value: "right"},
+					{Key: "ids", Value: "a b"},
+					{Key: "src", Value: "http://example.com/a.png"},
+					{Key: "version", Value: "1.0"},
+				},
+			},
+		},
+		{
+			`<!DOCTYPE a [
+				<!ENTITY % decls "<!ATTLIST b xmlns CDATA #FIXED 'urn:b'>">
+				%decls;
+			]>
+			<a><b/></a>`,
+			XmlNode{
+				Name: "a",
+				Children: []XmlNode{
+					{
+						Name:       "b",
+						Namespace:  "urn:b",
+						Attributes: []Attribute{{Key: "xmlns", Value: "urn:b", Namespace: XMLNSNamespace}},
+					},
+				},
+			},
+		},
+		{
+			`<!DOCTYPE a [<!ENTITY sig "<b>Ann</b> &amp; &who;"><!ENTITY who "Bob">]><a>From &sig;, thanks</a>`,
+			XmlNode{
+				Name: "a",
+				Children: []XmlNode{
+					{Type: TextNode, Contents: "From "},
+					{Name: "b", Contents: "Ann"},
+					{Type: TextNode, Contents: " & Bob, thanks"},
+				},
+			},
+		},
+		{
+			`<!DOCTYPE tr [<!ENTITY row "<td>&cell;</td>"><!ENTITY cell "<i>x</i><!--c-->">]><tr>&row;&row;</tr>`,
+			XmlNode{
+				Name: "tr",
+				Children: []XmlNode{
+					{Name: "td", Children: []XmlNode{{Name: "i", Contents: "x"}, {Type: CommentNode, Contents: "c"}}},
+					{Name: "td", Children: []XmlNode{{Name: "i", Contents: "x"}, {Type: CommentNode, Contents: "c"}}},
+				},
+			},
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			got, err := Parse(tst.input)
+			if err != nil {
+				t.Fatalf("failed on input '%v'. %v.", tst.input, err)
+			}
+			if diff := cmp.Diff(tst.want, got, cmpopts.EquateEmpty(), cmpopts.IgnoreTypes(Span{})); diff != "" {
+				t.Fatalf("failed on input '%v' with diff '%v'", tst.input, diff)
+			}
+		})
+	}
+}
+
+func TestParseWithDTDErrors(t *testing.T) {
+	table := []struct {
+		input string
+		want  string
+	}{
+		{
+			"<!DOCTYPE a [\n\t<!ELEMENT a>\n]><a/>",
+			"2:13: expected whitespace after the element name",
+		},
+		{
+			"<!DOCTYPE a [<!ENTITY ext SYSTEM \"ext.xml\">]><a>&ext;</a>",
+			"1:49: entity '&ext;' is external and is not loaded (in /a)",
+		},
+		{
+			"<!DOCTYPE a [<!ENTITY pic SYSTEM \"a.png\" NDATA png>]><a>&pic;</a>",
+			"1:57: entity '&pic;' is unparsed and cannot be referenced (in /a)",
+		},
+		{
+			"<!DOCTYPE a [<!ENTITY b \"<b/>\">]><a c=\"&b;\"/>",
+			"1:39: entity '&b;' contains markup, which is only allowed in content",
+		},
+		{
+			"<!DOCTYPE a [<!ENTITY b \"<b>\">]><a>&b;</b></a>",
+			"1:36: entity '&b;' does not close every tag it opens (in /a)",
+		},
+		{
+			"<!DOCTYPE a [<!ENTITY b \"<b><!--\">]><a>&b;</a>",
+			"1:40: entity '&b;': 1:4: unterminated comment (in /a)",
+		},
+		{
+			"<!DOCTYPE a [<!ENTITY b \"<b>&b;</b>\">]><a>x&b;</a>",
+			"1:43: entity '&b;' refers to itself (in /a)",
+		},
+		{
+			"<!DOCTYPE a [<!ENTITY x \"&y;\"><!ENTITY y \"&x;\">]><a>&x;</a>",
+			"1:53: entity '&x;' refers to itself (in /a)",
+		},
+		{
+			"<!DOCTYPE a [<!ATTLIST a b CDATA \"&nope;\">]><a/>",
+			"1:45: default value of 'b': unknown entity '&nope;' (in /a)",
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := Parse(tst.input)
+			if err == nil {
+				t.Fatalf("wanted an error for input '%v'", tst.input)
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Fatalf("wrong error for input '%v' with diff '%v'", tst.input, diff)
+			}
+		})
+	}
+}
+
+func TestParseEntityExpansionLimit(t *testing.T) {
+	// Each entity refers to the one before it ten times over
+	var sb strings.Builder
+	sb.WriteString(`<!DOCTYPE a [<!ENTITY e0 "lol">`)
+	for i := 1; i <= 9; i++ {
+		fmt.Fprintf(&sb, `<!ENTITY e%d "%s">`, i, strings.Repeat(fmt.Sprintf("&e%d;", i-1), 10))
+	}
+	sb.WriteString(`]><a>&e9;</a>`)
+	input := sb.String()
+
+	_, err := Parse(input)
+	if err == nil {
+		t.Fatalf("wanted an error for input '%v'", input)
+	}
+	want := "1:532: expanding entity '&e6;' goes over the limit of 10485760 bytes (in /a)"
+	if diff := cmp.Diff(want, err.Error()); diff != "" {
+		t.Fatalf("wrong error for input '%v' with diff '%v'", input, diff)
+	}
+
+	// Markup in the entities counts the same as text
+	markup := strings.Replace(input, `"lol"`, `"<b/>"`, 1)
+	_, err = Parse(markup)
+	if err == nil {
+		t.Fatalf("wanted an error for input '%v'", markup)
+	}
+	want = "1:533: expanding entity '&e6;' goes over the limit of 10485760 bytes (in /a)"
+	if diff := cmp.Diff(want, err.Error()); diff != "" {
+		t.Fatalf("wrong error for input '%v' with diff '%v'", markup, diff)
+	}
+
+	// Entities that are declared but never referenced cost nothing
+	_, err = Parse(strings.Replace(input, "&e9;", "&e2;", 1))
+	if err != nil {
+		t.Fatalf("failed on input '%v'. %v.", input, err)
+	}
+}
+
+func TestParseWithEntitiesLoadsExternal(t *testing.T) {
+	input := `<!DOCTYPE a [<!ENTITY ext SYSTEM "ext.txt"><!ENTITY who "doc">]><a>&ext; &who;</a>`
+	got, err := ParseWithEntities(input, map[string]string{"ext": "loaded", "who": "caller"})
+	if err != nil {
+		t.Fatalf("failed on input '%v'. %v.", input, err)
+	}
+	if diff := cmp.Diff("loaded doc", got.Contents); diff != "" {
+		t.Fatalf("failed on input '%v' with diff '%v'", input, diff)
+	}
+}
+
+func TestPrintDoctypeRoundTrip(t *testing.T) {
+	table := []string{
+		"<!DOCTYPE html>\n<html/>\n",
+		"<?xml version=\"1.0\"?>\n" +
+			"<!DOCTYPE svg PUBLIC \"-//W3C//DTD SVG 1.1//EN\" \"http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd\">\n" +
+			"<svg/>\n",
+		"<!DOCTYPE note SYSTEM \"note.dtd\" [\n" +
+			"\t<!ENTITY who \"me\">\n" +
+			"\t<!-- a ]> comment -->\n" +
+			"]>\n" +
+			"<note>hi</note>\n",
+		"<!DOCTYPE  html PUBLIC '-//W3C//DTD XHTML 1.0 Strict//EN'\n" +
+			"\t\"http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd\" >\n" +
+			"<html/>\n",
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			doc, err := ParseDocument(tst)
+			if err != nil {
+				t.Fatalf("failed on input '%v'. %v.", tst, err)
+			}
+			var sb strings.Builder
+			doc.PrettyPrint(&sb)
+			if diff := cmp.Diff(tst, sb.String()); diff != "" {
+				t.Fatalf("failed to round trip '%v' with diff '%v'", tst, diff)
+			}
+		})
+	}
+}
+
+func TestPrintBuiltDoctype(t *testing.T) {
+	doctype := Doctype{Name: "html", PublicID: "-//W3C//DTD XHTML 1.0 Strict//EN", SystemID: "xhtml1-strict.dtd"}
+	var sb strings.Builder
+	doctype.PrettyPrint(&sb)
+	want := "<!DOCTYPE html PUBLIC \"-//W3C//DTD XHTML 1.0 Strict//EN\" \"xhtml1-strict.dtd\">\n"
+	if diff := cmp.Diff(want, sb.String()); diff != "" {
+		t.Fatalf("wrong DOCTYPE with diff '%v'", diff)
+	}
+}
+
+func TestPrintEditedDoctype(t *testing.T) {
+	input := "<!DOCTYPE  html PUBLIC '-//W3C//DTD XHTML 1.0 Strict//EN'\n\t\"xhtml1-strict.dtd\" >\n<html/>\n"
+	doc, err := ParseDocument(input)
+	if err != nil {
+		t.Fatalf("failed on input '%v'. %v.", input, err)
+	}
+	doc.Doctype.PublicID = ""
+	doc.Doctype.SystemID = "local.dtd"
+
+	var sb strings.Builder
+	doc.PrettyPrint(&sb)
+	want := "<!DOCTYPE html SYSTEM \"local.dtd\">\n<html/>\n"
+	if diff := cmp.Diff(want, sb.String()); diff != "" {
+		t.Fatalf("failed on input '%v' with diff '%v'", input, diff)
+	}
+}
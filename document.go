@@ -0,0 +1,214 @@
+package xmlparser
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/danwhitford/xmlparser/tokeniser"
+)
+
+// Document is a whole XML document. Prolog holds the comments and
+// processing instructions ahead of the root element and Epilog those
+// after it.
+type Document struct {
+	Declaration *Declaration
+	Doctype     *Doctype
+	Prolog      []XmlNode
+	Root        XmlNode
+	Epilog      []XmlNode
+}
+
+// Declaration is the <?xml ...?> declaration. Standalone is nil when the
+// declaration leaves it out.
+type Declaration struct {
+	Version    string
+	Encoding   string
+	Standalone *bool
+}
+
+func ParseDocument(input string) (Document, error) {
+	t := tokeniser.NewTokeniser(input)
+	return parseDocument(&t)
+}
+
+func ParseDocumentReader(r io.Reader) (Document, error) {
+	t := tokeniser.NewReaderTokeniser(r)
+	return parseDocument(&t)
+}
+
+func parseDocument(src tokenSource) (Document, error) {
+	p := newStreamParser(src)
+	doc, err := p.runDocument()
+	if p.err != nil {
+		return Document{}, p.err
+	}
+	return doc, err
+}
+
+func (p *parser) runDocument() (Document, error) {
+	doc := Document{}
+
+	first := true
+	for {
+		tok, err := p.nextEvent()
+		if err == io.EOF {
+			return doc, p.errorf("no root element")
+		}
+		if err != nil {
+			return doc, err
+		}
+
+		switch t := tok.(type) {
+		case ProcInst:
+			if strings.EqualFold(t.Target, "xml") {
+				if !first {
+					return doc, p.errorIn(t.Span, "the XML declaration must come first")
+				}
+				doc.Declaration, err = p.readDeclaration(t)
+				if err != nil {
+					return doc, err
+				}
+			} else {
+				doc.Prolog = append(doc.Prolog, instructionNode(t))
+			}
+		case Comment:
+			doc.Prolog = append(doc.Prolog, commentNode(t))
+		case Doctype:
+			if doc.Doctype != nil {
+				return doc, p.errorIn(t.Span, "a document can only have one DOCTYPE")
+			}
+			doc.Doctype = &t
+		case CharData:
+			if t.CData || strings.TrimSpace(t.Text) != "" {
+				return doc, p.errorIn(t.Span, "text is not allowed outside of the root element")
+			}
+		case StartElement:
+			err := p.buildElement(&doc.Root, t)
+			if err != nil {
+				return doc, err
+			}
+			return doc, p.readEpilog(&doc)
+		}
+		first = false
+	}
+}
+
+func (p *parser) readEpilog(doc *Document) error {
+	for {
+		tok, err := p.nextEvent()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case ProcInst:
+			if strings.EqualFold(t.Target, "xml") {
+				return p.errorIn(t.Span, "the XML declaration must come first")
+			}
+			doc.Epilog = append(doc.Epilog, instructionNode(t))
+		case Comment:
+			doc.Epilog = append(doc.Epilog, commentNode(t))
+		case CharData:
+			if t.CData || strings.TrimSpace(t.Text) != "" {
+				return p.errorIn(t.Span, "text is not allowed outside of the root element")
+			}
+		case StartElement:
+			return p.errorIn(t.Span, "a document can only have one root element")
+		case Doctype:
+			return p.errorIn(t.Span, "DOCTYPE must come before the root element")
+		}
+	}
+}
+
+var versionPattern = regexp.MustCompile(`^1\.[0-9]+$`)
+
+// declarationOrder is the only order the pseudo-attributes of the XML
+// declaration can be given in.
+var declarationOrder = []string{"version", "encoding", "standalone"}
+
+func (p *parser) readDeclaration(t ProcInst) (*Declaration, error) {
+	decl := &Declaration{}
+	next := 0
+	for _, attr := range t.Attributes {
+		i := slices.Index(declarationOrder[next:], attr.Key)
+		if i < 0 && slices.Contains(declarationOrder, attr.Key) {
+			return nil, p.errorIn(attr.Span, "'%s' is out of order in the XML declaration", attr.Key)
+		}
+		next += i + 1
+		switch attr.Key {
+		case "version":
+			if !versionPattern.MatchString(attr.Value) {
+				return nil, p.errorIn(attr.Span, "unsupported XML version '%s'", attr.Value)
+			}
+			decl.Version = attr.Value
+		case "encoding":
+			decl.Encoding = attr.Value
+		case "standalone":
+			if attr.Value != "yes" && attr.Value != "no" {
+				return nil, p.errorIn(attr.Span, "standalone must be 'yes' or 'no' but got '%s'", attr.Value)
+			}
+			standalone := attr.Value == "yes"
+			decl.Standalone = &standalone
+		default:
+			return nil, p.errorIn(attr.Span, "unexpected '%s' in the XML declaration", attr.Key)
+		}
+	}
+	if decl.Version == "" {
+		return nil, p.errorIn(t.Span, "the XML declaration needs a version")
+	}
+	return decl, nil
+}
+
+func instructionNode(t ProcInst) XmlNode {
+	return XmlNode{
+		Type:     ProcInstNode,
+		Name:     t.Target,
+		Contents: t.Data,
+		Span:     t.Span,
+	}
+}
+
+func commentNode(t Comment) XmlNode {
+	return XmlNode{
+		Type:     CommentNode,
+		Contents: t.Text,
+		Span:     t.Span,
+	}
+}
+
+func (decl Declaration) PrettyPrint(sb io.Writer) {
+	fmt.Fprintf(sb, `<?xml version="%s"`, escape(decl.Version))
+	if decl.Encoding != "" {
+		fmt.Fprintf(sb, ` encoding="%s"`, escape(decl.Encoding))
+	}
+	if decl.Standalone != nil {
+		standalone := "no"
+		if *decl.Standalone {
+			standalone = "yes"
+		}
+		fmt.Fprintf(sb, ` standalone="%s"`, standalone)
+	}
+	fmt.Fprintln(sb, "?>")
+}
+
+func (doc Document) PrettyPrint(sb io.Writer) {
+	if doc.Declaration != nil {
+		doc.Declaration.PrettyPrint(sb)
+	}
+	if doc.Doctype != nil {
+		doc.Doctype.PrettyPrint(sb)
+	}
+	for _, node := range doc.Prolog {
+		node.PrettyPrint(sb)
+	}
+	doc.Root.PrettyPrint(sb)
+	for _, node := range doc.Epilog {
+		node.PrettyPrint(sb)
+	}
+}
@@ -0,0 +1,120 @@
+package xmlparser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseDocument(t *testing.T) {
+	yes := true
+	table := []struct {
+		input string
+		want  Document
+	}{
+		{
+			"<a/>",
+			Document{Root: XmlNode{Name: "a"}},
+		},
+		{
+			"<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"yes\"?>\n<a/>",
+			Document{
+				Declaration: &Declaration{Version: "1.0", Encoding: "UTF-8", Standalone: &yes},
+				Root:        XmlNode{Name: "a"},
+			},
+		},
+		{
+			"<?xml version=\"1.0\"?>\n<!-- one -->\n<?style href=\"a.css\"?>\n<!-- two -->\n<a>b</a>\n<!-- three -->\n<?done?>\n",
+			Document{
+				Declaration: &Declaration{Version: "1.0"},
+				Prolog: []XmlNode{
+					{Type: CommentNode, Contents: " one "},
+					{Type: ProcInstNode, Name: "style", Contents: `href="a.css"`},
+					{Type: CommentNode, Contents: " two "},
+				},
+				Root: XmlNode{Name: "a", Contents: "b"},
+				Epilog: []XmlNode{
+					{Type: CommentNode, Contents: " three "},
+					{Type: ProcInstNode, Name: "done"},
+				},
+			},
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			got, err := ParseDocument(tst.input)
+			if err != nil {
+				t.Fatalf("failed on input '%v'. %v.", tst.input, err)
+			}
+			if diff := cmp.Diff(tst.want, got, cmpopts.EquateEmpty(), cmpopts.IgnoreTypes(Span{})); diff != "" {
+				t.Fatalf("failed on input '%v' with diff '%v'", tst.input, diff)
+			}
+		})
+	}
+}
+
+func TestParseDocumentErrors(t *testing.T) {
+	table := []struct {
+		input string
+		want  string
+	}{
+		{"", "1:1: no root element"},
+		{"<!-- only -->", "1:14: no root element"},
+		{"<a/><b/>", "1:5: a document can only have one root element (in /b)"},
+		{"<a/>text", "1:5: text is not allowed outside of the root element"},
+		{"<!-- c -->\n<?xml version=\"1.0\"?><a/>", "2:1: the XML declaration must come first"},
+		{"<?xml encoding=\"UTF-8\"?><a/>", "1:1: the XML declaration needs a version"},
+		{"<?xml version=\"2.0\"?><a/>", "1:7: unsupported XML version '2.0'"},
+		{"<?xml version=\"1.0\" standalone=\"maybe\"?><a/>", "1:21: standalone must be 'yes' or 'no' but got 'maybe'"},
+		{"<?xml version=\"1.0\" colour=\"red\"?><a/>", "1:21: unexpected 'colour' in the XML declaration"},
+		{"<?xml encoding=\"UTF-8\" version=\"1.0\"?><a/>", "1:24: 'version' is out of order in the XML declaration"},
+		{"<?xml version=\"1.0\" standalone=\"yes\" encoding=\"UTF-8\"?><a/>", "1:38: 'encoding' is out of order in the XML declaration"},
+		{"<?xml version=\"1.0\" version=\"1.0\"?><a/>", "1:21: 'version' is out of order in the XML declaration"},
+		{"<a><b></b>", "1:11: at end of input but 'a' is still open (in /a)"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := ParseDocument(tst.input)
+			var synErr *SyntaxError
+			if !errors.As(err, &synErr) {
+				t.Fatalf("wanted a *SyntaxError for input '%v' but got %v", tst.input, err)
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Fatalf("wrong error for input '%v' with diff '%v'", tst.input, diff)
+			}
+		})
+	}
+}
+
+func TestPrintDocumentRoundTrip(t *testing.T) {
+	table := []string{
+		"<a/>\n",
+		"<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"no\"?>\n" +
+			"<!-- prolog -->\n" +
+			"<?style href=\"a.css\"?>\n" +
+			"<a>\n" +
+			"\t<b>c</b>\n" +
+			"</a>\n" +
+			"<!-- epilog -->\n",
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			doc, err := ParseDocument(tst)
+			if err != nil {
+				t.Fatalf("failed on input '%v'. %v.", tst, err)
+			}
+			var sb strings.Builder
+			doc.PrettyPrint(&sb)
+			if diff := cmp.Diff(tst, sb.String()); diff != "" {
+				t.Fatalf("failed to round trip '%v' with diff '%v'", tst, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package dtd
+
+import (
+	"fmt"
+
+	"github.com/danwhitford/xmlparser/tokeniser"
+)
+
+// DTD holds the declarations from a document type definition. Where a
+// name is declared more than once the first declaration wins, as the XML
+// spec requires for entities and attributes.
+type DTD struct {
+	Entities          map[string]*Entity
+	ParameterEntities map[string]*Entity
+	Elements          map[string]*Element
+	Attlists          map[string][]*AttributeDecl
+	Notations         map[string]*Notation
+}
+
+func New() *DTD {
+	return &DTD{
+		Entities:          map[string]*Entity{},
+		ParameterEntities: map[string]*Entity{},
+		Elements:          map[string]*Element{},
+		Attlists:          map[string][]*AttributeDecl{},
+		Notations:         map[string]*Notation{},
+	}
+}
+
+// Entity is an <!ENTITY> declaration. An internal entity has its
+// replacement text in Value, with character references already expanded
+// but entity references left for when it is used. An external one has a
+// SystemID instead, and an unparsed external one also names its NData
+// notation.
+type Entity struct {
+	Name      string
+	Parameter bool
+	Value     string
+	PublicID  string
+	SystemID  string
+	NData     string
+	Pos       tokeniser.Position
+}
+
+func (e *Entity) External() bool {
+	return e.SystemID != ""
+}
+
+type ContentKind int
+
+const (
+	Empty ContentKind = iota
+	Any
+	Mixed
+	Children
+)
+
+// Element is an <!ELEMENT> declaration. A Mixed element lists the names
+// allowed alongside text in Names, and a Children element gives its
+// content model as a Particle.
+type Element struct {
+	Name     string
+	Kind     ContentKind
+	Names    []string
+	Particle *Particle
+	Pos      tokeniser.Position
+}
+
+type ParticleKind int
+
+const (
+	NameParticle ParticleKind = iota
+	Sequence
+	Choice
+)
+
+// Occurs is how many times a particle may repeat. It is one of 0 for
+// exactly once, '?', '*' or '+'.
+type Occurs byte
+
+// Particle is one part of a content model: either a single element name
+// or a sequence or choice of further particles.
+type Particle struct {
+	Kind     ParticleKind
+	Name     string
+	Children []*Particle
+	Occurs   Occurs
+}
+
+func (p *Particle) String() string {
+	s := p.Name
+	if p.Kind != NameParticle {
+		sep := ","
+		if p.Kind == Choice {
+			sep = "|"
+		}
+		s = "("
+		for i, child := range p.Children {
+			if i > 0 {
+				s += sep
+			}
+			s += child.String()
+		}
+		s += ")"
+	}
+	if p.Occurs != 0 {
+		s += string(p.Occurs)
+	}
+	return s
+}
+
+type AttributeType int
+
+const (
+	CDATA AttributeType = iota
+	ID
+	IDREF
+	IDREFS
+	ENTITY
+	ENTITIES
+	NMTOKEN
+	NMTOKENS
+	NOTATION
+	Enumeration
+)
+
+var attributeTypeNames = map[string]AttributeType{
+	"CDATA":    CDATA,
+	"ID":       ID,
+	"IDREF":    IDREF,
+	"IDREFS":   IDREFS,
+	"ENTITY":   ENTITY,
+	"ENTITIES": ENTITIES,
+	"NMTOKEN":  NMTOKEN,
+	"NMTOKENS": NMTOKENS,
+	"NOTATION": NOTATION,
+}
+
+type DefaultKind int
+
+const (
+	Implied DefaultKind = iota
+	Required
+	Fixed
+	Default
+)
+
+// AttributeDecl is one attribute from an <!ATTLIST> declaration. Values
+// lists the allowed names for NOTATION and Enumeration types, and Value
+// is the raw default for Fixed and Default attributes.
+type AttributeDecl struct {
+	Element string
+	Name    string
+	Type    AttributeType
+	Values  []string
+	Default DefaultKind
+	Value   string
+	Pos     tokeniser.Position
+}
+
+type Notation struct {
+	Name     string
+	PublicID string
+	SystemID string
+	Pos      tokeniser.Position
+}
+
+// Attribute finds the declaration of attribute name on element.
+func (d *DTD) Attribute(element, name string) (*AttributeDecl, bool) {
+	for _, decl := range d.Attlists[element] {
+		if decl.Name == name {
+			return decl, true
+		}
+	}
+	return nil, false
+}
+
+type Error struct {
+	Pos tokeniser.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %s", e.Pos, e.Msg)
+}
@@ -0,0 +1,85 @@
+package dtd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParticleString(t *testing.T) {
+	table := []string{
+		"a",
+		"(a,b?,c*)",
+		"(a|(b,c)+)*",
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			d, err := Parse(fmt.Sprintf("<!ELEMENT x (%s)>", tst))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "(" + tst + ")"
+			if got := d.Elements["x"].Particle.String(); got != want {
+				t.Errorf("wanted %s but got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestAttribute(t *testing.T) {
+	d, err := Parse(`<!ATTLIST a x CDATA #IMPLIED y ID #REQUIRED>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decl, ok := d.Attribute("a", "y")
+	if !ok || decl.Type != ID {
+		t.Errorf("wanted the ID attribute y but got %v", decl)
+	}
+	if _, ok := d.Attribute("a", "z"); ok {
+		t.Error("found an undeclared attribute")
+	}
+	if _, ok := d.Attribute("b", "x"); ok {
+		t.Error("found an attribute on an undeclared element")
+	}
+}
+
+func TestEntityExternal(t *testing.T) {
+	d, err := Parse(`<!ENTITY a "text"><!ENTITY b SYSTEM "b.xml">`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Entities["a"].External() {
+		t.Error("internal entity reported as external")
+	}
+	if !d.Entities["b"].External() {
+		t.Error("external entity reported as internal")
+	}
+}
+
+func TestIsName(t *testing.T) {
+	table := []struct {
+		input         string
+		name, nmtoken bool
+	}{
+		{"a", true, true},
+		{"x:y-z.1", true, true},
+		{"_a", true, true},
+		{"café", true, true},
+		{"1a", false, true},
+		{"-a", false, true},
+		{"", false, false},
+		{"a b", false, false},
+		{"a&b", false, false},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			if got := IsName(tst.input); got != tst.name {
+				t.Errorf("IsName(%q) gave %v", tst.input, got)
+			}
+			if got := IsNmtoken(tst.input); got != tst.nmtoken {
+				t.Errorf("IsNmtoken(%q) gave %v", tst.input, got)
+			}
+		})
+	}
+}
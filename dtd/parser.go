@@ -0,0 +1,708 @@
+package dtd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/danwhitford/xmlparser/tokeniser"
+)
+
+// Parse reads the declarations in an internal subset.
+func Parse(subset string) (*DTD, error) {
+	return ParseAt(subset, tokeniser.Position{Offset: 0, Line: 1, Col: 1})
+}
+
+// ParseAt is like Parse but reports positions as though the subset began
+// at start, so that errors point into the surrounding document.
+func ParseAt(subset string, start tokeniser.Position) (*DTD, error) {
+	d := New()
+	p := &parser{d: d, s: subset, p: start, expanding: map[string]bool{}}
+	err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+type parser struct {
+	d *DTD
+	s string
+	i int
+	p tokeniser.Position
+	// ref is set while reading the text of a parameter entity, as
+	// positions inside it are reported as the reference itself
+	ref       *tokeniser.Position
+	expanding map[string]bool
+}
+
+func (p *parser) pos() tokeniser.Position {
+	if p.ref != nil {
+		return *p.ref
+	}
+	return p.p
+}
+
+func (p *parser) errorf(format string, args ...any) *Error {
+	return &Error{p.pos(), fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) advance(n int) {
+	for i := 0; i < n && p.i < len(p.s); i++ {
+		b := p.s[p.i]
+		if b == '\n' {
+			p.p.Line++
+			p.p.Col = 1
+		} else if b&0xC0 != 0x80 {
+			p.p.Col++
+		}
+		p.p.Offset++
+		p.i++
+	}
+}
+
+func (p *parser) done() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *parser) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(p.s[p.i:], prefix)
+}
+
+func (p *parser) skipSpace() bool {
+	start := p.i
+	for !p.done() && strings.IndexByte(" \t\r\n", p.s[p.i]) >= 0 {
+		p.advance(1)
+	}
+	return p.i > start
+}
+
+func (p *parser) requireSpace(after string) error {
+	if !p.skipSpace() {
+		return p.errorf("expected whitespace after %s", after)
+	}
+	return nil
+}
+
+func (p *parser) expect(s string) error {
+	if !p.hasPrefix(s) {
+		return p.errorf("expected '%s' but got %s", s, p.describe())
+	}
+	p.advance(len(s))
+	return nil
+}
+
+// describe quotes what comes next for use in error messages.
+func (p *parser) describe() string {
+	if p.done() {
+		return "the end of the subset"
+	}
+	r, _ := utf8.DecodeRuneInString(p.s[p.i:])
+	return fmt.Sprintf("'%c'", r)
+}
+
+func isNameStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == ':' || r > 0x7F && !unicode.IsSpace(r)
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || unicode.IsDigit(r) || r == '-' || r == '.'
+}
+
+// IsName reports whether s is an XML name.
+func IsName(s string) bool {
+	for i, r := range s {
+		if !isNameChar(r) || i == 0 && !isNameStart(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// IsNmtoken reports whether s is a name token, which is like a name but
+// can start with any name character.
+func IsNmtoken(s string) bool {
+	for _, r := range s {
+		if !isNameChar(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func (p *parser) readName(what string) (string, error) {
+	start := p.i
+	for !p.done() {
+		r, size := utf8.DecodeRuneInString(p.s[p.i:])
+		if !isNameChar(r) || p.i == start && !isNameStart(r) {
+			break
+		}
+		p.advance(size)
+	}
+	if p.i == start {
+		return "", p.errorf("expected %s but got %s", what, p.describe())
+	}
+	return p.s[start:p.i], nil
+}
+
+// readNmtoken reads a name token, which unlike a name may start with any
+// name character.
+func (p *parser) readNmtoken() (string, error) {
+	start := p.i
+	for !p.done() {
+		r, size := utf8.DecodeRuneInString(p.s[p.i:])
+		if !isNameChar(r) {
+			break
+		}
+		p.advance(size)
+	}
+	if p.i == start {
+		return "", p.errorf("expected a name token but got %s", p.describe())
+	}
+	return p.s[start:p.i], nil
+}
+
+func (p *parser) readLiteral(what string) (string, error) {
+	if p.done() || (p.s[p.i] != '"' && p.s[p.i] != '\'') {
+		return "", p.errorf("expected a quoted %s but got %s", what, p.describe())
+	}
+	quote := p.s[p.i]
+	end := strings.IndexByte(p.s[p.i+1:], quote)
+	if end < 0 {
+		return "", p.errorf("unterminated %s", what)
+	}
+	val := p.s[p.i+1 : p.i+1+end]
+	p.advance(end + 2)
+	return val, nil
+}
+
+func (p *parser) parse() error {
+	for {
+		p.skipSpace()
+		if p.done() {
+			return nil
+		}
+
+		var err error
+		switch {
+		case p.hasPrefix("%"):
+			err = p.readParameterReference()
+		case p.hasPrefix("<!--"):
+			err = p.skipPast("<!--", "-->", "comment")
+		case p.hasPrefix("<?"):
+			err = p.skipPast("<?", "?>", "processing instruction")
+		case p.hasPrefix("<!ENTITY"):
+			err = p.readEntity()
+		case p.hasPrefix("<!ELEMENT"):
+			err = p.readElement()
+		case p.hasPrefix("<!ATTLIST"):
+			err = p.readAttlist()
+		case p.hasPrefix("<!NOTATION"):
+			err = p.readNotation()
+		case p.hasPrefix("<!["):
+			err = p.errorf("conditional sections are only allowed in an external subset")
+		default:
+			err = p.errorf("unexpected %s in DTD", p.describe())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *parser) skipPast(open, close, what string) error {
+	end := strings.Index(p.s[p.i+len(open):], close)
+	if end < 0 {
+		return p.errorf("unterminated %s", what)
+	}
+	p.advance(len(open) + end + len(close))
+	return nil
+}
+
+// readParameterReference reads the declarations inside an internal
+// parameter entity. External ones are not loaded, so are skipped.
+func (p *parser) readParameterReference() error {
+	pos := p.pos()
+	p.advance(1)
+	name, err := p.readName("a parameter entity name")
+	if err != nil {
+		return err
+	}
+	err = p.expect(";")
+	if err != nil {
+		return err
+	}
+
+	e, ok := p.d.ParameterEntities[name]
+	if !ok {
+		return &Error{pos, fmt.Sprintf("unknown parameter entity '%%%s;'", name)}
+	}
+	if e.External() {
+		return nil
+	}
+	if p.expanding[name] {
+		return &Error{pos, fmt.Sprintf("parameter entity '%%%s;' refers to itself", name)}
+	}
+
+	p.expanding[name] = true
+	defer delete(p.expanding, name)
+	inner := &parser{d: p.d, s: e.Value, p: pos, ref: &pos, expanding: p.expanding}
+	return inner.parse()
+}
+
+func (p *parser) readExternalID(allowPublicOnly bool) (publicID, systemID string, err error) {
+	switch {
+	case p.hasPrefix("SYSTEM"):
+		p.advance(len("SYSTEM"))
+		err = p.requireSpace("SYSTEM")
+		if err != nil {
+			return
+		}
+		systemID, err = p.readLiteral("system ID")
+	case p.hasPrefix("PUBLIC"):
+		p.advance(len("PUBLIC"))
+		err = p.requireSpace("PUBLIC")
+		if err != nil {
+			return
+		}
+		publicID, err = p.readLiteral("public ID")
+		if err != nil {
+			return
+		}
+		spaced := p.skipSpace()
+		if allowPublicOnly && (p.hasPrefix(">") || p.done()) {
+			return
+		}
+		if !spaced {
+			err = p.errorf("expected whitespace after the public ID")
+			return
+		}
+		systemID, err = p.readLiteral("system ID")
+	default:
+		err = p.errorf("expected SYSTEM or PUBLIC but got %s", p.describe())
+	}
+	return
+}
+
+func (p *parser) endDeclaration(what string) error {
+	p.skipSpace()
+	if !p.hasPrefix(">") {
+		return p.errorf("expected '>' to end the %s declaration but got %s", what, p.describe())
+	}
+	p.advance(1)
+	return nil
+}
+
+func (p *parser) readEntity() error {
+	e := &Entity{Pos: p.pos()}
+	p.advance(len("<!ENTITY"))
+	err := p.requireSpace("<!ENTITY")
+	if err != nil {
+		return err
+	}
+	if p.hasPrefix("%") {
+		e.Parameter = true
+		p.advance(1)
+		err = p.requireSpace("'%'")
+		if err != nil {
+			return err
+		}
+	}
+	e.Name, err = p.readName("an entity name")
+	if err != nil {
+		return err
+	}
+	err = p.requireSpace("the entity name")
+	if err != nil {
+		return err
+	}
+
+	if p.hasPrefix(`"`) || p.hasPrefix("'") {
+		pos := p.pos()
+		literal, err := p.readLiteral("entity value")
+		if err != nil {
+			return err
+		}
+		e.Value, err = replacementText(literal, pos)
+		if err != nil {
+			return err
+		}
+	} else {
+		e.PublicID, e.SystemID, err = p.readExternalID(false)
+		if err != nil {
+			return err
+		}
+		if p.skipSpace() && p.hasPrefix("NDATA") {
+			if e.Parameter {
+				return p.errorf("parameter entity '%s' cannot be unparsed", e.Name)
+			}
+			p.advance(len("NDATA"))
+			err = p.requireSpace("NDATA")
+			if err != nil {
+				return err
+			}
+			e.NData, err = p.readName("a notation name")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = p.endDeclaration("ENTITY")
+	if err != nil {
+		return err
+	}
+
+	entities := p.d.Entities
+	if e.Parameter {
+		entities = p.d.ParameterEntities
+	}
+	if _, ok := entities[e.Name]; !ok {
+		entities[e.Name] = e
+	}
+	return nil
+}
+
+// replacementText expands the character references in an entity value.
+// Entity references are left alone until the entity is used.
+func replacementText(literal string, pos tokeniser.Position) (string, error) {
+	if strings.Contains(literal, "%") {
+		return "", &Error{pos, "parameter entity references are not allowed inside declarations in an internal subset"}
+	}
+
+	var sb strings.Builder
+	for {
+		amp := strings.IndexByte(literal, '&')
+		if amp < 0 {
+			sb.WriteString(literal)
+			return sb.String(), nil
+		}
+		sb.WriteString(literal[:amp])
+		literal = literal[amp:]
+
+		semi := strings.IndexByte(literal, ';')
+		if semi < 0 {
+			return "", &Error{pos, "unterminated reference in entity value"}
+		}
+		ref := literal[:semi+1]
+		literal = literal[semi+1:]
+		if !strings.HasPrefix(ref, "&#") {
+			sb.WriteString(ref)
+			continue
+		}
+
+		var code uint64
+		var err error
+		if strings.HasPrefix(ref, "&#x") {
+			code, err = strconv.ParseUint(ref[3:len(ref)-1], 16, 32)
+		} else {
+			code, err = strconv.ParseUint(ref[2:len(ref)-1], 10, 32)
+		}
+		if err != nil || code == 0 || !utf8.ValidRune(rune(code)) {
+			return "", &Error{pos, fmt.Sprintf("malformed character reference '%s'", ref)}
+		}
+		sb.WriteRune(rune(code))
+	}
+}
+
+func (p *parser) readElement() error {
+	el := &Element{Pos: p.pos()}
+	p.advance(len("<!ELEMENT"))
+	err := p.requireSpace("<!ELEMENT")
+	if err != nil {
+		return err
+	}
+	el.Name, err = p.readName("an element name")
+	if err != nil {
+		return err
+	}
+	err = p.requireSpace("the element name")
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case p.hasPrefix("EMPTY"):
+		p.advance(len("EMPTY"))
+		el.Kind = Empty
+	case p.hasPrefix("ANY"):
+		p.advance(len("ANY"))
+		el.Kind = Any
+	case p.hasPrefix("("):
+		err = p.readContentSpec(el)
+		if err != nil {
+			return err
+		}
+	default:
+		return p.errorf("expected EMPTY, ANY or '(' but got %s", p.describe())
+	}
+	err = p.endDeclaration("ELEMENT")
+	if err != nil {
+		return err
+	}
+
+	if _, ok := p.d.Elements[el.Name]; ok {
+		return &Error{el.Pos, fmt.Sprintf("element '%s' is declared more than once", el.Name)}
+	}
+	p.d.Elements[el.Name] = el
+	return nil
+}
+
+func (p *parser) readContentSpec(el *Element) error {
+	if !strings.HasPrefix(strings.TrimLeft(p.s[p.i+1:], " \t\r\n"), "#PCDATA") {
+		el.Kind = Children
+		particle, err := p.readParticle()
+		if err != nil {
+			return err
+		}
+		el.Particle = particle
+		return nil
+	}
+
+	el.Kind = Mixed
+	p.advance(1)
+	p.skipSpace()
+	p.advance(len("#PCDATA"))
+	for {
+		p.skipSpace()
+		if p.hasPrefix(")") {
+			p.advance(1)
+			break
+		}
+		err := p.expect("|")
+		if err != nil {
+			return err
+		}
+		p.skipSpace()
+		name, err := p.readName("an element name")
+		if err != nil {
+			return err
+		}
+		el.Names = append(el.Names, name)
+	}
+	if p.hasPrefix("*") {
+		p.advance(1)
+	} else if len(el.Names) > 0 {
+		return p.errorf("mixed content with element names must end with ')*'")
+	}
+	return nil
+}
+
+func (p *parser) readParticle() (*Particle, error) {
+	particle := &Particle{}
+	if p.hasPrefix("(") {
+		p.advance(1)
+		p.skipSpace()
+		first, err := p.readParticle()
+		if err != nil {
+			return nil, err
+		}
+		particle.Kind = Sequence
+		particle.Children = []*Particle{first}
+
+		var sep byte
+		for {
+			p.skipSpace()
+			if p.hasPrefix(")") {
+				p.advance(1)
+				break
+			}
+			if p.done() || (p.s[p.i] != ',' && p.s[p.i] != '|') {
+				return nil, p.errorf("expected ',', '|' or ')' but got %s", p.describe())
+			}
+			if sep != 0 && p.s[p.i] != sep {
+				return nil, p.errorf("cannot mix ',' and '|' in one group")
+			}
+			sep = p.s[p.i]
+			if sep == '|' {
+				particle.Kind = Choice
+			}
+			p.advance(1)
+			p.skipSpace()
+			child, err := p.readParticle()
+			if err != nil {
+				return nil, err
+			}
+			particle.Children = append(particle.Children, child)
+		}
+	} else {
+		name, err := p.readName("an element name")
+		if err != nil {
+			return nil, err
+		}
+		particle.Name = name
+	}
+
+	if !p.done() && strings.IndexByte("?*+", p.s[p.i]) >= 0 {
+		particle.Occurs = Occurs(p.s[p.i])
+		p.advance(1)
+	}
+	return particle, nil
+}
+
+func (p *parser) readAttlist() error {
+	p.advance(len("<!ATTLIST"))
+	err := p.requireSpace("<!ATTLIST")
+	if err != nil {
+		return err
+	}
+	element, err := p.readName("an element name")
+	if err != nil {
+		return err
+	}
+
+	for {
+		spaced := p.skipSpace()
+		if p.hasPrefix(">") {
+			p.advance(1)
+			return nil
+		}
+		if !spaced {
+			return p.errorf("expected whitespace before the next attribute but got %s", p.describe())
+		}
+
+		decl := &AttributeDecl{Element: element, Pos: p.pos()}
+		decl.Name, err = p.readName("an attribute name")
+		if err != nil {
+			return err
+		}
+		err = p.requireSpace("the attribute name")
+		if err != nil {
+			return err
+		}
+		err = p.readAttributeType(decl)
+		if err != nil {
+			return err
+		}
+		err = p.requireSpace("the attribute type")
+		if err != nil {
+			return err
+		}
+		err = p.readDefault(decl)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := p.d.Attribute(element, decl.Name); !ok {
+			p.d.Attlists[element] = append(p.d.Attlists[element], decl)
+		}
+	}
+}
+
+func (p *parser) readAttributeType(decl *AttributeDecl) error {
+	if p.hasPrefix("(") {
+		decl.Type = Enumeration
+		values, err := p.readEnumeration(p.readNmtoken)
+		decl.Values = values
+		return err
+	}
+
+	name, err := p.readName("an attribute type")
+	if err != nil {
+		return err
+	}
+	t, ok := attributeTypeNames[name]
+	if !ok {
+		return p.errorf("unknown attribute type '%s'", name)
+	}
+	decl.Type = t
+	if t == NOTATION {
+		err = p.requireSpace("NOTATION")
+		if err != nil {
+			return err
+		}
+		decl.Values, err = p.readEnumeration(func() (string, error) {
+			return p.readName("a notation name")
+		})
+	}
+	return err
+}
+
+func (p *parser) readEnumeration(read func() (string, error)) ([]string, error) {
+	err := p.expect("(")
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	for {
+		p.skipSpace()
+		value, err := read()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		p.skipSpace()
+		if p.hasPrefix(")") {
+			p.advance(1)
+			return values, nil
+		}
+		err = p.expect("|")
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) readDefault(decl *AttributeDecl) error {
+	var err error
+	switch {
+	case p.hasPrefix("#REQUIRED"):
+		p.advance(len("#REQUIRED"))
+		decl.Default = Required
+		return nil
+	case p.hasPrefix("#IMPLIED"):
+		p.advance(len("#IMPLIED"))
+		decl.Default = Implied
+		return nil
+	case p.hasPrefix("#FIXED"):
+		p.advance(len("#FIXED"))
+		decl.Default = Fixed
+		err = p.requireSpace("#FIXED")
+		if err != nil {
+			return err
+		}
+	default:
+		decl.Default = Default
+	}
+
+	decl.Value, err = p.readLiteral("default value")
+	if err != nil {
+		return err
+	}
+	if strings.Contains(decl.Value, "<") {
+		return p.errorf("default value of '%s' cannot contain '<'", decl.Name)
+	}
+	return nil
+}
+
+func (p *parser) readNotation() error {
+	n := &Notation{Pos: p.pos()}
+	p.advance(len("<!NOTATION"))
+	err := p.requireSpace("<!NOTATION")
+	if err != nil {
+		return err
+	}
+	n.Name, err = p.readName("a notation name")
+	if err != nil {
+		return err
+	}
+	err = p.requireSpace("the notation name")
+	if err != nil {
+		return err
+	}
+	n.PublicID, n.SystemID, err = p.readExternalID(true)
+	if err != nil {
+		return err
+	}
+	err = p.endDeclaration("NOTATION")
+	if err != nil {
+		return err
+	}
+
+	if _, ok := p.d.Notations[n.Name]; ok {
+		return &Error{n.Pos, fmt.Sprintf("notation '%s' is declared more than once", n.Name)}
+	}
+	p.d.Notations[n.Name] = n
+	return nil
+}
@@ -0,0 +1,169 @@
+package dtd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/danwhitford/xmlparser/tokeniser"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParse(t *testing.T) {
+	table := []struct {
+		input string
+		want  *DTD
+	}{
+		{
+			"",
+			New(),
+		},
+		{
+			`<!ENTITY who "Dan &amp; co&#x21;">
+			 <!ENTITY who "ignored">
+			 <!ENTITY logo SYSTEM "logo.png" NDATA png>
+			 <!ENTITY chapter PUBLIC "-//Chapter//EN" 'chapter.xml'>
+			 <!ENTITY % common "<!ELEMENT br EMPTY>">`,
+			&DTD{
+				Entities: map[string]*Entity{
+					"who":     {Name: "who", Value: "Dan &amp; co!"},
+					"logo":    {Name: "logo", SystemID: "logo.png", NData: "png"},
+					"chapter": {Name: "chapter", PublicID: "-//Chapter//EN", SystemID: "chapter.xml"},
+				},
+				ParameterEntities: map[string]*Entity{
+					"common": {Name: "common", Parameter: true, Value: "<!ELEMENT br EMPTY>"},
+				},
+			},
+		},
+		{
+			`<!ELEMENT note (to+, from?, (body | empty)*)>
+			 <!ELEMENT p (#PCDATA | b | i)*>
+			 <!ELEMENT to (#PCDATA)>
+			 <!ELEMENT br EMPTY>
+			 <!ELEMENT any ANY>`,
+			&DTD{
+				Elements: map[string]*Element{
+					"note": {Name: "note", Kind: Children, Particle: &Particle{
+						Kind: Sequence,
+						Children: []*Particle{
+							{Name: "to", Occurs: '+'},
+							{Name: "from", Occurs: '?'},
+							{Kind: Choice, Occurs: '*', Children: []*Particle{
+								{Name: "body"},
+								{Name: "empty"},
+							}},
+						},
+					}},
+					"p":   {Name: "p", Kind: Mixed, Names: []string{"b", "i"}},
+					"to":  {Name: "to", Kind: Mixed},
+					"br":  {Name: "br", Kind: Empty},
+					"any": {Name: "any", Kind: Any},
+				},
+			},
+		},
+		{
+			`<!ATTLIST img
+				src CDATA #REQUIRED
+				alt CDATA #IMPLIED
+				id ID #IMPLIED
+				align (left | right) "left"
+				version CDATA #FIXED '1.0'
+				format NOTATION (png|gif) #IMPLIED>
+			 <!ATTLIST img src CDATA "ignored" refs IDREFS #IMPLIED>
+			 <!NOTATION png SYSTEM "image/png">
+			 <!NOTATION gif PUBLIC "-//GIF//EN">`,
+			&DTD{
+				Attlists: map[string][]*AttributeDecl{
+					"img": {
+						{Element: "img", Name: "src", Type: CDATA, Default: Required},
+						{Element: "img", Name: "alt", Type: CDATA, Default: Implied},
+						{Element: "img", Name: "id", Type: ID, Default: Implied},
+						{Element: "img", Name: "align", Type: Enumeration, Values: []string{"left", "right"}, Default: Default, Value: "left"},
+						{Element: "img", Name: "version", Type: CDATA, Default: Fixed, Value: "1.0"},
+						{Element: "img", Name: "format", Type: NOTATION, Values: []string{"png", "gif"}, Default: Implied},
+						{Element: "img", Name: "refs", Type: IDREFS, Default: Implied},
+					},
+				},
+				Notations: map[string]*Notation{
+					"png": {Name: "png", SystemID: "image/png"},
+					"gif": {Name: "gif", PublicID: "-//GIF//EN"},
+				},
+			},
+		},
+		{
+			`<!-- comments, <?pi?> and parameter entities between declarations -->
+			 <?pi?>
+			 <!ENTITY % decls "<!ELEMENT a EMPTY><!ATTLIST a x CDATA #IMPLIED>">
+			 %decls;`,
+			&DTD{
+				ParameterEntities: map[string]*Entity{
+					"decls": {Name: "decls", Parameter: true, Value: "<!ELEMENT a EMPTY><!ATTLIST a x CDATA #IMPLIED>"},
+				},
+				Elements: map[string]*Element{
+					"a": {Name: "a", Kind: Empty},
+				},
+				Attlists: map[string][]*AttributeDecl{
+					"a": {{Element: "a", Name: "x", Type: CDATA, Default: Implied}},
+				},
+			},
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			got, err := Parse(tst.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tst.want, got, cmpopts.EquateEmpty(), cmpopts.IgnoreTypes(tokeniser.Position{})); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	table := []struct {
+		input string
+		want  string
+	}{
+		{"<!ENTITY>", "1:9: expected whitespace after <!ENTITY"},
+		{"<!ENTITY a 'b'", "1:15: expected '>' to end the ENTITY declaration but got the end of the subset"},
+		{"<!ENTITY a \"b>", "1:12: unterminated entity value"},
+		{"<!ENTITY a '&#xZZ;'>", "1:12: malformed character reference '&#xZZ;'"},
+		{"<!ENTITY % a SYSTEM 'a' NDATA b>", "1:25: parameter entity 'a' cannot be unparsed"},
+		{"<!ELEMENT a (b, c | d)>", "1:19: cannot mix ',' and '|' in one group"},
+		{"<!ELEMENT a (#PCDATA | b)>", "1:26: mixed content with element names must end with ')*'"},
+		{"<!ELEMENT a EMPTY>\n<!ELEMENT a ANY>", "2:1: element 'a' is declared more than once"},
+		{"<!ELEMENT a SOME>", "1:13: expected EMPTY, ANY or '(' but got 'S'"},
+		{"<!ATTLIST a b STRING #IMPLIED>", "1:21: unknown attribute type 'STRING'"},
+		{"<!ATTLIST a b CDATA>", "1:20: expected whitespace after the attribute type"},
+		{"<!ATTLIST a b CDATA '<'>", "1:24: default value of 'b' cannot contain '<'"},
+		{"\n  %missing;", "2:3: unknown parameter entity '%missing;'"},
+		{"<!ENTITY a '%b;'>", "1:12: parameter entity references are not allowed inside declarations in an internal subset"},
+		{"<!ENTITY % a '&#37;a;'>\n%a;", "2:1: parameter entity '%a;' refers to itself"},
+		{"<!ENTITY % loop \"<!-- -->\">\n<!ENTITY % a 'b'> bad", "2:19: unexpected 'b' in DTD"},
+		{"<![INCLUDE[ ]]>", "1:1: conditional sections are only allowed in an external subset"},
+		{"<!-- never ends", "1:1: unterminated comment"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := Parse(tst.input)
+			if err == nil {
+				t.Fatal("wanted an error")
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestParseAtPositions(t *testing.T) {
+	_, err := ParseAt("<!ELEMENT a EMPTY>\n<!ELEMENT b>", tokeniser.Position{Offset: 20, Line: 3, Col: 5})
+	want := &Error{tokeniser.Position{Offset: 50, Line: 4, Col: 12}, "expected whitespace after the element name"}
+	if diff := cmp.Diff(want, err); diff != "" {
+		t.Error(diff)
+	}
+}
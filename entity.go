@@ -0,0 +1,285 @@
+package xmlparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/danwhitford/xmlparser/dtd"
+	"github.com/danwhitford/xmlparser/tokeniser"
+)
+
+var predefinedEntities = map[string]string{
+	"amp":  "&",
+	"lt":   "<",
+	"gt":   ">",
+	"quot": `"`,
+	"apos": "'",
+}
+
+func decodeEntities(s string, entities map[string]string) (string, error) {
+	return decodeReferences(s, func(ref string) (string, error) {
+		return resolveReference(ref, entities)
+	})
+}
+
+// decodeEntities decodes s with the entities known to the parser. Those
+// declared in its DTD are preferred to the caller's, except where they
+// cannot be expanded.
+func (p *parser) decodeEntities(s string) (string, error) {
+	return decodeReferences(s, func(ref string) (string, error) {
+		if p.expander == nil || !p.expander.declares(ref) {
+			return resolveReference(ref, p.entities)
+		}
+		val, err := p.expander.resolve(ref)
+		if fallback, ok := p.entities[ref]; err != nil && ok {
+			return fallback, nil
+		}
+		return val, err
+	})
+}
+
+func decodeReferences(s string, resolve func(ref string) (string, error)) (string, error) {
+	if !strings.Contains(s, "&") {
+		return s, nil
+	}
+
+	var sb strings.Builder
+	for {
+		amp := strings.IndexByte(s, '&')
+		if amp < 0 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+		sb.WriteString(s[:amp])
+		s = s[amp:]
+
+		semi := strings.IndexByte(s, ';')
+		if semi < 0 {
+			return "", fmt.Errorf("unterminated reference in '%s'", s)
+		}
+		ref := s[1:semi]
+		s = s[semi+1:]
+
+		val, err := resolve(ref)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(val)
+	}
+}
+
+func resolveReference(ref string, entities map[string]string) (string, error) {
+	if strings.HasPrefix(ref, "#") {
+		var code uint64
+		var err error
+		if strings.HasPrefix(ref, "#x") {
+			code, err = strconv.ParseUint(ref[2:], 16, 32)
+		} else {
+			code, err = strconv.ParseUint(ref[1:], 10, 32)
+		}
+		if err != nil || code == 0 || !utf8.ValidRune(rune(code)) {
+			return "", fmt.Errorf("malformed character reference '&%s;'", ref)
+		}
+		return string(rune(code)), nil
+	}
+
+	if val, ok := predefinedEntities[ref]; ok {
+		return val, nil
+	}
+	if val, ok := entities[ref]; ok {
+		return val, nil
+	}
+	if ref == "" || strings.ContainsAny(ref, " \t\n&") {
+		return "", fmt.Errorf("malformed entity reference '&%s;'", ref)
+	}
+	return "", fmt.Errorf("unknown entity '&%s;'", ref)
+}
+
+// maxEntityExpansion caps the text that expanding entities can produce
+// in one document, so that a few nested declarations cannot use up all
+// the memory there is.
+const maxEntityExpansion = 10 << 20
+
+// entityExpander works out the replacement text of the general entities
+// declared in a DTD as they are referenced, replacing any references to
+// other declared entities within them in turn. It keeps count of all the
+// text it has given out.
+type entityExpander struct {
+	d         *dtd.DTD
+	entities  map[string]string
+	sources   map[string]string
+	failed    map[string]error
+	expanding map[string]bool
+	total     int
+}
+
+// newEntityExpander expands the general entities declared in d, and the
+// extra entities given by the caller where d refers to them.
+func newEntityExpander(d *dtd.DTD, entities map[string]string) *entityExpander {
+	return &entityExpander{
+		d:         d,
+		entities:  entities,
+		sources:   map[string]string{},
+		failed:    map[string]error{},
+		expanding: map[string]bool{},
+	}
+}
+
+// declares reports whether name is a general entity declared in the DTD
+// rather than a predefined one.
+func (x *entityExpander) declares(name string) bool {
+	_, predefined := predefinedEntities[name]
+	_, ok := x.d.Entities[name]
+	return ok && !predefined
+}
+
+// expand gives the replacement text of the declared entity name, which
+// may hold markup. Character references and references to entities the
+// DTD does not declare are left in it, to be decoded with the text around
+// them. It fails once the text given out goes over maxEntityExpansion.
+func (x *entityExpander) expand(name string) (string, error) {
+	val, err := x.source(name)
+	if err != nil {
+		return "", err
+	}
+	x.total += len(val)
+	if x.total > maxEntityExpansion {
+		return "", fmt.Errorf("expanding entity '&%s;' goes over the limit of %d bytes", name, maxEntityExpansion)
+	}
+	return val, nil
+}
+
+// resolve gives the text a reference stands for where markup is not
+// allowed, as in attribute values.
+func (x *entityExpander) resolve(ref string) (string, error) {
+	if !x.declares(ref) {
+		return resolveReference(ref, x.entities)
+	}
+	val, err := x.expand(ref)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(val, "<") {
+		return "", fmt.Errorf("entity '&%s;' contains markup, which is only allowed in content", ref)
+	}
+	return decodeEntities(val, x.entities)
+}
+
+func (x *entityExpander) source(name string) (string, error) {
+	if val, ok := x.sources[name]; ok {
+		return val, nil
+	}
+	if err, ok := x.failed[name]; ok {
+		return "", err
+	}
+	if x.expanding[name] {
+		return "", fmt.Errorf("entity '&%s;' refers to itself", name)
+	}
+
+	e := x.d.Entities[name]
+	var val string
+	var err error
+	switch {
+	case e.NData != "":
+		err = fmt.Errorf("entity '&%s;' is unparsed and cannot be referenced", name)
+	case e.External():
+		err = fmt.Errorf("entity '&%s;' is external and is not loaded", name)
+	default:
+		x.expanding[name] = true
+		val, err = decodeReferences(e.Value, func(ref string) (string, error) {
+			if !x.declares(ref) {
+				return "&" + ref + ";", nil
+			}
+			return x.expand(ref)
+		})
+		delete(x.expanding, name)
+	}
+	if err != nil {
+		x.failed[name] = err
+		return "", err
+	}
+	x.sources[name] = val
+	return val, nil
+}
+
+// hasMarkup reports whether the declared entity name expands to markup
+// rather than just text.
+func (x *entityExpander) hasMarkup(name string) bool {
+	val, err := x.source(name)
+	return err == nil && strings.Contains(val, "<")
+}
+
+// balanced reports whether every tag opened in tokens is closed in them
+// too, and no tag is closed that was opened outside them.
+func balanced(tokens []tokeniser.Token) bool {
+	depth := 0
+	opening := false
+	for _, t := range tokens {
+		switch t.T {
+		case tokeniser.LB:
+			opening = true
+		case tokeniser.CloB:
+			depth--
+			if depth < 0 {
+				return false
+			}
+		case tokeniser.RB:
+			if opening {
+				depth++
+			}
+			opening = false
+		case tokeniser.SelfRB:
+			opening = false
+		}
+	}
+	return depth == 0
+}
+
+// escaper is for attribute values, which are always printed in double
+// quotes. Text only needs textEscaper.
+var escaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+)
+
+var textEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// escapeCData splits any "]]>" across two sections so that it cannot end
+// the section early.
+func escapeCData(s string) string {
+	return strings.ReplaceAll(s, "]]>", "]]]]><![CDATA[>")
+}
+
+// escapeComment breaks up any "--" with a space, and adds one after a
+// final '-', as neither can appear inside a comment.
+func escapeComment(s string) string {
+	for strings.Contains(s, "--") {
+		s = strings.ReplaceAll(s, "--", "- -")
+	}
+	if strings.HasSuffix(s, "-") {
+		s += " "
+	}
+	return s
+}
+
+// escapeInstruction breaks up any "?>" with a space so that it cannot end
+// a processing instruction early.
+func escapeInstruction(s string) string {
+	return strings.ReplaceAll(s, "?>", "? >")
+}
@@ -0,0 +1,55 @@
+package xmlparser
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecodeEntities(t *testing.T) {
+	table := []struct {
+		input string
+		want  string
+	}{
+		{"plain", "plain"},
+		{"fish&amp;chips", "fish&chips"},
+		{"&lt;b&gt;", "<b>"},
+		{"&quot;hi&apos;", `"hi'`},
+		{"&#x2014;", "—"},
+		{"&#8212;", "—"},
+		{"&copy; 2024", "© 2024"},
+	}
+
+	entities := map[string]string{"copy": "©"}
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			got, err := decodeEntities(tst.input, entities)
+			if err != nil {
+				t.Fatalf("failed on input '%v'. %v.", tst.input, err)
+			}
+			if diff := cmp.Diff(tst.want, got); diff != "" {
+				t.Fatalf("failed on input '%v' with diff '%v'", tst.input, diff)
+			}
+		})
+	}
+}
+
+func TestDecodeEntitiesErrors(t *testing.T) {
+	table := []string{
+		"fish & chips",
+		"&nbsp;",
+		"&amp",
+		"&#xZZ;",
+		"&#0;",
+		"&#x110000;",
+		"&;",
+	}
+
+	for _, input := range table {
+		_, err := decodeEntities(input, nil)
+		if err == nil {
+			t.Fatalf("wanted an error for input '%v'", input)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package xmlparser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/danwhitford/xmlparser/tokeniser"
+)
+
+// SyntaxError reports input that could not be parsed. Expected is only
+// set when the parser was after particular kinds of token, and Got is
+// tokeniser.EOF when the input ran out. Stack holds the names of the
+// elements that were open, outermost first.
+type SyntaxError struct {
+	File     string
+	Pos      tokeniser.Position
+	Msg      string
+	Expected []tokeniser.TokenType
+	Got      tokeniser.TokenType
+	Stack    []string
+}
+
+func (e *SyntaxError) Error() string {
+	if len(e.Stack) == 0 {
+		return fmt.Sprintf("%s: %s", location(e.File, e.Pos), e.Msg)
+	}
+	return fmt.Sprintf("%s: %s (in /%s)", location(e.File, e.Pos), e.Msg, strings.Join(e.Stack, "/"))
+}
+
+// MismatchedTagError reports a closing tag that does not match the
+// element it closes. Pos is where the closing tag starts and Opened is
+// where the element it should have closed starts.
+type MismatchedTagError struct {
+	File   string
+	Pos    tokeniser.Position
+	Want   string
+	Got    string
+	Opened tokeniser.Position
+	Stack  []string
+}
+
+func (e *MismatchedTagError) Error() string {
+	return fmt.Sprintf(
+		"%s: closing tag '%s' does not match '%s' opened at %v",
+		location(e.File, e.Pos), e.Got, e.Want, e.Opened,
+	)
+}
+
+// ValidationError reports a way in which a document breaks the rules of
+// its schema. Stack holds the names of the element it is in and those
+// around it, outermost first.
+type ValidationError struct {
+	Pos   tokeniser.Position
+	Msg   string
+	Stack []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%v: %s (in /%s)", e.Pos, e.Msg, strings.Join(e.Stack, "/"))
+}
+
+func location(file string, pos tokeniser.Position) string {
+	if file == "" {
+		return pos.String()
+	}
+	return fmt.Sprintf("%s:%v", file, pos)
+}
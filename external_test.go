@@ -4,6 +4,7 @@ import (
 	_ "embed"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/danwhitford/xmlparser"
 	"github.com/google/go-cmp/cmp"
@@ -26,3 +27,36 @@ func TestExamplePodFeed(t *testing.T) {
 		t.Fatalf("wanted indentical parse/deparse but got diff %s", diff)
 	}
 }
+
+func TestExamplePodFeedFromReader(t *testing.T) {
+	want, err := xmlparser.Parse(exampleRss)
+	if err != nil {
+		t.Fatalf("did not want an error. %s", err)
+	}
+
+	got, err := xmlparser.ParseReader(iotest.OneByteReader(strings.NewReader(exampleRss)))
+	if err != nil {
+		t.Fatalf("did not want an error. %s", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("wanted the same tree from a reader but got diff %s", diff)
+	}
+}
+
+func TestExamplePodFeedNamespaces(t *testing.T) {
+	root, err := xmlparser.Parse(exampleRss)
+	if err != nil {
+		t.Fatalf("did not want an error. %s", err)
+	}
+
+	authors := root.FindAllNS("http://www.itunes.com/dtds/podcast-1.0.dtd", "author")
+	if len(authors) != 3 {
+		t.Fatalf("wanted 3 iTunes authors but got %d", len(authors))
+	}
+	for _, author := range authors {
+		if author.Contents != "Podcast Author" {
+			t.Fatalf("wrong author '%s'", author.Contents)
+		}
+	}
+}
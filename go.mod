@@ -1,5 +1,5 @@
 module github.com/danwhitford/xmlparser
 
-go 1.22.0
+go 1.23.0
 
 require github.com/google/go-cmp v0.6.0
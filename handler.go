@@ -0,0 +1,40 @@
+package xmlparser
+
+import "io"
+
+// Handler receives the contents of a document as ParseWithHandler reads
+// it. Returning an error from any method stops the parse, and that error
+// is returned from ParseWithHandler.
+type Handler interface {
+	StartElement(name string, attrs []Attribute) error
+	EndElement(name string) error
+	CharData(text string) error
+	ProcessingInstruction(target, data string) error
+	Comment(text string) error
+}
+
+func ParseWithHandler(r io.Reader, h Handler) error {
+	d := NewDecoder(r)
+	for tok, err := range d.Tokens() {
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case StartElement:
+			err = h.StartElement(t.Name, t.Attributes)
+		case EndElement:
+			err = h.EndElement(t.Name)
+		case CharData:
+			err = h.CharData(t.Text)
+		case ProcInst:
+			err = h.ProcessingInstruction(t.Target, t.Data)
+		case Comment:
+			err = h.Comment(t.Text)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
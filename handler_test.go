@@ -0,0 +1,92 @@
+package xmlparser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type recordingHandler struct {
+	events []string
+	stopAt string
+}
+
+var errStopped = errors.New("stopped")
+
+func (h *recordingHandler) record(event string) error {
+	h.events = append(h.events, event)
+	if event == h.stopAt {
+		return errStopped
+	}
+	return nil
+}
+
+func (h *recordingHandler) StartElement(name string, attrs []Attribute) error {
+	event := "start " + name
+	for _, attr := range attrs {
+		event += fmt.Sprintf(" %s=%s", attr.Key, attr.Value)
+	}
+	return h.record(event)
+}
+
+func (h *recordingHandler) EndElement(name string) error {
+	return h.record("end " + name)
+}
+
+func (h *recordingHandler) CharData(text string) error {
+	return h.record(fmt.Sprintf("text %q", text))
+}
+
+func (h *recordingHandler) ProcessingInstruction(target, data string) error {
+	return h.record(fmt.Sprintf("pi %s %q", target, data))
+}
+
+func (h *recordingHandler) Comment(text string) error {
+	return h.record(fmt.Sprintf("comment %q", text))
+}
+
+func TestParseWithHandler(t *testing.T) {
+	input := `<?xml version="1.0"?><feed><!--hi--><item id="1">one</item><item id="2"/></feed>`
+	h := &recordingHandler{}
+	err := ParseWithHandler(strings.NewReader(input), h)
+	if err != nil {
+		t.Fatalf("did not want an error. %v", err)
+	}
+	want := []string{
+		`pi xml "version=\"1.0\""`,
+		"start feed",
+		`comment "hi"`,
+		"start item id=1",
+		`text "one"`,
+		"end item",
+		"start item id=2",
+		"end item",
+		"end feed",
+	}
+	if diff := cmp.Diff(want, h.events); diff != "" {
+		t.Fatalf("wrong events with diff '%v'", diff)
+	}
+}
+
+func TestParseWithHandlerAbort(t *testing.T) {
+	input := `<feed><item id="1">one</item><item id="2"/><broken</feed>`
+	h := &recordingHandler{stopAt: "start item id=2"}
+	err := ParseWithHandler(strings.NewReader(input), h)
+	if !errors.Is(err, errStopped) {
+		t.Fatalf("wanted the handler's error but got %v", err)
+	}
+	if got := h.events[len(h.events)-1]; got != h.stopAt {
+		t.Fatalf("wanted no events after stopping but the last was '%v'", got)
+	}
+}
+
+func TestParseWithHandlerSyntaxError(t *testing.T) {
+	err := ParseWithHandler(strings.NewReader(`<feed><item></feed>`), &recordingHandler{})
+	var mismatchErr *MismatchedTagError
+	if !errors.As(err, &mismatchErr) {
+		t.Fatalf("wanted a MismatchedTagError but got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package xmlparser
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	XMLNamespace   = "http://www.w3.org/XML/1998/namespace"
+	XMLNSNamespace = "http://www.w3.org/2000/xmlns/"
+)
+
+func splitName(name string) (string, string) {
+	prefix, local, ok := strings.Cut(name, ":")
+	if !ok {
+		return "", name
+	}
+	return prefix, local
+}
+
+func (node XmlNode) Prefix() string {
+	prefix, _ := splitName(node.Name)
+	return prefix
+}
+
+func (node XmlNode) Local() string {
+	_, local := splitName(node.Name)
+	return local
+}
+
+func (attr Attribute) Prefix() string {
+	prefix, _ := splitName(attr.Key)
+	return prefix
+}
+
+func (attr Attribute) Local() string {
+	_, local := splitName(attr.Key)
+	return local
+}
+
+// FindAllNS returns node and every element below it whose local name is
+// local and whose namespace is space, in document order. It differs from
+// DescendantsNS only in taking in node itself.
+func (node XmlNode) FindAllNS(space, local string) []XmlNode {
+	var found []XmlNode
+	if node.Type == ElementNode && node.hasName(space, local) {
+		found = append(found, node)
+	}
+	return slices.AppendSeq(found, node.DescendantsNS(space, local))
+}
+
+// declareNamespaces picks out the xmlns attributes of an element that has
+// just been opened, so that they are in scope for it and its children.
+func (p *parser) declareNamespaces(attrs []Attribute) (map[string]string, error) {
+	var bindings map[string]string
+	for _, attr := range attrs {
+		var prefix string
+		switch {
+		case attr.Key == "xmlns":
+			prefix = ""
+			if attr.Value == XMLNamespace || attr.Value == XMLNSNamespace {
+				return nil, p.errorIn(attr.Span, "the default namespace cannot be bound to '%s'", attr.Value)
+			}
+		case strings.HasPrefix(attr.Key, "xmlns:"):
+			prefix = attr.Local()
+			if attr.Value == "" {
+				return nil, p.errorIn(attr.Span, "namespace prefix '%s' cannot be bound to an empty name", prefix)
+			}
+			if prefix == "xmlns" || attr.Value == XMLNSNamespace || (prefix == "xml") != (attr.Value == XMLNamespace) {
+				return nil, p.errorIn(attr.Span, "namespace prefix '%s' cannot be bound to '%s'", prefix, attr.Value)
+			}
+		default:
+			continue
+		}
+		if bindings == nil {
+			bindings = map[string]string{}
+		}
+		bindings[prefix] = attr.Value
+	}
+	return bindings, nil
+}
+
+func (p *parser) lookupNamespace(prefix string) (string, bool) {
+	switch prefix {
+	case "xml":
+		return XMLNamespace, true
+	case "xmlns":
+		return XMLNSNamespace, true
+	}
+	for i := len(p.bindings) - 1; i >= 0; i-- {
+		if space, ok := p.bindings[i][prefix]; ok {
+			return space, true
+		}
+	}
+	// Unprefixed names are in no namespace unless a default is declared
+	return "", prefix == ""
+}
+
+// resolveNamespaces fills in the namespaces of an element, which must be
+// at the top of the stack, and its attributes.
+func (p *parser) resolveNamespaces(start *StartElement) error {
+	space, ok := p.lookupNamespace(start.Prefix())
+	if !ok {
+		return p.errorIn(start.Span, "namespace prefix '%s' has not been declared", start.Prefix())
+	}
+	start.Namespace = space
+
+	for i, attr := range start.Attributes {
+		if attr.Key == "xmlns" {
+			start.Attributes[i].Namespace = XMLNSNamespace
+			continue
+		}
+		prefix := attr.Prefix()
+		if prefix == "" {
+			// Unprefixed attributes never take the default namespace
+			continue
+		}
+		space, ok := p.lookupNamespace(prefix)
+		if !ok {
+			return p.errorIn(attr.Span, "namespace prefix '%s' has not been declared", prefix)
+		}
+		start.Attributes[i].Namespace = space
+	}
+	return nil
+}
+
+func (start StartElement) Prefix() string {
+	prefix, _ := splitName(start.Name)
+	return prefix
+}
+
+func (start StartElement) Local() string {
+	_, local := splitName(start.Name)
+	return local
+}
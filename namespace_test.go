@@ -0,0 +1,130 @@
+package xmlparser
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+const (
+	atomSpace   = "http://www.w3.org/2005/Atom"
+	itunesSpace = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+)
+
+func TestParseNamespaces(t *testing.T) {
+	input := `<feed xmlns="http://www.w3.org/2005/Atom" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">` +
+		`<itunes:author>Dan</itunes:author>` +
+		`<link itunes:rel="self" href="x" xml:lang="en"/>` +
+		`<plain xmlns=""><itunes:author xmlns:itunes="urn:other">Other</itunes:author></plain>` +
+		`</feed>`
+	got, err := Parse(input)
+	if err != nil {
+		t.Fatalf("did not want an error. %v", err)
+	}
+
+	want := XmlNode{
+		Name:      "feed",
+		Namespace: atomSpace,
+		Attributes: []Attribute{
+			{Key: "xmlns", Value: atomSpace, Namespace: XMLNSNamespace},
+			{Key: "xmlns:itunes", Value: itunesSpace, Namespace: XMLNSNamespace},
+		},
+		Children: []XmlNode{
+			{Name: "itunes:author", Namespace: itunesSpace, Contents: "Dan"},
+			{
+				Name:      "link",
+				Namespace: atomSpace,
+				Attributes: []Attribute{
+					{Key: "itunes:rel", Value: "self", Namespace: itunesSpace},
+					{Key: "href", Value: "x"},
+					{Key: "xml:lang", Value: "en", Namespace: XMLNamespace},
+				},
+			},
+			{
+				Name:       "plain",
+				Attributes: []Attribute{{Key: "xmlns", Value: "", Namespace: XMLNSNamespace}},
+				Children: []XmlNode{
+					{
+						Name:       "itunes:author",
+						Namespace:  "urn:other",
+						Contents:   "Other",
+						Attributes: []Attribute{{Key: "xmlns:itunes", Value: "urn:other", Namespace: XMLNSNamespace}},
+					},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty(), cmpopts.IgnoreTypes(Span{})); diff != "" {
+		t.Fatalf("wrong namespaces with diff '%v'", diff)
+	}
+
+	if got.Children[0].Prefix() != "itunes" || got.Children[0].Local() != "author" {
+		t.Fatalf("wrong split of '%v'", got.Children[0].Name)
+	}
+	if got.Children[1].Attributes[0].Prefix() != "itunes" || got.Children[1].Attributes[0].Local() != "rel" {
+		t.Fatalf("wrong split of '%v'", got.Children[1].Attributes[0].Key)
+	}
+}
+
+func TestParseNamespaceErrors(t *testing.T) {
+	table := []struct {
+		input string
+		want  string
+	}{
+		{`<itunes:author>Dan</itunes:author>`, "1:1: namespace prefix 'itunes' has not been declared (in /itunes:author)"},
+		{`<a><b x:y="1"/></a>`, "1:7: namespace prefix 'x' has not been declared (in /a/b)"},
+		{`<a xmlns:x="urn:x"></a><x:b/>`, "1:24: namespace prefix 'x' has not been declared (in /x:b)"},
+		{`<a><b xmlns:x="urn:x"/><x:c/></a>`, "1:24: namespace prefix 'x' has not been declared (in /a/x:c)"},
+		{`<a xmlns:x=""/>`, "1:4: namespace prefix 'x' cannot be bound to an empty name (in /a)"},
+		{`<a xmlns:xml="urn:x"/>`, "1:4: namespace prefix 'xml' cannot be bound to 'urn:x' (in /a)"},
+		{`<a xmlns:x="http://www.w3.org/2000/xmlns/"/>`, "1:4: namespace prefix 'x' cannot be bound to 'http://www.w3.org/2000/xmlns/' (in /a)"},
+		{`<a xmlns="http://www.w3.org/2000/xmlns/"/>`, "1:4: the default namespace cannot be bound to 'http://www.w3.org/2000/xmlns/' (in /a)"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := Parse(tst.input)
+			if tst.want == "" {
+				if err != nil {
+					t.Fatalf("did not want an error for input '%v'. %v", tst.input, err)
+				}
+				return
+			}
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("wanted a SyntaxError for input '%v' but got %v", tst.input, err)
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Fatalf("wrong error for input '%v' with diff '%v'", tst.input, diff)
+			}
+		})
+	}
+}
+
+func TestFindAllNS(t *testing.T) {
+	root, err := Parse(`<rss xmlns:itunes="` + itunesSpace + `" xmlns:dc="urn:dc">` +
+		`<author>Not me</author><itunes:author>Me</itunes:author>` +
+		`<item><dc:author>Not me either</dc:author><itunes:author>Me again</itunes:author></item>` +
+		`</rss>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, node := range root.FindAllNS(itunesSpace, "author") {
+		got = append(got, node.Contents)
+	}
+	if diff := cmp.Diff([]string{"Me", "Me again"}, got); diff != "" {
+		t.Fatalf("wrong elements with diff '%v'", diff)
+	}
+
+	// Unlike DescendantsNS, node itself is included
+	item, _ := root.Child("item")
+	author, _ := item.ChildNS(itunesSpace, "author")
+	if diff := cmp.Diff(1, len(author.FindAllNS(itunesSpace, "author"))); diff != "" {
+		t.Fatalf("wrong elements with diff '%v'", diff)
+	}
+}
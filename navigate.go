@@ -0,0 +1,157 @@
+package xmlparser
+
+import (
+	"iter"
+	"strings"
+)
+
+// Child gives the first child element named name, as written with any
+// prefix, and whether there was one.
+func (node XmlNode) Child(name string) (XmlNode, bool) {
+	return node.firstChild(func(child XmlNode) bool { return child.Name == name })
+}
+
+// ChildNS gives the first child element with the local name local in the
+// namespace space, and whether there was one.
+func (node XmlNode) ChildNS(space, local string) (XmlNode, bool) {
+	return node.firstChild(func(child XmlNode) bool { return child.hasName(space, local) })
+}
+
+// FirstChild gives the first child element, skipping text, comments and
+// processing instructions, and whether there was one.
+func (node XmlNode) FirstChild() (XmlNode, bool) {
+	return node.firstChild(func(child XmlNode) bool { return true })
+}
+
+func (node XmlNode) firstChild(match func(XmlNode) bool) (XmlNode, bool) {
+	for _, child := range node.Children {
+		if child.Type == ElementNode && match(child) {
+			return child, true
+		}
+	}
+	return XmlNode{}, false
+}
+
+// ChildrenNamed gives the child elements named name, as written with any
+// prefix.
+func (node XmlNode) ChildrenNamed(name string) []XmlNode {
+	var out []XmlNode
+	for _, child := range node.Children {
+		if child.Type == ElementNode && child.Name == name {
+			out = append(out, child)
+		}
+	}
+	return out
+}
+
+// ChildrenNamedNS gives the child elements with the local name local in
+// the namespace space.
+func (node XmlNode) ChildrenNamedNS(space, local string) []XmlNode {
+	var out []XmlNode
+	for _, child := range node.Children {
+		if child.Type == ElementNode && child.hasName(space, local) {
+			out = append(out, child)
+		}
+	}
+	return out
+}
+
+func (node XmlNode) hasName(space, local string) bool {
+	return node.Namespace == space && node.Local() == local
+}
+
+// Attr gives the value of the attribute with the key as written, and
+// whether there was one.
+func (node XmlNode) Attr(key string) (string, bool) {
+	for _, a := range node.Attributes {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// AttrOr gives the value of the attribute with the key as written, or def
+// if there is none.
+func (node XmlNode) AttrOr(key, def string) string {
+	if value, ok := node.Attr(key); ok {
+		return value
+	}
+	return def
+}
+
+// AttrNS gives the value of the attribute with the local name local in
+// the namespace space, and whether there was one. Attributes without a
+// prefix are in no namespace.
+func (node XmlNode) AttrNS(space, local string) (string, bool) {
+	for _, a := range node.Attributes {
+		if a.Namespace == space && a.Local() == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// AttrOrNS is AttrNS giving def if there is no such attribute.
+func (node XmlNode) AttrOrNS(space, local, def string) string {
+	if value, ok := node.AttrNS(space, local); ok {
+		return value
+	}
+	return def
+}
+
+// Text gives all the text inside node, including that of the elements
+// within it, in document order. Comments and processing instructions are
+// left out.
+func (node XmlNode) Text() string {
+	var sb strings.Builder
+	node.appendText(&sb)
+	return sb.String()
+}
+
+func (node XmlNode) appendText(sb *strings.Builder) {
+	if len(node.Children) == 0 {
+		if node.Type != CommentNode && node.Type != ProcInstNode {
+			sb.WriteString(node.Contents)
+		}
+		return
+	}
+	for _, child := range node.Children {
+		child.appendText(sb)
+	}
+}
+
+// Descendants ranges over the elements below node named name, as written
+// with any prefix, in document order.
+func (node XmlNode) Descendants(name string) iter.Seq[XmlNode] {
+	return node.descendants(func(n XmlNode) bool { return n.Name == name })
+}
+
+// DescendantsNS ranges over the elements below node with the local name
+// local in the namespace space, in document order.
+func (node XmlNode) DescendantsNS(space, local string) iter.Seq[XmlNode] {
+	return node.descendants(func(n XmlNode) bool { return n.hasName(space, local) })
+}
+
+func (node XmlNode) descendants(match func(XmlNode) bool) iter.Seq[XmlNode] {
+	return func(yield func(XmlNode) bool) {
+		node.walk(match, yield)
+	}
+}
+
+// walk yields the matching elements below node, reporting false once
+// yield asks to stop.
+func (node XmlNode) walk(match func(XmlNode) bool, yield func(XmlNode) bool) bool {
+	for _, child := range node.Children {
+		if child.Type != ElementNode {
+			continue
+		}
+		if match(child) && !yield(child) {
+			return false
+		}
+		if !child.walk(match, yield) {
+			return false
+		}
+	}
+	return true
+}
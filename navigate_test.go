@@ -0,0 +1,190 @@
+package xmlparser
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const navigateXML = `<rss xmlns:itunes="urn:itunes" version="2.0">
+	<channel>
+		<!-- the feed -->
+		<title>Feed</title>
+		<item id="a"><title>One</title><itunes:duration>60</itunes:duration></item>
+		<item id="b" itunes:explicit="no"><title>Two</title><desc>Hi <b>bold</b> <![CDATA[<there>]]><?pi x="1"?></desc></item>
+		<extra><item id="c"><title>Three</title></item></extra>
+	</channel>
+</rss>`
+
+func TestChild(t *testing.T) {
+	root, err := Parse(navigateXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel, ok := root.Child("channel")
+	if !ok {
+		t.Fatal("wanted a channel")
+	}
+	item, _ := channel.Child("item")
+
+	table := []struct {
+		find   func() (XmlNode, bool)
+		want   string
+		wantOk bool
+	}{
+		{func() (XmlNode, bool) { return channel.Child("item") }, "a", true},
+		{func() (XmlNode, bool) { return channel.Child("nope") }, "", false},
+		{func() (XmlNode, bool) { return channel.FirstChild() }, "title", true},
+		{func() (XmlNode, bool) { return XmlNode{Contents: "text"}.FirstChild() }, "", false},
+		{func() (XmlNode, bool) { return item.ChildNS("urn:itunes", "duration") }, "itunes:duration", true},
+		{func() (XmlNode, bool) { return item.ChildNS("", "duration") }, "", false},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			node, ok := tst.find()
+			if ok != tst.wantOk {
+				t.Fatalf("wanted %v but got %v", tst.wantOk, ok)
+			}
+			got := node.AttrOr("id", node.Name)
+			if diff := cmp.Diff(tst.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestChildrenNamed(t *testing.T) {
+	root, err := Parse(navigateXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel, _ := root.Child("channel")
+
+	var got []string
+	for _, item := range channel.ChildrenNamed("item") {
+		got = append(got, item.AttrOr("id", ""))
+	}
+	if diff := cmp.Diff([]string{"a", "b"}, got); diff != "" {
+		t.Error(diff)
+	}
+
+	item, _ := channel.Child("item")
+	if diff := cmp.Diff(1, len(item.ChildrenNamedNS("urn:itunes", "duration"))); diff != "" {
+		t.Error(diff)
+	}
+	if got := channel.ChildrenNamed("nope"); got != nil {
+		t.Errorf("wanted nothing but got %v", got)
+	}
+}
+
+func TestAttr(t *testing.T) {
+	root, err := Parse(navigateXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel, _ := root.Child("channel")
+	item := channel.ChildrenNamed("item")[1]
+
+	table := []struct {
+		lookup func() (string, bool)
+		want   string
+		wantOk bool
+	}{
+		{func() (string, bool) { return root.Attr("version") }, "2.0", true},
+		{func() (string, bool) { return root.Attr("missing") }, "", false},
+		{func() (string, bool) { return root.Attr("xmlns:itunes") }, "urn:itunes", true},
+		{func() (string, bool) { return item.Attr("itunes:explicit") }, "no", true},
+		{func() (string, bool) { return item.AttrNS("urn:itunes", "explicit") }, "no", true},
+		{func() (string, bool) { return item.AttrNS("", "explicit") }, "", false},
+		{func() (string, bool) { return item.AttrNS("", "id") }, "b", true},
+		{func() (string, bool) { return item.AttrOr("missing", "def"), true }, "def", true},
+		{func() (string, bool) { return item.AttrOrNS("urn:itunes", "explicit", "yes"), true }, "no", true},
+		{func() (string, bool) { return item.AttrOrNS("urn:itunes", "block", "yes"), true }, "yes", true},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			got, ok := tst.lookup()
+			if ok != tst.wantOk {
+				t.Fatalf("wanted %v but got %v", tst.wantOk, ok)
+			}
+			if diff := cmp.Diff(tst.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	root, err := Parse(navigateXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel, _ := root.Child("channel")
+	items := channel.ChildrenNamed("item")
+	p, err := Parse("<p><b>Hello</b> <i>world</i></p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		node XmlNode
+		want string
+	}{
+		{items[0], "One60"},
+		{items[1], "TwoHi bold <there>"},
+		{items[1].Children[1], "Hi bold <there>"},
+		{items[1].Children[0], "Two"},
+		{channel.Children[1], ""},
+		{p, "Hello world"},
+		{XmlNode{Type: TextNode, Contents: "loose"}, "loose"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			if diff := cmp.Diff(tst.want, tst.node.Text()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestDescendants(t *testing.T) {
+	root, err := Parse(navigateXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for title := range root.Descendants("title") {
+		got = append(got, title.Text())
+	}
+	if diff := cmp.Diff([]string{"Feed", "One", "Two", "Three"}, got); diff != "" {
+		t.Error(diff)
+	}
+
+	got = nil
+	for item := range root.Descendants("item") {
+		got = append(got, item.AttrOr("id", ""))
+		if len(got) == 2 {
+			break
+		}
+	}
+	if diff := cmp.Diff([]string{"a", "b"}, got); diff != "" {
+		t.Error(diff)
+	}
+
+	got = nil
+	for d := range root.DescendantsNS("urn:itunes", "duration") {
+		got = append(got, d.Text())
+	}
+	if diff := cmp.Diff([]string{"60"}, got); diff != "" {
+		t.Error(diff)
+	}
+
+	for range root.Descendants("rss") {
+		t.Error("wanted the node itself to be left out")
+	}
+}
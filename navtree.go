@@ -0,0 +1,268 @@
+package xmlparser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/danwhitford/xmlparser/tokeniser"
+)
+
+type navKind int
+
+const (
+	rootNav navKind = iota
+	elementNav
+	attributeNav
+	namespaceNav
+	textNav
+	commentNav
+	procInstNav
+)
+
+// navNode is a node in the XPath data model, built over an XmlNode tree
+// so that queries can walk up and across it as well as down. Runs of
+// text and CDATA are joined into one text node, and an element whose
+// text is kept in Contents gets a text node for it.
+type navNode struct {
+	kind     navKind
+	node     *XmlNode
+	attr     *Attribute
+	text     string
+	parent   *navNode
+	children []*navNode
+	attrs    []*navNode
+	index    int
+
+	// order is the position of the node in the document. Namespace nodes
+	// take the order of their element and sort straight after it.
+	order int
+}
+
+// newNavTree builds the data model for root, under a document node of
+// its own.
+func newNavTree(root *XmlNode) *navNode {
+	doc := &navNode{kind: rootNav}
+	order := 1
+	el := buildNav(root, doc, &order)
+	doc.children = []*navNode{el}
+	return doc
+}
+
+func buildNav(node *XmlNode, parent *navNode, order *int) *navNode {
+	n := &navNode{parent: parent, node: node, order: *order}
+	*order++
+	switch node.Type {
+	case ElementNode:
+		n.kind = elementNav
+	case CommentNode:
+		n.kind = commentNav
+		return n
+	case ProcInstNode:
+		n.kind = procInstNav
+		return n
+	default:
+		n.kind = textNav
+		n.text = node.Contents
+		return n
+	}
+
+	for i := range node.Attributes {
+		a := &node.Attributes[i]
+		if a.Namespace == XMLNSNamespace {
+			continue
+		}
+		n.attrs = append(n.attrs, &navNode{kind: attributeNav, attr: a, parent: n, index: len(n.attrs), order: *order})
+		*order++
+	}
+
+	if node.Contents != "" {
+		n.children = append(n.children, &navNode{kind: textNav, node: node, text: node.Contents, parent: n, order: *order})
+		*order++
+		return n
+	}
+
+	var text *navNode
+	for i := range node.Children {
+		child := &node.Children[i]
+		isText := child.Type == TextNode || child.Type == CDataNode
+		if isText && text != nil {
+			text.text += child.Contents
+			continue
+		}
+		c := buildNav(child, n, order)
+		c.index = len(n.children)
+		n.children = append(n.children, c)
+		text = nil
+		if isText {
+			text = c
+		}
+	}
+	return n
+}
+
+// stringValue is the text of the node as XPath sees it. For the document
+// and elements it is all the text inside them.
+func (n *navNode) stringValue() string {
+	switch n.kind {
+	case attributeNav, namespaceNav:
+		return n.attr.Value
+	case textNav:
+		return n.text
+	case commentNav, procInstNav:
+		return n.node.Contents
+	}
+	var sb strings.Builder
+	n.appendText(&sb)
+	return sb.String()
+}
+
+func (n *navNode) appendText(sb *strings.Builder) {
+	for _, child := range n.children {
+		switch child.kind {
+		case textNav:
+			sb.WriteString(child.text)
+		case elementNav:
+			child.appendText(sb)
+		}
+	}
+}
+
+// name gives the qualified name, namespace and local name of the node,
+// which are empty for kinds of node without one.
+func (n *navNode) name() (string, string, string) {
+	switch n.kind {
+	case elementNav:
+		return n.node.Name, n.node.Namespace, n.node.Local()
+	case attributeNav:
+		return n.attr.Key, n.attr.Namespace, n.attr.Local()
+	case namespaceNav:
+		return n.attr.Key, "", n.attr.Key
+	case procInstNav:
+		return n.node.Name, "", n.node.Name
+	}
+	return "", "", ""
+}
+
+func (n *navNode) pos() tokeniser.Position {
+	switch {
+	case n.kind == attributeNav:
+		return n.attr.Span.Start
+	case n.node != nil:
+		return n.node.Span.Start
+	}
+	return tokeniser.Position{}
+}
+
+// before reports whether n comes before m in document order.
+func (n *navNode) before(m *navNode) bool {
+	if n.order != m.order {
+		return n.order < m.order
+	}
+	if n.kind != m.kind {
+		return n.kind != namespaceNav
+	}
+	return n.index < m.index
+}
+
+// namespaces gives the namespace nodes of an element, one for each prefix
+// in scope, including xml. Each keeps its prefix and URI in attr.
+func (n *navNode) namespaces() []*navNode {
+	seen := map[string]bool{}
+	var out []*navNode
+	add := func(prefix, uri string) {
+		if seen[prefix] {
+			return
+		}
+		seen[prefix] = true
+		if uri == "" {
+			return
+		}
+		ns := &navNode{
+			kind:   namespaceNav,
+			attr:   &Attribute{Key: prefix, Value: uri},
+			parent: n,
+			order:  n.order,
+			index:  len(out),
+		}
+		out = append(out, ns)
+	}
+	for e := n; e != nil && e.kind == elementNav; e = e.parent {
+		for _, a := range e.node.Attributes {
+			if a.Namespace != XMLNSNamespace {
+				continue
+			}
+			prefix := ""
+			if a.Key != "xmlns" {
+				prefix = a.Local()
+			}
+			add(prefix, a.Value)
+		}
+	}
+	add("xml", XMLNamespace)
+	return out
+}
+
+// lookupPrefix finds the first declaration of prefix at or below n, in
+// document order.
+func (n *navNode) lookupPrefix(prefix string) (string, bool) {
+	if n.kind == elementNav {
+		for _, a := range n.node.Attributes {
+			if a.Namespace == XMLNSNamespace && a.Prefix() == "xmlns" && a.Local() == prefix {
+				return a.Value, true
+			}
+		}
+	}
+	for _, child := range n.children {
+		if uri, ok := child.lookupPrefix(prefix); ok {
+			return uri, true
+		}
+	}
+	return "", false
+}
+
+// path locates n with a position at every step, such as
+// /rss[1]/channel[1]/item[2] or /rss[1]/@version.
+func (n *navNode) path() string {
+	if n.kind == rootNav {
+		return "/"
+	}
+	var steps []string
+	for ; n.kind != rootNav; n = n.parent {
+		steps = append(steps, n.step())
+	}
+	slices.Reverse(steps)
+	return "/" + strings.Join(steps, "/")
+}
+
+// step is the last part of the path to n, counting only the siblings
+// that share its name or kind.
+func (n *navNode) step() string {
+	switch n.kind {
+	case attributeNav:
+		return "@" + n.attr.Key
+	case namespaceNav:
+		return "namespace::" + n.attr.Key
+	}
+	same := func(m *navNode) bool {
+		return m.kind == n.kind && (n.kind != elementNav || m.node.Name == n.node.Name)
+	}
+	position := 1
+	for _, sibling := range n.parent.children[:n.index] {
+		if same(sibling) {
+			position++
+		}
+	}
+	var test string
+	switch n.kind {
+	case elementNav:
+		test = n.node.Name
+	case textNav:
+		test = "text()"
+	case commentNav:
+		test = "comment()"
+	default:
+		test = "processing-instruction()"
+	}
+	return fmt.Sprintf("%s[%d]", test, position)
+}
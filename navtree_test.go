@@ -0,0 +1,80 @@
+package xmlparser
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNavTree(t *testing.T) {
+	root, err := Parse(`<a x="1"><b>one</b><b>t<![CDATA[w]]>o<c/>three</b><!--note--><?pi k="v"?></a>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := newNavTree(&root)
+
+	type row struct {
+		Path  string
+		Value string
+	}
+	var got []row
+	var walk func(n *navNode)
+	walk = func(n *navNode) {
+		got = append(got, row{n.path(), n.stringValue()})
+		for _, a := range n.attrs {
+			got = append(got, row{a.path(), a.stringValue()})
+		}
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	want := []row{
+		{"/", "onetwothree"},
+		{"/a[1]", "onetwothree"},
+		{"/a[1]/@x", "1"},
+		{"/a[1]/b[1]", "one"},
+		{"/a[1]/b[1]/text()[1]", "one"},
+		{"/a[1]/b[2]", "twothree"},
+		{"/a[1]/b[2]/text()[1]", "two"},
+		{"/a[1]/b[2]/c[1]", ""},
+		{"/a[1]/b[2]/text()[2]", "three"},
+		{"/a[1]/comment()[1]", "note"},
+		{"/a[1]/processing-instruction()[1]", `k="v"`},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestNavTreeOrder(t *testing.T) {
+	root, err := Parse(`<a xmlns:p="urn:p" x="1"><b y="2"/></a>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := newNavTree(&root)
+	a := doc.children[0]
+	b := a.children[0]
+	namespaces := a.namespaces()
+
+	table := []struct {
+		first, second *navNode
+	}{
+		{doc, a},
+		{a, namespaces[0]},
+		{namespaces[0], namespaces[1]},
+		{namespaces[1], a.attrs[0]},
+		{a.attrs[0], b},
+		{b, b.attrs[0]},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			if !tst.first.before(tst.second) || tst.second.before(tst.first) {
+				t.Errorf("wanted %s before %s", tst.first.path(), tst.second.path())
+			}
+		})
+	}
+}
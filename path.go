@@ -0,0 +1,120 @@
+package xmlparser
+
+import (
+	"maps"
+)
+
+// Path is a compiled XPath 1.0 expression. It holds nothing that changes
+// once compiled, so one Path can be used by many goroutines at once.
+type Path struct {
+	expr       xpathExpr
+	source     string
+	namespaces map[string]string
+}
+
+// CompilePath compiles expr so that it can be evaluated many times. Any
+// syntax error is returned as a *PathError.
+func CompilePath(expr string) (*Path, error) {
+	return CompilePathNS(expr, nil)
+}
+
+// CompilePathNS is CompilePath with prefixes bound to the namespaces
+// given, as for QueryNS.
+func CompilePathNS(expr string, namespaces map[string]string) (*Path, error) {
+	e, err := compileXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Path{expr: e, source: expr, namespaces: maps.Clone(namespaces)}, nil
+}
+
+// String gives the expression the path was compiled from.
+func (p *Path) String() string {
+	return p.source
+}
+
+// Query gives the nodes the path selects in node, as XmlNode.Query does.
+func (p *Path) Query(node XmlNode) ([]XmlNode, error) {
+	v, err := p.eval(node)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.(nodeSet)
+	if !ok {
+		return nil, &PathError{p.source, 0, "the result is not a node-set, use Eval"}
+	}
+	return toXmlNodes(nodes, node), nil
+}
+
+// QueryOne gives the first node the path selects in node and whether
+// there was one.
+func (p *Path) QueryOne(node XmlNode) (XmlNode, bool, error) {
+	nodes, err := p.Query(node)
+	if err != nil || len(nodes) == 0 {
+		return XmlNode{}, false, err
+	}
+	return nodes[0], true, nil
+}
+
+// Eval evaluates the path against node, as XmlNode.Eval does.
+func (p *Path) Eval(node XmlNode) (any, error) {
+	v, err := p.eval(node)
+	if err != nil {
+		return nil, err
+	}
+	if nodes, ok := v.(nodeSet); ok {
+		return toXmlNodes(nodes, node), nil
+	}
+	return v, nil
+}
+
+func (p *Path) eval(node XmlNode) (any, error) {
+	doc := newNavTree(&node)
+	return evalXPath(p.expr, p.source, doc, doc.children[0], p.namespaces, nil)
+}
+
+// QueryDecoder reads the next element from d, with everything inside it,
+// and gives the nodes the path selects in it. Anything before the element
+// is skipped, so a decoder over a run of records can be queried one
+// record at a time. It returns io.EOF once there are no elements left.
+func (p *Path) QueryDecoder(d *Decoder) ([]XmlNode, error) {
+	node, err := d.nextElement()
+	if err != nil {
+		return nil, err
+	}
+	return p.Query(node)
+}
+
+// EvalDecoder reads the next element from d as QueryDecoder does and
+// evaluates the path against it.
+func (p *Path) EvalDecoder(d *Decoder) (any, error) {
+	node, err := d.nextElement()
+	if err != nil {
+		return nil, err
+	}
+	return p.Eval(node)
+}
+
+// nextElement skips to the next start tag in d and builds the element it
+// opens.
+func (d *Decoder) nextElement() (XmlNode, error) {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return XmlNode{}, err
+		}
+		if start, ok := tok.(StartElement); ok {
+			return d.element(start)
+		}
+	}
+}
+
+// element builds the rest of the element that start has just opened.
+func (d *Decoder) element(start StartElement) (XmlNode, error) {
+	node := XmlNode{}
+	err := d.p.buildElement(&node, start)
+	if err != nil {
+		return XmlNode{}, err
+	}
+	return node, nil
+}
@@ -0,0 +1,186 @@
+package xmlparser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompilePath(t *testing.T) {
+	p, err := CompilePath("//item[itunes:duration]/title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("//item[itunes:duration]/title", p.String()); diff != "" {
+		t.Error(diff)
+	}
+
+	table := []struct {
+		input string
+		want  []string
+	}{
+		{feedXML, []string{"<title>One</title>", "<title>Three</title>"}},
+		{`<rss xmlns:itunes="urn:itunes"><item><title>Solo</title><itunes:duration>1</itunes:duration></item></rss>`, []string{"<title>Solo</title>"}},
+		{`<rss><item><title>None</title></item></rss>`, nil},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			root, err := Parse(tst.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Query(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tst.want, printNodes(got)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCompilePathErrors(t *testing.T) {
+	table := []struct {
+		expr string
+		want string
+	}{
+		{"//item[", "xpath '//item[' at 8: unexpected end of expression"},
+		{"nope()", "xpath 'nope()' at 1: unknown function 'nope'"},
+		{"count()", "xpath 'count()' at 1: wrong number of arguments to count()"},
+		{"child:::a", "xpath 'child:::a' at 8: unexpected ':'"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := CompilePath(tst.expr)
+			if err == nil {
+				t.Fatal("wanted an error but got none")
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCompilePathNS(t *testing.T) {
+	namespaces := map[string]string{"it": "urn:itunes"}
+	p, err := CompilePathNS("sum(//it:duration)", namespaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	namespaces["it"] = "urn:other"
+
+	root, err := Parse(feedXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.Eval(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(any(90.0), got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestPathConcurrent(t *testing.T) {
+	p, err := CompilePath("concat(count(//item), ':', //item[last()]/title)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var docs []XmlNode
+	for i := 1; i <= 8; i++ {
+		var sb strings.Builder
+		for j := 1; j <= i; j++ {
+			fmt.Fprintf(&sb, "<item><title>%d</title></item>", j)
+		}
+		root, err := Parse("<rss>" + sb.String() + "</rss>")
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, root)
+	}
+
+	var wg sync.WaitGroup
+	got := make([]any, len(docs))
+	errs := make([]error, len(docs))
+	for i, root := range docs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i], errs[i] = p.Eval(root)
+		}()
+	}
+	wg.Wait()
+
+	for i := range docs {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		want := fmt.Sprintf("%d:%d", i+1, i+1)
+		if diff := cmp.Diff(any(want), got[i]); diff != "" {
+			t.Error(diff)
+		}
+	}
+}
+
+func TestQueryDecoder(t *testing.T) {
+	p, err := CompilePath("/item/enclosure/@url")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := `<?xml version="1.0"?>
+<item><enclosure url="a.mp3"/></item>
+<item><title>No enclosure</title></item>
+<item><enclosure url="c.mp3"/></item>`
+	d := NewDecoder(strings.NewReader(input))
+
+	var got [][]string
+	for {
+		nodes, err := p.QueryDecoder(d)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, printNodes(nodes))
+	}
+	want := [][]string{{`url="a.mp3"`}, nil, {`url="c.mp3"`}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestEvalDecoder(t *testing.T) {
+	p, err := CompilePath("count(item)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(strings.NewReader(`<channel><item/><item/></channel>`))
+	got, err := p.EvalDecoder(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(any(2.0), got); diff != "" {
+		t.Error(diff)
+	}
+	if _, err := p.EvalDecoder(d); err != io.EOF {
+		t.Errorf("wanted io.EOF but got %v", err)
+	}
+
+	d = NewDecoder(strings.NewReader(`<channel><item/>`))
+	_, err = p.EvalDecoder(d)
+	want := "1:17: at end of input but 'channel' is still open (in /channel)"
+	if err == nil || err.Error() != want {
+		t.Errorf("wanted %s but got %v", want, err)
+	}
+}
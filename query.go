@@ -0,0 +1,94 @@
+package xmlparser
+
+// Query gives the nodes selected by the XPath 1.0 expression expr, with
+// node as the context node and as the root of the document. Prefixes in
+// expr mean whatever the document first declares them to mean.
+//
+// Attributes come back as AttributeNode, and a run of text and CDATA as
+// one node. The document node, selected by "/", comes back as node.
+func (node XmlNode) Query(expr string) ([]XmlNode, error) {
+	return node.QueryNS(expr, nil)
+}
+
+// QueryNS is Query with prefixes bound to the namespaces given, which take
+// precedence over those declared in the document.
+func (node XmlNode) QueryNS(expr string, namespaces map[string]string) ([]XmlNode, error) {
+	p, err := CompilePathNS(expr, namespaces)
+	if err != nil {
+		return nil, err
+	}
+	return p.Query(node)
+}
+
+// QueryOne gives the first node selected by expr, in document order, and
+// whether there was one.
+func (node XmlNode) QueryOne(expr string) (XmlNode, bool, error) {
+	return node.QueryOneNS(expr, nil)
+}
+
+// QueryOneNS is QueryOne with prefixes bound as for QueryNS.
+func (node XmlNode) QueryOneNS(expr string, namespaces map[string]string) (XmlNode, bool, error) {
+	nodes, err := node.QueryNS(expr, namespaces)
+	if err != nil || len(nodes) == 0 {
+		return XmlNode{}, false, err
+	}
+	return nodes[0], true, nil
+}
+
+// Eval evaluates the XPath 1.0 expression expr as Query does. The result
+// is a []XmlNode, string, float64 or bool depending on the expression.
+func (node XmlNode) Eval(expr string) (any, error) {
+	return node.EvalNS(expr, nil)
+}
+
+// EvalNS is Eval with prefixes bound as for QueryNS.
+func (node XmlNode) EvalNS(expr string, namespaces map[string]string) (any, error) {
+	p, err := CompilePathNS(expr, namespaces)
+	if err != nil {
+		return nil, err
+	}
+	return p.Eval(node)
+}
+
+func toXmlNodes(nodes nodeSet, root XmlNode) []XmlNode {
+	out := make([]XmlNode, 0, len(nodes))
+	for _, n := range nodes {
+		out = append(out, n.xmlNode(root))
+	}
+	return out
+}
+
+// xmlNode gives n as an XmlNode, taking root for the document node.
+func (n *navNode) xmlNode(root XmlNode) XmlNode {
+	switch n.kind {
+	case rootNav:
+		return root
+	case attributeNav:
+		return attributeNode(*n.attr)
+	case namespaceNav:
+		name := "xmlns"
+		if n.attr.Key != "" {
+			name += ":" + n.attr.Key
+		}
+		return XmlNode{Type: AttributeNode, Name: name, Namespace: XMLNSNamespace, Contents: n.attr.Value}
+	case textNav:
+		if n.node.Type == ElementNode {
+			// The text an element keeps in Contents has no span of its own
+			if n.node.CData {
+				return XmlNode{Type: CDataNode, Contents: n.text}
+			}
+			return XmlNode{Type: TextNode, Contents: n.text}
+		}
+		text := *n.node
+		if text.Contents != n.text {
+			text.Type = TextNode
+			text.Contents = n.text
+		}
+		return text
+	}
+	return *n.node
+}
+
+func attributeNode(a Attribute) XmlNode {
+	return XmlNode{Type: AttributeNode, Name: a.Key, Namespace: a.Namespace, Contents: a.Value, Span: a.Span}
+}
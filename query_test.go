@@ -0,0 +1,198 @@
+package xmlparser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/danwhitford/xmlparser/tokeniser"
+	"github.com/google/go-cmp/cmp"
+)
+
+func printNodes(nodes []XmlNode) []string {
+	var out []string
+	for _, node := range nodes {
+		var sb strings.Builder
+		node.printInline(&sb)
+		out = append(out, sb.String())
+	}
+	return out
+}
+
+func TestQuery(t *testing.T) {
+	root, err := Parse(feedXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		expr string
+		want []string
+	}{
+		{"/rss/channel/item[itunes:duration]/title", []string{"<title>One</title>", "<title>Three</title>"}},
+		{"channel/item[2]/desc", []string{"<desc>Hi <b>bold</b> there</desc>"}},
+		{"//desc/text()", []string{"Hi ", " there"}},
+		{"//item[1]/title/text()", []string{"One"}},
+		{"//item/@id", []string{`id="a"`, `id="b"`}},
+		{"//item[2]/comment()", []string{"<!--hidden-->"}},
+		{"/rss/namespace::itunes", []string{`xmlns:itunes="urn:itunes"`}},
+		{"/", []string{strings.Join(printNodes([]XmlNode{root}), "")}},
+		{"//nothing", nil},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			got, err := root.Query(tst.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tst.want, printNodes(got)); diff != "" {
+				t.Errorf("%s: %s", tst.expr, diff)
+			}
+		})
+	}
+}
+
+func TestQueryAttributeNode(t *testing.T) {
+	root, err := Parse(`<a xmlns:x="urn:x" x:b="1"/>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := root.QueryOne("@x:b")
+	if err != nil || !ok {
+		t.Fatalf("wanted a node but got %v, %v", ok, err)
+	}
+	want := XmlNode{
+		Type:      AttributeNode,
+		Name:      "x:b",
+		Namespace: "urn:x",
+		Contents:  "1",
+		Span: Span{
+			tokeniser.Position{Offset: 19, Line: 1, Col: 20},
+			tokeniser.Position{Offset: 26, Line: 1, Col: 27},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestQueryOne(t *testing.T) {
+	root, err := Parse(feedXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := root.QueryOne("//item[itunes:duration > 40]/title")
+	if err != nil || !ok {
+		t.Fatalf("wanted a node but got %v, %v", ok, err)
+	}
+	if diff := cmp.Diff([]string{"<title>One</title>"}, printNodes([]XmlNode{got})); diff != "" {
+		t.Error(diff)
+	}
+
+	_, ok, err = root.QueryOne("//item[99]")
+	if err != nil || ok {
+		t.Errorf("wanted no node but got %v, %v", ok, err)
+	}
+}
+
+func TestQueryNS(t *testing.T) {
+	root, err := Parse(feedXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	namespaces := map[string]string{"it": "urn:itunes"}
+
+	got, err := root.QueryNS("//it:duration", namespaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"<itunes:duration>60</itunes:duration>", "<itunes:duration>30</itunes:duration>"}
+	if diff := cmp.Diff(want, printNodes(got)); diff != "" {
+		t.Error(diff)
+	}
+
+	n, err := root.EvalNS("sum(//it:duration)", namespaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(any(90.0), n); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestEval(t *testing.T) {
+	root, err := Parse(feedXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		expr string
+		want any
+	}{
+		{"string(channel/title)", "Feed"},
+		{"count(//item)", 3.0},
+		{"//item[3]/itunes:duration < 40", true},
+		{"concat(//item[@id='b']/title, '!')", "Two!"},
+		{"boolean(//enclosure)", false},
+		{"//item[last()]/title", []string{"<title>Three</title>"}},
+		{"count(channel/text())", 5.0},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			got, err := root.Eval(tst.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nodes, ok := got.([]XmlNode); ok {
+				got = printNodes(nodes)
+			}
+			if diff := cmp.Diff(tst.want, got); diff != "" {
+				t.Errorf("%s: %s", tst.expr, diff)
+			}
+		})
+	}
+
+	p, err := Parse("<p><b>Hello</b> <i>world</i></p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.Eval("string()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(any("Hello world"), got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	root, err := Parse(feedXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		expr string
+		want string
+	}{
+		{"count(//item)", "xpath 'count(//item)' at 1: the result is not a node-set, use Eval"},
+		{"//item[", "xpath '//item[' at 8: unexpected end of expression"},
+		{"//item[$x]", "xpath '//item[$x]' at 8: variable '$x' is not set"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := root.Query(tst.expr)
+			if err == nil {
+				t.Fatal("wanted an error but got none")
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
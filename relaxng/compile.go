@@ -0,0 +1,603 @@
+package relaxng
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/danwhitford/xmlparser"
+	"github.com/danwhitford/xmlparser/tokeniser"
+	"github.com/danwhitford/xmlparser/xsd"
+)
+
+const (
+	Namespace  = "http://relaxng.org/ns/structure/1.0"
+	xsdLibrary = "http://www.w3.org/2001/XMLSchema-datatypes"
+)
+
+// Schema is a compiled RELAX NG schema, ready to validate documents
+// against.
+type Schema struct {
+	start *pattern
+	b     *builder
+}
+
+// Error reports a problem with a schema or a document it validates.
+// Path locates the element it is about, such as /order/item[2]/price.
+type Error struct {
+	Path string
+	Pos  tokeniser.Position
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %s: %s", e.Pos, e.Path, e.Msg)
+}
+
+func schemaError(node xmlparser.XmlNode, format string, args ...any) *Error {
+	return &Error{
+		Path: node.Local(),
+		Pos:  node.Span.Start,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Parse compiles the schema in input, written in the XML syntax.
+func Parse(input string) (*Schema, error) {
+	root, err := xmlparser.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(root)
+}
+
+// Compile builds a schema from its root pattern, which is usually a
+// grammar element. Include and externalRef are not supported.
+func Compile(root xmlparser.XmlNode) (*Schema, error) {
+	c := &compiler{b: newBuilder()}
+	start, err := c.pattern(root, context{library: ""})
+	if err != nil {
+		return nil, err
+	}
+	for len(c.pending) > 0 {
+		next := c.pending[0]
+		c.pending = c.pending[1:]
+		next.element.content, err = c.group(next.content, next.ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Schema{start: start, b: c.b}, nil
+}
+
+type compiler struct {
+	b *builder
+
+	// pending holds elements whose content has still to be compiled.
+	// Leaving it until later lets a grammar refer back to an element from
+	// inside it.
+	pending []pendingElement
+}
+
+type pendingElement struct {
+	element *element
+	content []xmlparser.XmlNode
+	ctx     context
+}
+
+// context is what a pattern inherits from the elements around it.
+type context struct {
+	ns      string
+	library string
+	scope   map[string]string
+	grammar *grammar
+}
+
+// enter adds the ns, datatypeLibrary and namespace declarations on node
+// to the context.
+func (ctx context) enter(node xmlparser.XmlNode) context {
+	copied := false
+	for _, a := range node.Attributes {
+		switch {
+		case a.Namespace == xmlparser.XMLNSNamespace:
+			if !copied {
+				ctx.scope = maps.Clone(ctx.scope)
+				if ctx.scope == nil {
+					ctx.scope = map[string]string{}
+				}
+				copied = true
+			}
+			prefix := ""
+			if a.Key != "xmlns" {
+				prefix = a.Local()
+			}
+			ctx.scope[prefix] = a.Value
+		case a.Key == "ns":
+			ctx.ns = a.Value
+		case a.Key == "datatypeLibrary":
+			ctx.library = a.Value
+		}
+	}
+	return ctx
+}
+
+type grammar struct {
+	parent  *grammar
+	start   *define
+	defines map[string]*define
+}
+
+// define gathers every definition of one name, which are combined into
+// a single pattern the first time it is referred to.
+type define struct {
+	name       string
+	nodes      []xmlparser.XmlNode
+	ctxs       []context
+	combine    string
+	pattern    *pattern
+	compiling  bool
+	uncombined bool
+}
+
+// children gives the RELAX NG elements inside node, skipping text and
+// elements from other namespaces, which are annotations.
+func children(node xmlparser.XmlNode) []xmlparser.XmlNode {
+	var out []xmlparser.XmlNode
+	for _, child := range node.Children {
+		if child.Type == xmlparser.ElementNode && child.Namespace == Namespace {
+			out = append(out, child)
+		}
+	}
+	return out
+}
+
+func (c *compiler) pattern(node xmlparser.XmlNode, ctx context) (*pattern, error) {
+	if node.Type != xmlparser.ElementNode || node.Namespace != Namespace {
+		return nil, schemaError(node, "expected a RELAX NG pattern but got '%s'", node.Name)
+	}
+	ctx = ctx.enter(node)
+	kids := children(node)
+
+	switch node.Local() {
+	case "element":
+		return c.element(node, kids, ctx)
+	case "attribute":
+		return c.attribute(node, kids, ctx)
+	case "group":
+		return c.group(kids, ctx)
+	case "interleave", "choice":
+		if len(kids) == 0 {
+			return nil, schemaError(node, "%s must hold at least one pattern", node.Local())
+		}
+		return c.combine(node.Local(), kids, ctx)
+	case "optional":
+		p, err := c.group(kids, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.b.choice(p, empty), nil
+	case "zeroOrMore":
+		p, err := c.group(kids, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.b.choice(c.b.oneOrMore(p), empty), nil
+	case "oneOrMore":
+		p, err := c.group(kids, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.b.oneOrMore(p), nil
+	case "mixed":
+		p, err := c.group(kids, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.b.interleave(p, text), nil
+	case "list":
+		p, err := c.group(kids, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.b.intern(pattern{kind: listPattern, p1: p}), nil
+	case "empty":
+		return empty, nil
+	case "text":
+		return text, nil
+	case "notAllowed":
+		return notAllowed, nil
+	case "data":
+		return c.data(node, kids, ctx)
+	case "value":
+		return c.value(node, ctx)
+	case "ref", "parentRef":
+		return c.ref(node, ctx)
+	case "grammar":
+		return c.grammar(node, ctx)
+	case "externalRef", "include":
+		return nil, schemaError(node, "%s is not supported", node.Local())
+	}
+	return nil, schemaError(node, "unexpected '%s'", node.Name)
+}
+
+// group compiles each of kids and puts them in sequence.
+func (c *compiler) group(kids []xmlparser.XmlNode, ctx context) (*pattern, error) {
+	p := empty
+	for _, kid := range kids {
+		q, err := c.pattern(kid, ctx)
+		if err != nil {
+			return nil, err
+		}
+		p = c.b.group(p, q)
+	}
+	return p, nil
+}
+
+func (c *compiler) combine(how string, kids []xmlparser.XmlNode, ctx context) (*pattern, error) {
+	var p *pattern
+	for _, kid := range kids {
+		q, err := c.pattern(kid, ctx)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case p == nil:
+			p = q
+		case how == "choice":
+			p = c.b.choice(p, q)
+		default:
+			p = c.b.interleave(p, q)
+		}
+	}
+	return p, nil
+}
+
+func (c *compiler) element(node xmlparser.XmlNode, kids []xmlparser.XmlNode, ctx context) (*pattern, error) {
+	nc, kids, err := c.nameOf(node, kids, ctx, ctx.ns)
+	if err != nil {
+		return nil, err
+	}
+	if len(kids) == 0 {
+		return nil, schemaError(node, "element must hold a pattern")
+	}
+	e := &element{}
+	c.pending = append(c.pending, pendingElement{e, kids, ctx})
+	return &pattern{kind: elementPattern, nc: nc, element: e}, nil
+}
+
+func (c *compiler) attribute(node xmlparser.XmlNode, kids []xmlparser.XmlNode, ctx context) (*pattern, error) {
+	// Unlike elements, attributes named by a name attribute are in no
+	// namespace unless they say otherwise.
+	space, _ := node.AttrNS("", "ns")
+	nc, kids, err := c.nameOf(node, kids, ctx, space)
+	if err != nil {
+		return nil, err
+	}
+	content := text
+	if len(kids) > 0 {
+		content, err = c.group(kids, ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.b.intern(pattern{kind: attributePattern, nc: nc, p1: content}), nil
+}
+
+// nameOf gives the name class of an element or attribute, from either its
+// name attribute or its first child, along with the patterns left over.
+func (c *compiler) nameOf(node xmlparser.XmlNode, kids []xmlparser.XmlNode, ctx context, space string) (*nameClass, []xmlparser.XmlNode, error) {
+	if name, ok := node.AttrNS("", "name"); ok {
+		nc, err := c.qname(node, ctx, strings.TrimSpace(name), space)
+		return nc, kids, err
+	}
+	if len(kids) == 0 {
+		return nil, nil, schemaError(node, "%s must have a name", node.Local())
+	}
+	nc, err := c.nameClass(kids[0], ctx)
+	return nc, kids[1:], err
+}
+
+func (c *compiler) qname(node xmlparser.XmlNode, ctx context, name, space string) (*nameClass, error) {
+	if prefix, local, found := strings.Cut(name, ":"); found {
+		resolved, ok := ctx.scope[prefix]
+		if !ok {
+			return nil, schemaError(node, "namespace prefix '%s' has not been declared", prefix)
+		}
+		return &nameClass{kind: nameName, space: resolved, local: local}, nil
+	}
+	return &nameClass{kind: nameName, space: space, local: name}, nil
+}
+
+func (c *compiler) nameClass(node xmlparser.XmlNode, ctx context) (*nameClass, error) {
+	ctx = ctx.enter(node)
+	kids := children(node)
+	switch node.Local() {
+	case "name":
+		return c.qname(node, ctx, strings.TrimSpace(node.Contents), ctx.ns)
+	case "anyName", "nsName":
+		nc := &nameClass{kind: anyName}
+		exceptKind := anyNameExcept
+		if node.Local() == "nsName" {
+			nc = &nameClass{kind: nsName, space: ctx.ns}
+			exceptKind = nsNameExcept
+		}
+		if len(kids) == 0 {
+			return nc, nil
+		}
+		if len(kids) > 1 || kids[0].Local() != "except" {
+			return nil, schemaError(node, "%s can only hold an except", node.Local())
+		}
+		except, err := c.nameChoice(kids[0], children(kids[0]), ctx.enter(kids[0]))
+		if err != nil {
+			return nil, err
+		}
+		nc.kind = exceptKind
+		nc.c1 = except
+		return nc, nil
+	case "choice":
+		return c.nameChoice(node, kids, ctx)
+	}
+	return nil, schemaError(node, "expected a name class but got '%s'", node.Name)
+}
+
+func (c *compiler) nameChoice(node xmlparser.XmlNode, kids []xmlparser.XmlNode, ctx context) (*nameClass, error) {
+	if len(kids) == 0 {
+		return nil, schemaError(node, "%s must hold at least one name class", node.Local())
+	}
+	var nc *nameClass
+	for _, kid := range kids {
+		next, err := c.nameClass(kid, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if nc == nil {
+			nc = next
+		} else {
+			nc = &nameClass{kind: nameChoice, c1: nc, c2: next}
+		}
+	}
+	return nc, nil
+}
+
+func (c *compiler) datatype(node xmlparser.XmlNode, ctx context, name string, params []xsd.Facet) (datatype, error) {
+	switch ctx.library {
+	case "":
+		if len(params) > 0 {
+			return nil, schemaError(node, "the built in datatypes have no parameters")
+		}
+		switch name {
+		case "string":
+			return stringType, nil
+		case "token":
+			return tokenType, nil
+		}
+		return nil, schemaError(node, "unknown datatype '%s'", name)
+	case xsdLibrary:
+		dt, err := xsd.NewDatatype(name, params)
+		if err != nil {
+			return nil, schemaError(node, "%v", err)
+		}
+		return xsdType{dt}, nil
+	}
+	return nil, schemaError(node, "unknown datatype library '%s'", ctx.library)
+}
+
+func (c *compiler) data(node xmlparser.XmlNode, kids []xmlparser.XmlNode, ctx context) (*pattern, error) {
+	var params []xsd.Facet
+	var except *xmlparser.XmlNode
+	for i, kid := range kids {
+		switch {
+		case kid.Local() == "param" && except == nil:
+			name, _ := kid.AttrNS("", "name")
+			params = append(params, xsd.Facet{Name: name, Value: kid.Contents})
+		case kid.Local() == "except" && i == len(kids)-1:
+			except = &kids[i]
+		default:
+			return nil, schemaError(kid, "unexpected '%s' in data", kid.Name)
+		}
+	}
+	name, _ := node.AttrNS("", "type")
+	dt, err := c.datatype(node, ctx, strings.TrimSpace(name), params)
+	if err != nil {
+		return nil, err
+	}
+	if except == nil {
+		return c.b.intern(pattern{kind: dataPattern, dt: dt}), nil
+	}
+	p, err := c.combine("choice", children(*except), ctx.enter(*except))
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, schemaError(*except, "except must hold at least one pattern")
+	}
+	return c.b.intern(pattern{kind: dataExceptPattern, dt: dt, p1: p}), nil
+}
+
+func (c *compiler) value(node xmlparser.XmlNode, ctx context) (*pattern, error) {
+	name, ok := node.AttrNS("", "type")
+	if !ok {
+		ctx.library, name = "", "token"
+	}
+	dt, err := c.datatype(node, ctx, strings.TrimSpace(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := dt.allows(node.Contents); err != nil {
+		return nil, schemaError(node, "bad value: %v", err)
+	}
+	return c.b.intern(pattern{kind: valuePattern, dt: dt, value: node.Contents}), nil
+}
+
+func (c *compiler) ref(node xmlparser.XmlNode, ctx context) (*pattern, error) {
+	g := ctx.grammar
+	if node.Local() == "parentRef" && g != nil {
+		g = g.parent
+	}
+	if g == nil {
+		return nil, schemaError(node, "%s is outside any grammar", node.Local())
+	}
+	name, _ := node.AttrNS("", "name")
+	name = strings.TrimSpace(name)
+	d, ok := g.defines[name]
+	if !ok {
+		return nil, schemaError(node, "'%s' is not defined", name)
+	}
+	return c.resolve(d, node)
+}
+
+// resolve compiles the definitions of d, the first time it is needed.
+func (c *compiler) resolve(d *define, from xmlparser.XmlNode) (*pattern, error) {
+	if d.pattern != nil {
+		return d.pattern, nil
+	}
+	if d.compiling {
+		return nil, schemaError(from, "'%s' refers to itself without an element in between", d.name)
+	}
+	d.compiling = true
+	var p *pattern
+	for i, node := range d.nodes {
+		q, err := c.group(children(node), d.ctxs[i])
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case p == nil:
+			p = q
+		case d.combine == "choice":
+			p = c.b.choice(p, q)
+		default:
+			p = c.b.interleave(p, q)
+		}
+	}
+	d.pattern = p
+	d.compiling = false
+	return p, nil
+}
+
+func (c *compiler) grammar(node xmlparser.XmlNode, ctx context) (*pattern, error) {
+	g := &grammar{parent: ctx.grammar, defines: map[string]*define{}}
+	ctx.grammar = g
+	err := c.collect(g, node, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if g.start == nil {
+		return nil, schemaError(node, "grammar has no start")
+	}
+	for _, d := range g.defines {
+		if _, err := c.resolve(d, d.nodes[0]); err != nil {
+			return nil, err
+		}
+	}
+	return c.resolve(g.start, node)
+}
+
+// collect gathers the start and define elements in a grammar, looking
+// inside any divs.
+func (c *compiler) collect(g *grammar, node xmlparser.XmlNode, ctx context) error {
+	for _, kid := range children(node) {
+		kidCtx := ctx.enter(kid)
+		switch kid.Local() {
+		case "start":
+			if g.start == nil {
+				g.start = &define{name: "start"}
+			}
+			if err := c.addDefinition(g.start, kid, kidCtx); err != nil {
+				return err
+			}
+		case "define":
+			name, _ := kid.AttrNS("", "name")
+			name = strings.TrimSpace(name)
+			d, ok := g.defines[name]
+			if !ok {
+				d = &define{name: name}
+				g.defines[name] = d
+			}
+			if err := c.addDefinition(d, kid, kidCtx); err != nil {
+				return err
+			}
+		case "div":
+			if err := c.collect(g, kid, kidCtx); err != nil {
+				return err
+			}
+		case "include":
+			return schemaError(kid, "include is not supported")
+		default:
+			return schemaError(kid, "unexpected '%s' in grammar", kid.Name)
+		}
+	}
+	return nil
+}
+
+func (c *compiler) addDefinition(d *define, node xmlparser.XmlNode, ctx context) error {
+	if len(children(node)) == 0 {
+		return schemaError(node, "%s must hold a pattern", node.Local())
+	}
+	combine, ok := node.AttrNS("", "combine")
+	switch {
+	case !ok && d.uncombined:
+		return schemaError(node, "'%s' is defined more than once without a combine attribute", d.name)
+	case !ok:
+		d.uncombined = true
+	case combine != "choice" && combine != "interleave":
+		return schemaError(node, "bad combine '%s'", combine)
+	case d.combine != "" && d.combine != combine:
+		return schemaError(node, "'%s' is combined by both choice and interleave", d.name)
+	default:
+		d.combine = combine
+	}
+	d.nodes = append(d.nodes, node)
+	d.ctxs = append(d.ctxs, ctx)
+	return nil
+}
+
+// datatype checks text for data and value patterns.
+type datatype interface {
+	name() string
+	allows(s string) error
+	equal(a, b string) bool
+}
+
+// builtinType is one of the two datatypes every RELAX NG schema has,
+// which accept any string but differ in how they compare.
+type builtinType struct {
+	typeName string
+	collapse bool
+}
+
+var (
+	stringType = &builtinType{"string", false}
+	tokenType  = &builtinType{"token", true}
+)
+
+func (t *builtinType) name() string {
+	return t.typeName
+}
+
+func (t *builtinType) allows(s string) error {
+	return nil
+}
+
+func (t *builtinType) equal(a, b string) bool {
+	if t.collapse {
+		return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+	}
+	return a == b
+}
+
+type xsdType struct {
+	dt *xsd.Datatype
+}
+
+func (t xsdType) name() string {
+	return t.dt.Name()
+}
+
+func (t xsdType) allows(s string) error {
+	return t.dt.Validate(s)
+}
+
+func (t xsdType) equal(a, b string) bool {
+	return t.dt.Validate(a) == nil && t.dt.Validate(b) == nil && t.dt.Equal(a, b)
+}
@@ -0,0 +1,108 @@
+package relaxng
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompileErrors(t *testing.T) {
+	table := []struct {
+		input string
+		want  string
+	}{
+		{
+			`<grammar/>`,
+			"1:1: grammar: expected a RELAX NG pattern but got 'grammar'",
+		},
+		{
+			`<grammar xmlns="http://relaxng.org/ns/structure/1.0"><define name="a"><empty/></define></grammar>`,
+			"1:1: grammar: grammar has no start",
+		},
+		{
+			`<grammar xmlns="http://relaxng.org/ns/structure/1.0"><start><ref name="a"/></start></grammar>`,
+			"1:61: ref: 'a' is not defined",
+		},
+		{
+			`<grammar xmlns="http://relaxng.org/ns/structure/1.0">
+				<start><ref name="a"/></start>
+				<define name="a"><optional><ref name="a"/></optional></define>
+			</grammar>`,
+			"3:32: ref: 'a' refers to itself without an element in between",
+		},
+		{
+			`<grammar xmlns="http://relaxng.org/ns/structure/1.0">
+				<start><ref name="a"/></start>
+				<define name="a"><empty/></define>
+				<define name="a"><text/></define>
+			</grammar>`,
+			"4:5: define: 'a' is defined more than once without a combine attribute",
+		},
+		{
+			`<grammar xmlns="http://relaxng.org/ns/structure/1.0">
+				<start combine="choice"><empty/></start>
+				<start combine="interleave"><text/></start>
+			</grammar>`,
+			"3:5: start: 'start' is combined by both choice and interleave",
+		},
+		{
+			`<element xmlns="http://relaxng.org/ns/structure/1.0" name="a"><ref name="b"/></element>`,
+			"1:63: ref: ref is outside any grammar",
+		},
+		{
+			`<element xmlns="http://relaxng.org/ns/structure/1.0" name="a"><externalRef href="b.rng"/></element>`,
+			"1:63: externalRef: externalRef is not supported",
+		},
+		{
+			`<element xmlns="http://relaxng.org/ns/structure/1.0" name="q:a"><empty/></element>`,
+			"1:1: element: namespace prefix 'q' has not been declared",
+		},
+		{
+			`<element xmlns="http://relaxng.org/ns/structure/1.0" name="a"><data type="integer"/></element>`,
+			"1:63: data: unknown datatype 'integer'",
+		},
+		{
+			`<element xmlns="http://relaxng.org/ns/structure/1.0" name="a"
+				datatypeLibrary="http://www.w3.org/2001/XMLSchema-datatypes">
+				<data type="int"><param name="maxLength">lots</param></data>
+			</element>`,
+			"3:5: data: bad maxLength facet 'lots': strconv.Atoi: parsing \"lots\": invalid syntax",
+		},
+		{
+			`<element xmlns="http://relaxng.org/ns/structure/1.0" name="a" datatypeLibrary="urn:mine"><data type="x"/></element>`,
+			"1:90: data: unknown datatype library 'urn:mine'",
+		},
+		{
+			`<element xmlns="http://relaxng.org/ns/structure/1.0" name="a"
+				datatypeLibrary="http://www.w3.org/2001/XMLSchema-datatypes">
+				<value type="int">one</value>
+			</element>`,
+			"3:5: value: bad value: 'one' is not a valid xs:int: it is not a decimal number",
+		},
+		{
+			`<element xmlns="http://relaxng.org/ns/structure/1.0"><anyName/></element>`,
+			"1:1: element: element must hold a pattern",
+		},
+		{
+			`<element xmlns="http://relaxng.org/ns/structure/1.0" name="a"><choice/></element>`,
+			"1:63: choice: choice must hold at least one pattern",
+		},
+		{
+			`<element xmlns="http://relaxng.org/ns/structure/1.0" name="a"><sequence/></element>`,
+			"1:63: sequence: unexpected 'sequence'",
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := Parse(tst.input)
+			if err == nil {
+				t.Fatal("wanted an error but got none")
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
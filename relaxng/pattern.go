@@ -0,0 +1,431 @@
+package relaxng
+
+import (
+	"strings"
+)
+
+type kind int
+
+const (
+	emptyPattern kind = iota
+	notAllowedPattern
+	textPattern
+	choicePattern
+	interleavePattern
+	groupPattern
+	oneOrMorePattern
+	listPattern
+	dataPattern
+	dataExceptPattern
+	valuePattern
+	attributePattern
+	elementPattern
+	afterPattern
+)
+
+// pattern is a node in a compiled schema, following James Clark's
+// derivative algorithm for RELAX NG validation. Element patterns keep
+// their content in an element so that recursive grammars can refer back
+// to them.
+type pattern struct {
+	kind    kind
+	p1, p2  *pattern
+	nc      *nameClass
+	dt      datatype
+	value   string
+	element *element
+}
+
+type element struct {
+	content *pattern
+}
+
+var (
+	empty      = &pattern{kind: emptyPattern}
+	notAllowed = &pattern{kind: notAllowedPattern}
+	text       = &pattern{kind: textPattern}
+)
+
+// builder makes patterns, sharing identical ones so that choices between
+// them can be dropped. A builder made by derive only reads its parent, so
+// a compiled schema can be shared.
+type builder struct {
+	parent   *builder
+	interned map[pattern]*pattern
+}
+
+func newBuilder() *builder {
+	return &builder{interned: map[pattern]*pattern{}}
+}
+
+func (b *builder) derive() *builder {
+	return &builder{parent: b, interned: map[pattern]*pattern{}}
+}
+
+func (b *builder) intern(p pattern) *pattern {
+	for at := b; at != nil; at = at.parent {
+		if shared, ok := at.interned[p]; ok {
+			return shared
+		}
+	}
+	b.interned[p] = &p
+	return &p
+}
+
+func (b *builder) choice(p1, p2 *pattern) *pattern {
+	switch {
+	case p1 == notAllowed:
+		return p2
+	case p2 == notAllowed, p1 == p2:
+		return p1
+	}
+	return b.intern(pattern{kind: choicePattern, p1: p1, p2: p2})
+}
+
+func (b *builder) group(p1, p2 *pattern) *pattern {
+	switch {
+	case p1 == notAllowed || p2 == notAllowed:
+		return notAllowed
+	case p1 == empty:
+		return p2
+	case p2 == empty:
+		return p1
+	}
+	return b.intern(pattern{kind: groupPattern, p1: p1, p2: p2})
+}
+
+func (b *builder) interleave(p1, p2 *pattern) *pattern {
+	switch {
+	case p1 == notAllowed || p2 == notAllowed:
+		return notAllowed
+	case p1 == empty:
+		return p2
+	case p2 == empty:
+		return p1
+	}
+	return b.intern(pattern{kind: interleavePattern, p1: p1, p2: p2})
+}
+
+func (b *builder) after(p1, p2 *pattern) *pattern {
+	if p1 == notAllowed || p2 == notAllowed {
+		return notAllowed
+	}
+	return b.intern(pattern{kind: afterPattern, p1: p1, p2: p2})
+}
+
+func (b *builder) oneOrMore(p *pattern) *pattern {
+	if p == notAllowed || p == empty {
+		return p
+	}
+	return b.intern(pattern{kind: oneOrMorePattern, p1: p})
+}
+
+func nullable(p *pattern) bool {
+	switch p.kind {
+	case emptyPattern, textPattern:
+		return true
+	case groupPattern, interleavePattern:
+		return nullable(p.p1) && nullable(p.p2)
+	case choicePattern:
+		return nullable(p.p1) || nullable(p.p2)
+	case oneOrMorePattern:
+		return nullable(p.p1)
+	}
+	return false
+}
+
+func isWhitespace(s string) bool {
+	return strings.Trim(s, " \t\r\n") == ""
+}
+
+func (b *builder) textDeriv(p *pattern, s string) *pattern {
+	return b.deriveText(p, s, false)
+}
+
+// skipText matches s against p as if it were a valid value for whatever
+// data p expects, so that validation can carry on after bad text.
+func (b *builder) skipText(p *pattern, s string) *pattern {
+	return b.deriveText(p, s, true)
+}
+
+func (b *builder) deriveText(p *pattern, s string, lenient bool) *pattern {
+	switch p.kind {
+	case choicePattern:
+		return b.choice(b.deriveText(p.p1, s, lenient), b.deriveText(p.p2, s, lenient))
+	case interleavePattern:
+		return b.choice(
+			b.interleave(b.deriveText(p.p1, s, lenient), p.p2),
+			b.interleave(p.p1, b.deriveText(p.p2, s, lenient)),
+		)
+	case groupPattern:
+		d := b.group(b.deriveText(p.p1, s, lenient), p.p2)
+		if nullable(p.p1) {
+			return b.choice(d, b.deriveText(p.p2, s, lenient))
+		}
+		return d
+	case afterPattern:
+		return b.after(b.deriveText(p.p1, s, lenient), p.p2)
+	case oneOrMorePattern:
+		return b.group(b.deriveText(p.p1, s, lenient), b.choice(p, empty))
+	case textPattern:
+		return p
+	case valuePattern:
+		if lenient || p.dt.equal(p.value, s) {
+			return empty
+		}
+	case dataPattern:
+		if lenient || p.dt.allows(s) == nil {
+			return empty
+		}
+	case dataExceptPattern:
+		if lenient || p.dt.allows(s) == nil && !nullable(b.textDeriv(p.p1, s)) {
+			return empty
+		}
+	case listPattern:
+		d := p.p1
+		for _, word := range strings.Fields(s) {
+			d = b.textDeriv(d, word)
+		}
+		if lenient || nullable(d) {
+			return empty
+		}
+	}
+	return notAllowed
+}
+
+// applyAfter applies f to the pattern following each element that has
+// been started in p.
+func (b *builder) applyAfter(p *pattern, f func(*pattern) *pattern) *pattern {
+	switch p.kind {
+	case afterPattern:
+		return b.after(p.p1, f(p.p2))
+	case choicePattern:
+		return b.choice(b.applyAfter(p.p1, f), b.applyAfter(p.p2, f))
+	}
+	return notAllowed
+}
+
+func (b *builder) startTagOpenDeriv(p *pattern, space, local string) *pattern {
+	switch p.kind {
+	case choicePattern:
+		return b.choice(b.startTagOpenDeriv(p.p1, space, local), b.startTagOpenDeriv(p.p2, space, local))
+	case elementPattern:
+		if p.nc.contains(space, local) {
+			return b.after(p.element.content, empty)
+		}
+	case interleavePattern:
+		return b.choice(
+			b.applyAfter(b.startTagOpenDeriv(p.p1, space, local), func(q *pattern) *pattern { return b.interleave(q, p.p2) }),
+			b.applyAfter(b.startTagOpenDeriv(p.p2, space, local), func(q *pattern) *pattern { return b.interleave(p.p1, q) }),
+		)
+	case oneOrMorePattern:
+		return b.applyAfter(b.startTagOpenDeriv(p.p1, space, local), func(q *pattern) *pattern {
+			return b.group(q, b.choice(p, empty))
+		})
+	case groupPattern:
+		d := b.applyAfter(b.startTagOpenDeriv(p.p1, space, local), func(q *pattern) *pattern { return b.group(q, p.p2) })
+		if nullable(p.p1) {
+			return b.choice(d, b.startTagOpenDeriv(p.p2, space, local))
+		}
+		return d
+	case afterPattern:
+		return b.applyAfter(b.startTagOpenDeriv(p.p1, space, local), func(q *pattern) *pattern { return b.after(q, p.p2) })
+	}
+	return notAllowed
+}
+
+func (b *builder) attDeriv(p *pattern, space, local, value string) *pattern {
+	return b.deriveAtt(p, space, local, value, false)
+}
+
+// skipAttribute matches an attribute against p whatever its value, so
+// that a bad value is only reported once.
+func (b *builder) skipAttribute(p *pattern, space, local string) *pattern {
+	return b.deriveAtt(p, space, local, "", true)
+}
+
+func (b *builder) deriveAtt(p *pattern, space, local, value string, lenient bool) *pattern {
+	switch p.kind {
+	case afterPattern:
+		return b.after(b.deriveAtt(p.p1, space, local, value, lenient), p.p2)
+	case choicePattern:
+		return b.choice(b.deriveAtt(p.p1, space, local, value, lenient), b.deriveAtt(p.p2, space, local, value, lenient))
+	case groupPattern:
+		return b.choice(
+			b.group(b.deriveAtt(p.p1, space, local, value, lenient), p.p2),
+			b.group(p.p1, b.deriveAtt(p.p2, space, local, value, lenient)),
+		)
+	case interleavePattern:
+		return b.choice(
+			b.interleave(b.deriveAtt(p.p1, space, local, value, lenient), p.p2),
+			b.interleave(p.p1, b.deriveAtt(p.p2, space, local, value, lenient)),
+		)
+	case oneOrMorePattern:
+		return b.group(b.deriveAtt(p.p1, space, local, value, lenient), b.choice(p, empty))
+	case attributePattern:
+		if p.nc.contains(space, local) && (lenient || b.valueMatch(p.p1, value)) {
+			return empty
+		}
+	}
+	return notAllowed
+}
+
+func (b *builder) valueMatch(p *pattern, s string) bool {
+	return nullable(p) && isWhitespace(s) || nullable(b.textDeriv(p, s))
+}
+
+// startTagCloseDeriv rules out any attributes left unmatched. When
+// lenient they are dropped instead, so that validation can carry on past
+// an element missing some.
+func (b *builder) startTagCloseDeriv(p *pattern, lenient bool) *pattern {
+	switch p.kind {
+	case afterPattern:
+		return b.after(b.startTagCloseDeriv(p.p1, lenient), p.p2)
+	case choicePattern:
+		return b.choice(b.startTagCloseDeriv(p.p1, lenient), b.startTagCloseDeriv(p.p2, lenient))
+	case groupPattern:
+		return b.group(b.startTagCloseDeriv(p.p1, lenient), b.startTagCloseDeriv(p.p2, lenient))
+	case interleavePattern:
+		return b.interleave(b.startTagCloseDeriv(p.p1, lenient), b.startTagCloseDeriv(p.p2, lenient))
+	case oneOrMorePattern:
+		return b.oneOrMore(b.startTagCloseDeriv(p.p1, lenient))
+	case attributePattern:
+		if lenient {
+			return empty
+		}
+		return notAllowed
+	}
+	return p
+}
+
+func (b *builder) endTagDeriv(p *pattern) *pattern {
+	switch p.kind {
+	case choicePattern:
+		return b.choice(b.endTagDeriv(p.p1), b.endTagDeriv(p.p2))
+	case afterPattern:
+		if nullable(p.p1) {
+			return p.p2
+		}
+	}
+	return notAllowed
+}
+
+// skipDeriv ends the current element whatever is left of its content, so
+// that validation can carry on with its siblings after an error.
+func (b *builder) skipDeriv(p *pattern) *pattern {
+	switch p.kind {
+	case choicePattern:
+		return b.choice(b.skipDeriv(p.p1), b.skipDeriv(p.p2))
+	case afterPattern:
+		return p.p2
+	}
+	return notAllowed
+}
+
+// expected describes what p could match next, for error messages.
+func expected(p *pattern) []string {
+	var out []string
+	seen := map[*pattern]bool{}
+	var walk func(p *pattern)
+	add := func(s string) {
+		for _, o := range out {
+			if o == s {
+				return
+			}
+		}
+		out = append(out, s)
+	}
+	walk = func(p *pattern) {
+		if seen[p] {
+			return
+		}
+		seen[p] = true
+		switch p.kind {
+		case choicePattern, interleavePattern:
+			walk(p.p1)
+			walk(p.p2)
+		case groupPattern:
+			walk(p.p1)
+			if nullable(p.p1) {
+				walk(p.p2)
+			}
+		case oneOrMorePattern, afterPattern:
+			walk(p.p1)
+		case elementPattern:
+			add(p.nc.String())
+		case textPattern:
+			add("text")
+		case dataPattern, dataExceptPattern:
+			add(p.dt.name())
+		case valuePattern:
+			add("'" + p.value + "'")
+		case listPattern:
+			add("a list")
+		}
+	}
+	walk(p)
+	return out
+}
+
+// required names the attributes p cannot do without. Attributes in a
+// choice are left out, as no single one of them is needed.
+func required(p *pattern) []string {
+	switch p.kind {
+	case interleavePattern, groupPattern:
+		return append(required(p.p1), required(p.p2)...)
+	case oneOrMorePattern, afterPattern:
+		return required(p.p1)
+	case attributePattern:
+		return []string{p.nc.String()}
+	}
+	return nil
+}
+
+// nameClass is a set of names an element or attribute can have.
+type nameClass struct {
+	kind   nameKind
+	space  string
+	local  string
+	c1, c2 *nameClass
+}
+
+type nameKind int
+
+const (
+	nameName nameKind = iota
+	anyName
+	anyNameExcept
+	nsName
+	nsNameExcept
+	nameChoice
+)
+
+func (nc *nameClass) contains(space, local string) bool {
+	switch nc.kind {
+	case nameName:
+		return nc.space == space && nc.local == local
+	case anyName:
+		return true
+	case anyNameExcept:
+		return !nc.c1.contains(space, local)
+	case nsName:
+		return nc.space == space
+	case nsNameExcept:
+		return nc.space == space && !nc.c1.contains(space, local)
+	case nameChoice:
+		return nc.c1.contains(space, local) || nc.c2.contains(space, local)
+	}
+	return false
+}
+
+func (nc *nameClass) String() string {
+	switch nc.kind {
+	case nameName:
+		return "'" + nc.local + "'"
+	case anyName, anyNameExcept:
+		return "any name"
+	case nsName, nsNameExcept:
+		return "any name in '" + nc.space + "'"
+	}
+	return nc.c1.String() + " or " + nc.c2.String()
+}
@@ -0,0 +1,71 @@
+package relaxng
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNameClass(t *testing.T) {
+	a := &nameClass{kind: nameName, space: "urn:a", local: "a"}
+	table := []struct {
+		nc    *nameClass
+		space string
+		local string
+		want  bool
+	}{
+		{a, "urn:a", "a", true},
+		{a, "", "a", false},
+		{&nameClass{kind: anyName}, "urn:b", "b", true},
+		{&nameClass{kind: anyNameExcept, c1: a}, "urn:a", "a", false},
+		{&nameClass{kind: anyNameExcept, c1: a}, "urn:a", "b", true},
+		{&nameClass{kind: nsName, space: "urn:a"}, "urn:a", "b", true},
+		{&nameClass{kind: nsName, space: "urn:a"}, "urn:b", "b", false},
+		{&nameClass{kind: nsNameExcept, space: "urn:a", c1: a}, "urn:a", "a", false},
+		{&nameClass{kind: nameChoice, c1: a, c2: &nameClass{kind: nsName, space: "urn:b"}}, "urn:b", "x", true},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			if got := tst.nc.contains(tst.space, tst.local); got != tst.want {
+				t.Errorf("wanted %v but got %v", tst.want, got)
+			}
+		})
+	}
+}
+
+func TestDerivatives(t *testing.T) {
+	b := newBuilder()
+	word := b.intern(pattern{kind: valuePattern, dt: tokenType, value: "a"})
+	list := b.intern(pattern{kind: listPattern, p1: b.oneOrMore(word)})
+
+	table := []struct {
+		p    *pattern
+		text string
+		want bool
+	}{
+		{text, "anything", true},
+		{word, " a ", true},
+		{word, "b", false},
+		{b.group(word, word), "a", false},
+		{b.interleave(text, word), "a", true},
+		{b.choice(empty, word), "a", true},
+		{list, "a a  a", true},
+		{list, "a b", false},
+		{list, "", false},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			if got := nullable(b.textDeriv(tst.p, tst.text)); got != tst.want {
+				t.Errorf("wanted %v but got %v", tst.want, got)
+			}
+		})
+	}
+
+	if b.choice(word, word) != word {
+		t.Error("wanted a choice between the same pattern to be that pattern")
+	}
+	if b.group(word, notAllowed) != notAllowed {
+		t.Error("wanted a group with notAllowed to be notAllowed")
+	}
+}
@@ -0,0 +1,140 @@
+package relaxng
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/danwhitford/xmlparser"
+)
+
+type validator struct {
+	b    *builder
+	errs []*Error
+}
+
+// Validate checks root against the schema, returning every problem it
+// finds. It gives nil if root is valid.
+func (s *Schema) Validate(root xmlparser.XmlNode) []*Error {
+	v := &validator{b: s.b.derive()}
+	v.element(s.start, root, "/"+root.Name)
+	return v.errs
+}
+
+func (v *validator) errorf(node xmlparser.XmlNode, path, format string, args ...any) {
+	v.errs = append(v.errs, &Error{
+		Path: path,
+		Pos:  node.Span.Start,
+		Msg:  fmt.Sprintf(format, args...),
+	})
+}
+
+func describe(p *pattern) string {
+	expected := expected(p)
+	if len(expected) == 0 {
+		return "nothing"
+	}
+	return strings.Join(expected, " or ")
+}
+
+// element matches node against p, giving what p allows after it. When
+// node is not allowed at all it is reported and skipped.
+func (v *validator) element(p *pattern, node xmlparser.XmlNode, path string) *pattern {
+	b := v.b
+	d := b.startTagOpenDeriv(p, node.Namespace, node.Local())
+	if d == notAllowed {
+		v.errorf(node, path, "element '%s' is not allowed here, expected %s", node.Name, describe(p))
+		return p
+	}
+
+	for _, a := range node.Attributes {
+		if a.Namespace == xmlparser.XMLNSNamespace {
+			continue
+		}
+		next := b.attDeriv(d, a.Namespace, a.Local(), a.Value)
+		if next == notAllowed {
+			next = b.skipAttribute(d, a.Namespace, a.Local())
+			if next == notAllowed {
+				v.errorf(node, path, "attribute '%s' is not allowed on '%s'", a.Key, node.Name)
+				continue
+			}
+			v.errorf(node, path, "attribute '%s' has a bad value '%s'", a.Key, a.Value)
+		}
+		d = next
+	}
+	closed := b.startTagCloseDeriv(d, false)
+	if closed == notAllowed {
+		missing := required(d)
+		if len(missing) == 0 {
+			v.errorf(node, path, "element '%s' is missing attributes", node.Name)
+		} else {
+			v.errorf(node, path, "element '%s' is missing attribute %s", node.Name, strings.Join(missing, " and "))
+		}
+		closed = b.startTagCloseDeriv(d, true)
+	}
+
+	closed = v.content(closed, node, path)
+
+	end := b.endTagDeriv(closed)
+	if end == notAllowed {
+		v.errorf(node, path, "content of '%s' is incomplete, expected %s", node.Name, describe(closed))
+		return b.skipDeriv(closed)
+	}
+	return end
+}
+
+// content matches the children of node against p. Runs of text are
+// matched as one, and text that is only whitespace is ignored between
+// elements.
+func (v *validator) content(p *pattern, node xmlparser.XmlNode, path string) *pattern {
+	if len(node.Children) == 0 {
+		return v.text(p, node, path, node.Contents, true)
+	}
+
+	hasElements := false
+	counts := map[string]int{}
+	for _, child := range node.Children {
+		if child.Type == xmlparser.ElementNode {
+			hasElements = true
+			counts[child.Name]++
+		}
+	}
+
+	var sb strings.Builder
+	seen := map[string]int{}
+	for _, child := range node.Children {
+		switch child.Type {
+		case xmlparser.TextNode, xmlparser.CDataNode:
+			sb.WriteString(child.Contents)
+		case xmlparser.ElementNode:
+			p = v.text(p, node, path, sb.String(), !hasElements)
+			sb.Reset()
+			seen[child.Name]++
+			childPath := path + "/" + child.Name
+			if counts[child.Name] > 1 {
+				childPath += fmt.Sprintf("[%d]", seen[child.Name])
+			}
+			p = v.element(p, child, childPath)
+		}
+	}
+	return v.text(p, node, path, sb.String(), !hasElements)
+}
+
+// text matches s against p. Whitespace between elements can always be
+// left out, and so can an element's only text when it is whitespace.
+func (v *validator) text(p *pattern, node xmlparser.XmlNode, path, s string, only bool) *pattern {
+	if isWhitespace(s) && !only {
+		return p
+	}
+	d := v.b.textDeriv(p, s)
+	if isWhitespace(s) {
+		return v.b.choice(p, d)
+	}
+	if d == notAllowed {
+		v.errorf(node, path, "text '%s' is not allowed here, expected %s", strings.TrimSpace(s), describe(p))
+		if skipped := v.b.skipText(p, s); skipped != notAllowed {
+			return skipped
+		}
+		return p
+	}
+	return d
+}
@@ -0,0 +1,235 @@
+package relaxng
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/danwhitford/xmlparser"
+	"github.com/google/go-cmp/cmp"
+)
+
+const feedSchema = `<grammar xmlns="http://relaxng.org/ns/structure/1.0"
+	datatypeLibrary="http://www.w3.org/2001/XMLSchema-datatypes">
+	<start>
+		<element name="feed">
+			<attribute name="version"><value>2.0</value></attribute>
+			<optional><attribute name="lang"><data type="language"/></attribute></optional>
+			<element name="title"><text/></element>
+			<zeroOrMore><ref name="item"/></zeroOrMore>
+		</element>
+	</start>
+
+	<define name="item">
+		<element name="item">
+			<interleave>
+				<element name="title"><text/></element>
+				<optional>
+					<element name="duration">
+						<data type="positiveInteger"><param name="maxInclusive">86400</param></data>
+					</element>
+				</optional>
+				<zeroOrMore>
+					<element name="tag"><choice><value>news</value><value>sport</value></choice></element>
+				</zeroOrMore>
+			</interleave>
+			<optional><ref name="body"/></optional>
+		</element>
+	</define>
+
+	<define name="body">
+		<element name="body">
+			<mixed><zeroOrMore><element name="b"><text/></element></zeroOrMore></mixed>
+		</element>
+	</define>
+	<define name="body" combine="choice">
+		<element name="link">
+			<attribute name="href"/>
+			<list><oneOrMore><data type="token"/></oneOrMore></list>
+		</element>
+	</define>
+</grammar>`
+
+func TestValidate(t *testing.T) {
+	schema, err := Parse(feedSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		input string
+		want  []string
+	}{
+		{
+			`<feed version="2.0" lang="en">
+				<title>T</title>
+				<item><tag>news</tag><title>A</title><duration>60</duration><body>hi <b>there</b> you</body></item>
+				<item><title>B</title><link href="x">a b c</link></item>
+			</feed>`,
+			nil,
+		},
+		{
+			`<feed version="3" colour="red">
+				<title>T</title>
+				<item><title>A</title><duration>lots</duration><tag>food</tag><pic/></item>
+			</feed>`,
+			[]string{
+				"1:1: /feed: attribute 'version' has a bad value '3'",
+				"1:1: /feed: attribute 'colour' is not allowed on 'feed'",
+				"3:27: /feed/item/duration: text 'lots' is not allowed here, expected xs:positiveInteger",
+				"3:52: /feed/item/tag: text 'food' is not allowed here, expected 'news' or 'sport'",
+				"3:67: /feed/item/pic: element 'pic' is not allowed here, expected 'tag' or 'body' or 'link'",
+			},
+		},
+		{
+			`<feed><title>T</title><item><duration>5</duration></item><item><title>B</title><link/></item></feed>`,
+			[]string{
+				"1:1: /feed: element 'feed' is missing attribute 'version'",
+				"1:23: /feed/item[1]: content of 'item' is incomplete, expected 'title' or 'tag'",
+				"1:80: /feed/item[2]/link: element 'link' is missing attribute 'href'",
+				"1:80: /feed/item[2]/link: content of 'link' is incomplete, expected a list",
+			},
+		},
+		{
+			`<feed version="2.0"><item><title>A</title></item><title>T</title></feed>`,
+			[]string{
+				"1:21: /feed/item: element 'item' is not allowed here, expected 'title'",
+			},
+		},
+		{
+			`<feed version="2.0"><title>T</title>stray text</feed>`,
+			[]string{
+				"1:1: /feed: text 'stray text' is not allowed here, expected 'item'",
+			},
+		},
+		{
+			`<rss/>`,
+			[]string{
+				"1:1: /rss: element 'rss' is not allowed here, expected 'feed'",
+			},
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			root, err := xmlparser.Parse(tst.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, err := range schema.Validate(root) {
+				got = append(got, err.Error())
+			}
+			if diff := cmp.Diff(tst.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestValidateConcurrent(t *testing.T) {
+	schema, err := Parse(feedSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var docs []xmlparser.XmlNode
+	for i := 1; i <= 8; i++ {
+		var sb strings.Builder
+		for j := 1; j <= i; j++ {
+			fmt.Fprintf(&sb, "<item><tag>news</tag><title>%d</title><duration>%d</duration></item>", j, j*60)
+		}
+		if i%2 == 0 {
+			sb.WriteString("<item/>")
+		}
+		root, err := xmlparser.Parse(`<feed version="2.0"><title>T</title>` + sb.String() + "</feed>")
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, root)
+	}
+
+	var wg sync.WaitGroup
+	got := make([][]*Error, len(docs))
+	for i, root := range docs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i] = schema.Validate(root)
+		}()
+	}
+	wg.Wait()
+
+	for i := range docs {
+		want := 0
+		if (i+1)%2 == 0 {
+			want = 1
+		}
+		if len(got[i]) != want {
+			t.Errorf("document %d gave %v", i+1, got[i])
+		}
+	}
+}
+
+func TestValidateNames(t *testing.T) {
+	schema, err := Parse(`<grammar xmlns="http://relaxng.org/ns/structure/1.0" xmlns:d="urn:dc" ns="urn:tree">
+		<start><ref name="node"/></start>
+		<define name="node">
+			<element name="node">
+				<optional><attribute name="d:title"/></optional>
+				<zeroOrMore>
+					<choice>
+						<ref name="node"/>
+						<element><nsName ns="urn:dc"><except><name>d:secret</name></except></nsName><text/></element>
+						<element><anyName><except><nsName/><nsName ns="urn:dc"/></except></anyName><empty/></element>
+					</choice>
+				</zeroOrMore>
+			</element>
+		</define>
+	</grammar>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		input string
+		want  []string
+	}{
+		{
+			`<node xmlns="urn:tree" xmlns:d="urn:dc" d:title="root">
+				<node><node/><d:creator>Ann</d:creator></node>
+				<other xmlns="urn:other"/>
+			</node>`,
+			nil,
+		},
+		{
+			`<node xmlns="urn:tree" xmlns:d="urn:dc" title="root">
+				<d:secret/>
+				<leaf/>
+				<other xmlns="urn:other">text</other>
+			</node>`,
+			[]string{
+				"1:1: /node: attribute 'title' is not allowed on 'node'",
+				"2:5: /node/d:secret: element 'd:secret' is not allowed here, expected 'node' or any name in 'urn:dc' or any name",
+				"3:5: /node/leaf: element 'leaf' is not allowed here, expected 'node' or any name in 'urn:dc' or any name",
+				"4:5: /node/other: text 'text' is not allowed here, expected nothing",
+			},
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			root, err := xmlparser.Parse(tst.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, err := range schema.Validate(root) {
+				got = append(got, err.Error())
+			}
+			if diff := cmp.Diff(tst.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,486 @@
+package xmlparser
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/danwhitford/xmlparser/tokeniser"
+)
+
+const SchematronNamespace = "http://purl.oclc.org/dsdl/schematron"
+
+// Schematron is a compiled set of Schematron rules. Its tests are XPath
+// 1.0 expressions. Phases, diagnostics and abstract patterns are not
+// supported, so every pattern is checked.
+type Schematron struct {
+	namespaces map[string]string
+	lets       []*schLet
+	patterns   []*schPattern
+}
+
+type schPattern struct {
+	lets  []*schLet
+	rules []*schRule
+}
+
+type schRule struct {
+	context xpathExpr
+	source  string
+	lets    []*schLet
+	checks  []*schCheck
+}
+
+type schLet struct {
+	name   string
+	value  xpathExpr
+	source string
+}
+
+// schCheck is an assert, or a report when report is set.
+type schCheck struct {
+	report  bool
+	test    xpathExpr
+	source  string
+	id      string
+	role    string
+	message []schMessagePart
+}
+
+// schMessagePart is a run of text in a message, or the result of a
+// value-of or name element when expr is set.
+type schMessagePart struct {
+	text   string
+	expr   xpathExpr
+	source string
+	name   bool
+}
+
+// SchematronFailure is an assert whose test did not hold on a node, or a
+// report whose test did. Path locates the node, such as
+// /rss[1]/channel[1]/item[2].
+type SchematronFailure struct {
+	Pos    tokeniser.Position
+	Path   string
+	Test   string
+	ID     string
+	Role   string
+	Report bool
+	Msg    string
+}
+
+func (f *SchematronFailure) Error() string {
+	return fmt.Sprintf("%v: %s (at %s)", f.Pos, f.Msg, f.Path)
+}
+
+// SchematronError is a problem found while compiling a Schematron
+// schema. Path is the local name of the schema element at fault.
+type SchematronError struct {
+	Path string
+	Pos  tokeniser.Position
+	Msg  string
+}
+
+func (e *SchematronError) Error() string {
+	return fmt.Sprintf("%v: %s: %s", e.Pos, e.Path, e.Msg)
+}
+
+// ParseSchematron compiles the Schematron schema in input.
+func ParseSchematron(input string) (*Schematron, error) {
+	root, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return CompileSchematron(root)
+}
+
+// CompileSchematron builds a schema from a schema element.
+func CompileSchematron(root XmlNode) (*Schematron, error) {
+	if root.Namespace != SchematronNamespace || root.Local() != "schema" {
+		return nil, schematronError(root, "expected a Schematron schema element but got '%s'", root.Name)
+	}
+	binding, _ := root.Attr("queryBinding")
+	switch strings.ToLower(binding) {
+	case "", "xslt", "xpath":
+	default:
+		return nil, schematronError(root, "queryBinding '%s' is not supported", binding)
+	}
+
+	c := &schCompiler{abstract: map[string]XmlNode{}}
+	s := &Schematron{namespaces: map[string]string{}}
+	for _, child := range schChildren(root) {
+		if child.Local() != "pattern" {
+			continue
+		}
+		for _, rule := range schChildren(child) {
+			if rule.Local() == "rule" && rule.AttrOr("abstract", "") == "true" {
+				c.abstract[rule.AttrOr("id", "")] = rule
+			}
+		}
+	}
+
+	for _, child := range schChildren(root) {
+		var err error
+		switch child.Local() {
+		case "ns":
+			s.namespaces[child.AttrOr("prefix", "")] = child.AttrOr("uri", "")
+		case "let":
+			var let *schLet
+			let, err = c.let(child)
+			s.lets = append(s.lets, let)
+		case "pattern":
+			var pattern *schPattern
+			pattern, err = c.pattern(child)
+			s.patterns = append(s.patterns, pattern)
+		case "title", "p", "diagnostics", "phase", "properties":
+		default:
+			err = schematronError(child, "%s is not supported", child.Local())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func schematronError(node XmlNode, format string, args ...any) *SchematronError {
+	return &SchematronError{
+		Path: node.Local(),
+		Pos:  node.Span.Start,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+// schChildren gives the Schematron elements inside node, skipping
+// anything from other namespaces.
+func schChildren(node XmlNode) []XmlNode {
+	var out []XmlNode
+	for _, child := range node.Children {
+		if child.Type == ElementNode && child.Namespace == SchematronNamespace {
+			out = append(out, child)
+		}
+	}
+	return out
+}
+
+type schCompiler struct {
+	abstract  map[string]XmlNode
+	extending []string
+}
+
+// xpath compiles the expression in the attribute key of node.
+func (c *schCompiler) xpath(node XmlNode, key string) (xpathExpr, string, error) {
+	source, ok := node.Attr(key)
+	if !ok {
+		return nil, "", schematronError(node, "%s needs a %s attribute", node.Local(), key)
+	}
+	e, err := compileXPath(source)
+	if err != nil {
+		return nil, "", schematronError(node, "%s: %v", key, err)
+	}
+	return e, source, nil
+}
+
+func (c *schCompiler) let(node XmlNode) (*schLet, error) {
+	name, ok := node.Attr("name")
+	if !ok {
+		return nil, schematronError(node, "let needs a name attribute")
+	}
+	value, source, err := c.xpath(node, "value")
+	if err != nil {
+		return nil, err
+	}
+	return &schLet{name: name, value: value, source: source}, nil
+}
+
+func (c *schCompiler) pattern(node XmlNode) (*schPattern, error) {
+	if node.AttrOr("abstract", "") == "true" || node.AttrOr("is-a", "") != "" {
+		return nil, schematronError(node, "abstract patterns are not supported")
+	}
+	pattern := &schPattern{}
+	for _, child := range schChildren(node) {
+		switch child.Local() {
+		case "let":
+			let, err := c.let(child)
+			if err != nil {
+				return nil, err
+			}
+			pattern.lets = append(pattern.lets, let)
+		case "rule":
+			if child.AttrOr("abstract", "") == "true" {
+				continue
+			}
+			rule, err := c.rule(child)
+			if err != nil {
+				return nil, err
+			}
+			pattern.rules = append(pattern.rules, rule)
+		case "title", "p", "param":
+		default:
+			return nil, schematronError(child, "unexpected %s in pattern", child.Local())
+		}
+	}
+	return pattern, nil
+}
+
+func (c *schCompiler) rule(node XmlNode) (*schRule, error) {
+	context, source, err := c.xpath(node, "context")
+	if err != nil {
+		return nil, err
+	}
+	rule := &schRule{context: matchAnywhere(context), source: source}
+	return rule, c.ruleContent(rule, node)
+}
+
+// ruleContent adds the lets and checks in node to rule, along with those
+// of any abstract rules it extends.
+func (c *schCompiler) ruleContent(rule *schRule, node XmlNode) error {
+	for _, child := range schChildren(node) {
+		switch child.Local() {
+		case "let":
+			let, err := c.let(child)
+			if err != nil {
+				return err
+			}
+			rule.lets = append(rule.lets, let)
+		case "assert", "report":
+			check, err := c.check(child)
+			if err != nil {
+				return err
+			}
+			rule.checks = append(rule.checks, check)
+		case "extends":
+			id := child.AttrOr("rule", "")
+			base, ok := c.abstract[id]
+			if !ok {
+				return schematronError(child, "no abstract rule '%s'", id)
+			}
+			if slices.Contains(c.extending, id) {
+				return schematronError(child, "abstract rule '%s' extends itself", id)
+			}
+			c.extending = append(c.extending, id)
+			err := c.ruleContent(rule, base)
+			c.extending = c.extending[:len(c.extending)-1]
+			if err != nil {
+				return err
+			}
+		case "title", "p":
+		default:
+			return schematronError(child, "unexpected %s in rule", child.Local())
+		}
+	}
+	return nil
+}
+
+func (c *schCompiler) check(node XmlNode) (*schCheck, error) {
+	test, source, err := c.xpath(node, "test")
+	if err != nil {
+		return nil, err
+	}
+	check := &schCheck{
+		report: node.Local() == "report",
+		test:   test,
+		source: source,
+		id:     node.AttrOr("id", ""),
+		role:   node.AttrOr("role", ""),
+	}
+	check.message, err = c.message(node)
+	return check, err
+}
+
+// message splits the text of an assert or report into the parts to
+// fill in when it is reported.
+func (c *schCompiler) message(node XmlNode) ([]schMessagePart, error) {
+	if node.Contents != "" {
+		return []schMessagePart{{text: node.Contents}}, nil
+	}
+	var parts []schMessagePart
+	for _, child := range node.Children {
+		switch {
+		case child.Type == TextNode || child.Type == CDataNode:
+			parts = append(parts, schMessagePart{text: child.Contents})
+		case child.Type != ElementNode:
+		case child.Namespace == SchematronNamespace && child.Local() == "value-of":
+			e, source, err := c.xpath(child, "select")
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, schMessagePart{expr: e, source: source})
+		case child.Namespace == SchematronNamespace && child.Local() == "name":
+			part := schMessagePart{name: true}
+			if _, ok := child.Attr("path"); ok {
+				e, source, err := c.xpath(child, "path")
+				if err != nil {
+					return nil, err
+				}
+				part.expr, part.source = e, source
+			}
+			parts = append(parts, part)
+		default:
+			inner, err := c.message(child)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, inner...)
+		}
+	}
+	return parts, nil
+}
+
+// matchAnywhere turns a rule context into an expression selecting every
+// node it matches. Like an XSLT pattern, a relative path can match
+// anywhere in the document.
+func matchAnywhere(e xpathExpr) xpathExpr {
+	switch e := e.(type) {
+	case *binaryExpr:
+		if e.op == "|" {
+			return &binaryExpr{op: "|", left: matchAnywhere(e.left), right: matchAnywhere(e.right), pos: e.pos}
+		}
+	case *pathExpr:
+		if !e.absolute && e.filter == nil {
+			steps := append([]step{anyNode(descendantOrSelfAxis)}, e.steps...)
+			return &pathExpr{absolute: true, steps: steps, pos: e.pos}
+		}
+	}
+	return e
+}
+
+// Check runs every pattern over the tree under root, returning the
+// failed asserts and successful reports in document order within each
+// pattern. Within a pattern a node is only checked by the first rule
+// whose context matches it. It returns an error if an expression cannot
+// be evaluated.
+func (s *Schematron) Check(root XmlNode) ([]*SchematronFailure, error) {
+	doc := newNavTree(&root)
+	vars, err := s.bind(doc, doc, nil, s.lets)
+	if err != nil {
+		return nil, err
+	}
+
+	var failures []*SchematronFailure
+	for _, pattern := range s.patterns {
+		patternVars, err := s.bind(doc, doc, vars, pattern.lets)
+		if err != nil {
+			return nil, err
+		}
+
+		type hit struct {
+			node *navNode
+			rule *schRule
+		}
+		var hits []hit
+		fired := map[*navNode]bool{}
+		for _, rule := range pattern.rules {
+			v, err := evalXPath(rule.context, rule.source, doc, doc, s.namespaces, patternVars)
+			if err != nil {
+				return nil, err
+			}
+			nodes, ok := v.(nodeSet)
+			if !ok {
+				return nil, &PathError{rule.source, 0, "a rule context must select nodes"}
+			}
+			for _, n := range nodes {
+				if !fired[n] {
+					fired[n] = true
+					hits = append(hits, hit{n, rule})
+				}
+			}
+		}
+		slices.SortStableFunc(hits, func(a, b hit) int {
+			if a.node.before(b.node) {
+				return -1
+			}
+			if b.node.before(a.node) {
+				return 1
+			}
+			return 0
+		})
+
+		for _, h := range hits {
+			found, err := s.checkRule(doc, h.node, h.rule, patternVars)
+			if err != nil {
+				return nil, err
+			}
+			failures = append(failures, found...)
+		}
+	}
+	return failures, nil
+}
+
+// bind evaluates lets in order at n, adding them to a copy of vars.
+func (s *Schematron) bind(doc, n *navNode, vars map[string]any, lets []*schLet) (map[string]any, error) {
+	if len(lets) == 0 {
+		return vars, nil
+	}
+	vars = maps.Clone(vars)
+	if vars == nil {
+		vars = map[string]any{}
+	}
+	for _, let := range lets {
+		v, err := evalXPath(let.value, let.source, doc, n, s.namespaces, vars)
+		if err != nil {
+			return nil, err
+		}
+		vars[let.name] = v
+	}
+	return vars, nil
+}
+
+func (s *Schematron) checkRule(doc, n *navNode, rule *schRule, vars map[string]any) ([]*SchematronFailure, error) {
+	vars, err := s.bind(doc, n, vars, rule.lets)
+	if err != nil {
+		return nil, err
+	}
+	var failures []*SchematronFailure
+	for _, check := range rule.checks {
+		v, err := evalXPath(check.test, check.source, doc, n, s.namespaces, vars)
+		if err != nil {
+			return nil, err
+		}
+		if toBoolean(v) != check.report {
+			continue
+		}
+		msg, err := s.message(doc, n, check.message, vars)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, &SchematronFailure{
+			Pos:    n.pos(),
+			Path:   n.path(),
+			Test:   check.source,
+			ID:     check.id,
+			Role:   check.role,
+			Report: check.report,
+			Msg:    msg,
+		})
+	}
+	return failures, nil
+}
+
+func (s *Schematron) message(doc, n *navNode, parts []schMessagePart, vars map[string]any) (string, error) {
+	var sb strings.Builder
+	for _, part := range parts {
+		if part.expr == nil && !part.name {
+			sb.WriteString(part.text)
+			continue
+		}
+		var v any = nodeSet{n}
+		if part.expr != nil {
+			var err error
+			v, err = evalXPath(part.expr, part.source, doc, n, s.namespaces, vars)
+			if err != nil {
+				return "", err
+			}
+		}
+		if !part.name {
+			sb.WriteString(toString(v))
+			continue
+		}
+		if nodes, ok := v.(nodeSet); ok && len(nodes) > 0 {
+			name, _, _ := nodes[0].name()
+			sb.WriteString(name)
+		}
+	}
+	return strings.Join(strings.FieldsFunc(sb.String(), isXMLSpace), " "), nil
+}
@@ -0,0 +1,191 @@
+package xmlparser
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/danwhitford/xmlparser/tokeniser"
+	"github.com/google/go-cmp/cmp"
+)
+
+const feedRules = `<sch:schema xmlns:sch="http://purl.oclc.org/dsdl/schematron" queryBinding="xslt">
+	<sch:ns prefix="it" uri="urn:itunes"/>
+	<sch:let name="max" value="3600"/>
+
+	<sch:pattern id="items">
+		<sch:rule context="item[@draft]">
+			<sch:report test="true()" role="info">draft <sch:value-of select="title"/> is skipped</sch:report>
+		</sch:rule>
+		<sch:rule context="item">
+			<sch:extends rule="titled"/>
+			<sch:let name="seconds" value="number(it:duration)"/>
+			<sch:assert test="guid" id="guid" role="error">every <sch:name/> must have a guid</sch:assert>
+			<sch:assert test="not(it:duration) or $seconds &lt;= $max">
+				duration <sch:value-of select="$seconds"/> is over <sch:value-of select="$max"/>
+			</sch:assert>
+		</sch:rule>
+		<sch:rule abstract="true" id="titled">
+			<sch:assert test="normalize-space(title)"><sch:name/> needs a title</sch:assert>
+		</sch:rule>
+	</sch:pattern>
+
+	<sch:pattern id="links">
+		<sch:rule context="@href | enclosure/@url">
+			<sch:assert test="starts-with(., 'https://')"><sch:name/> on <sch:name path=".."/> must use https</sch:assert>
+		</sch:rule>
+	</sch:pattern>
+</sch:schema>`
+
+func TestSchematron(t *testing.T) {
+	schema, err := ParseSchematron(feedRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		input string
+		want  []string
+	}{
+		{
+			`<rss xmlns:itunes="urn:itunes"><channel>
+				<item><title>One</title><guid>1</guid><itunes:duration>60</itunes:duration></item>
+				<link href="https://example.com"/>
+			</channel></rss>`,
+			nil,
+		},
+		{
+			`<rss xmlns:itunes="urn:itunes"><channel>
+				<item><title>One</title><guid>1</guid></item>
+				<item><title> </title><itunes:duration>7200</itunes:duration><enclosure url="http://x"/></item>
+				<item draft="yes"><title>Three</title></item>
+				<link href="ftp://example.com"/>
+			</channel></rss>`,
+			[]string{
+				"3:5: item needs a title (at /rss[1]/channel[1]/item[2])",
+				"3:5: every item must have a guid (at /rss[1]/channel[1]/item[2])",
+				"3:5: duration 7200 is over 3600 (at /rss[1]/channel[1]/item[2])",
+				"4:5: draft Three is skipped (at /rss[1]/channel[1]/item[3])",
+				"3:77: url on enclosure must use https (at /rss[1]/channel[1]/item[2]/enclosure[1]/@url)",
+				"5:11: href on link must use https (at /rss[1]/channel[1]/link[1]/@href)",
+			},
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			root, err := Parse(tst.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			failures, err := schema.Check(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range failures {
+				got = append(got, f.Error())
+			}
+			if diff := cmp.Diff(tst.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSchematronFailureFields(t *testing.T) {
+	schema, err := ParseSchematron(feedRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := Parse(`<channel><item draft="1"/><item/></channel>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures, err := schema.Check(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*SchematronFailure{
+		{Pos: tokeniser.Position{Offset: 9, Line: 1, Col: 10}, Path: "/channel[1]/item[1]", Test: "true()", Role: "info", Report: true, Msg: "draft is skipped"},
+		{Pos: tokeniser.Position{Offset: 26, Line: 1, Col: 27}, Path: "/channel[1]/item[2]", Test: "normalize-space(title)", Msg: "item needs a title"},
+		{Pos: tokeniser.Position{Offset: 26, Line: 1, Col: 27}, Path: "/channel[1]/item[2]", Test: "guid", ID: "guid", Role: "error", Msg: "every item must have a guid"},
+	}
+	if diff := cmp.Diff(want, failures); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestSchematronErrors(t *testing.T) {
+	table := []struct {
+		input string
+		want  string
+	}{
+		{
+			`<schema/>`,
+			"1:1: schema: expected a Schematron schema element but got 'schema'",
+		},
+		{
+			`<schema xmlns="http://purl.oclc.org/dsdl/schematron" queryBinding="xslt2"/>`,
+			"1:1: schema: queryBinding 'xslt2' is not supported",
+		},
+		{
+			`<schema xmlns="http://purl.oclc.org/dsdl/schematron"><include href="x.sch"/></schema>`,
+			"1:54: include: include is not supported",
+		},
+		{
+			`<schema xmlns="http://purl.oclc.org/dsdl/schematron"><pattern><rule context="a["/></pattern></schema>`,
+			"1:63: rule: context: xpath 'a[' at 3: unexpected end of expression",
+		},
+		{
+			`<schema xmlns="http://purl.oclc.org/dsdl/schematron"><pattern><rule context="a"><assert>x</assert></rule></pattern></schema>`,
+			"1:81: assert: assert needs a test attribute",
+		},
+		{
+			`<schema xmlns="http://purl.oclc.org/dsdl/schematron"><pattern><rule context="a"><extends rule="b"/></rule></pattern></schema>`,
+			"1:81: extends: no abstract rule 'b'",
+		},
+		{
+			`<schema xmlns="http://purl.oclc.org/dsdl/schematron">
+				<pattern><rule abstract="true" id="b"><extends rule="b"/></rule><rule context="a"><extends rule="b"/></rule></pattern>
+			</schema>`,
+			"2:43: extends: abstract rule 'b' extends itself",
+		},
+		{
+			`<schema xmlns="http://purl.oclc.org/dsdl/schematron"><pattern abstract="true"/></schema>`,
+			"1:54: pattern: abstract patterns are not supported",
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := ParseSchematron(tst.input)
+			var schErr *SchematronError
+			if !errors.As(err, &schErr) {
+				t.Fatalf("wanted a SchematronError for input '%v' but got %v", tst.input, err)
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSchematronCheckError(t *testing.T) {
+	schema, err := ParseSchematron(`<schema xmlns="http://purl.oclc.org/dsdl/schematron">
+		<pattern><rule context="a"><assert test="$missing">x</assert></rule></pattern>
+	</schema>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := Parse(`<a/>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = schema.Check(root)
+	want := "xpath '$missing' at 1: variable '$missing' is not set"
+	if err == nil || err.Error() != want {
+		t.Errorf("wanted %s but got %v", want, err)
+	}
+}
@@ -0,0 +1,618 @@
+package xmlparser
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SelectorError reports a CSS selector that could not be compiled. Pos is
+// the byte offset in Selector the problem was found at.
+type SelectorError struct {
+	Selector string
+	Pos      int
+	Msg      string
+}
+
+func (e *SelectorError) Error() string {
+	return fmt.Sprintf("selector '%s' at %d: %s", e.Selector, e.Pos+1, e.Msg)
+}
+
+// Select gives the elements matched by the CSS selector, in document
+// order. node is treated as the root of the document, so it can match
+// too.
+//
+// Type selectors match the local name in any namespace. A prefix is
+// given as in CSS, with prefix|name, and means whatever the document
+// first declares it to mean. An escaped colon, as in itunes\:duration,
+// matches the prefixed name as written.
+func (node XmlNode) Select(selector string) ([]XmlNode, error) {
+	doc := newNavTree(&node)
+	p := &selectorParser{src: selector, doc: doc}
+	list, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	var out []XmlNode
+	for _, n := range descendants(doc, nil) {
+		if n.kind == elementNav && list.matches(n, nil) {
+			out = append(out, *n.node)
+		}
+	}
+	return out, nil
+}
+
+// cssMatcher tests one element. scope is the element a relative selector
+// inside :has() is anchored to, and nil elsewhere.
+type cssMatcher func(n, scope *navNode) bool
+
+// cssComplex is a run of compound selectors, joined by the combinator
+// between each pair: ' ', '>', '+' or '~'.
+type cssComplex struct {
+	compounds   []cssMatcher
+	combinators []byte
+}
+
+type cssList []*cssComplex
+
+func (list cssList) matches(n, scope *navNode) bool {
+	for _, c := range list {
+		if c.matchAt(n, scope, len(c.compounds)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAt reports whether n matches the compounds up to i, working right
+// to left through the combinators.
+func (c *cssComplex) matchAt(n, scope *navNode, i int) bool {
+	if !c.compounds[i](n, scope) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch c.combinators[i-1] {
+	case '>':
+		p := parentElement(n)
+		return p != nil && c.matchAt(p, scope, i-1)
+	case ' ':
+		for p := parentElement(n); p != nil; p = parentElement(p) {
+			if c.matchAt(p, scope, i-1) {
+				return true
+			}
+		}
+	case '+':
+		siblings := elementSiblings(n)
+		at := indexOf(siblings, n)
+		return at > 0 && c.matchAt(siblings[at-1], scope, i-1)
+	case '~':
+		siblings := elementSiblings(n)
+		for _, s := range siblings[:indexOf(siblings, n)] {
+			if c.matchAt(s, scope, i-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parentElement(n *navNode) *navNode {
+	if n.parent.kind == elementNav {
+		return n.parent
+	}
+	return nil
+}
+
+// elementSiblings gives the elements among n's parent's children,
+// including n.
+func elementSiblings(n *navNode) []*navNode {
+	var out []*navNode
+	for _, child := range n.parent.children {
+		if child.kind == elementNav {
+			out = append(out, child)
+		}
+	}
+	return out
+}
+
+func indexOf(nodes []*navNode, n *navNode) int {
+	for i, m := range nodes {
+		if m == n {
+			return i
+		}
+	}
+	return -1
+}
+
+type selectorParser struct {
+	src string
+	pos int
+	doc *navNode
+}
+
+func (p *selectorParser) errorf(pos int, format string, args ...any) *SelectorError {
+	return &SelectorError{p.src, pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *selectorParser) unexpected() *SelectorError {
+	if p.pos >= len(p.src) {
+		return p.errorf(p.pos, "unexpected end of selector")
+	}
+	r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+	return p.errorf(p.pos, "unexpected '%c'", r)
+}
+
+func (p *selectorParser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n\f", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func (p *selectorParser) expect(c byte) error {
+	p.skipSpace()
+	if p.peek() != c {
+		return p.unexpected()
+	}
+	p.pos++
+	return nil
+}
+
+func (p *selectorParser) parse() (cssList, error) {
+	list, err := p.list(false)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) {
+		return nil, p.unexpected()
+	}
+	return list, nil
+}
+
+// list reads selectors separated by commas, up to the end of the input or
+// a closing bracket. Within :has() each is relative to the scope element.
+func (p *selectorParser) list(relative bool) (cssList, error) {
+	var list cssList
+	for {
+		c, err := p.complex(relative)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+		p.skipSpace()
+		if p.peek() != ',' {
+			return list, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *selectorParser) complex(relative bool) (*cssComplex, error) {
+	c := &cssComplex{}
+	p.skipSpace()
+	if relative {
+		c.compounds = append(c.compounds, func(n, scope *navNode) bool { return n == scope })
+		combinator := byte(' ')
+		if strings.IndexByte(">+~", p.peek()) >= 0 {
+			combinator = p.peek()
+			p.pos++
+		}
+		c.combinators = append(c.combinators, combinator)
+		p.skipSpace()
+	}
+
+	for {
+		compound, err := p.compound()
+		if err != nil {
+			return nil, err
+		}
+		c.compounds = append(c.compounds, compound)
+
+		spaced := p.skipSpace()
+		combinator := p.peek()
+		switch {
+		case combinator == '>' || combinator == '+' || combinator == '~':
+			p.pos++
+			p.skipSpace()
+		case spaced && combinator != 0 && combinator != ',' && combinator != ')':
+			combinator = ' '
+		default:
+			return c, nil
+		}
+		c.combinators = append(c.combinators, combinator)
+	}
+}
+
+func (p *selectorParser) compound() (cssMatcher, error) {
+	var matchers []cssMatcher
+	start := p.pos
+	if p.startsName() || p.peek() == '*' || p.peek() == '|' {
+		m, err := p.typeSelector()
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+
+	for {
+		var m cssMatcher
+		var err error
+		switch p.peek() {
+		case '#':
+			p.pos++
+			m, err = p.attrWord("id", "=")
+		case '.':
+			p.pos++
+			m, err = p.attrWord("class", "~=")
+		case '[':
+			p.pos++
+			m, err = p.attribute()
+		case ':':
+			p.pos++
+			m, err = p.pseudo()
+		default:
+			if p.pos == start {
+				return nil, p.unexpected()
+			}
+			return func(n, scope *navNode) bool {
+				for _, m := range matchers {
+					if !m(n, scope) {
+						return false
+					}
+				}
+				return true
+			}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+}
+
+func (p *selectorParser) startsName() bool {
+	if p.pos >= len(p.src) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+	return r == '_' || r == '\\' || r == '-' || unicode.IsLetter(r)
+}
+
+// name reads an identifier, undoing any escapes in it.
+func (p *selectorParser) name() (string, error) {
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		switch {
+		case r == '\\':
+			p.pos++
+			if p.pos >= len(p.src) {
+				return "", p.unexpected()
+			}
+			r, size = utf8.DecodeRuneInString(p.src[p.pos:])
+		case r != '_' && r != '-' && !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			return sb.String(), nil
+		}
+		sb.WriteRune(r)
+		p.pos += size
+	}
+	return sb.String(), nil
+}
+
+// qualifiedName reads a name with an optional namespace in front of it,
+// giving a nil namespace when any will do. A '*' for the name gives "".
+func (p *selectorParser) qualifiedName() (*string, string, error) {
+	readPart := func() (string, error) {
+		if p.peek() == '*' {
+			p.pos++
+			return "*", nil
+		}
+		if !p.startsName() {
+			return "", p.unexpected()
+		}
+		return p.name()
+	}
+
+	start := p.pos
+	var first string
+	if p.peek() != '|' {
+		var err error
+		first, err = readPart()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if p.peek() != '|' || strings.HasPrefix(p.src[p.pos:], "|=") {
+		if first == "*" {
+			first = ""
+		}
+		return nil, first, nil
+	}
+
+	p.pos++
+	local, err := readPart()
+	if err != nil {
+		return nil, "", err
+	}
+	if local == "*" {
+		local = ""
+	}
+	var space string
+	switch first {
+	case "*":
+		return nil, local, nil
+	case "":
+	default:
+		uri, ok := p.doc.lookupPrefix(first)
+		if !ok {
+			return nil, "", p.errorf(start, "unknown namespace prefix '%s'", first)
+		}
+		space = uri
+	}
+	return &space, local, nil
+}
+
+func (p *selectorParser) typeSelector() (cssMatcher, error) {
+	space, name, err := p.qualifiedName()
+	if err != nil {
+		return nil, err
+	}
+	return func(n, scope *navNode) bool {
+		if space != nil && n.node.Namespace != *space {
+			return false
+		}
+		switch {
+		case name == "":
+			return true
+		case strings.Contains(name, ":"):
+			return n.node.Name == name
+		}
+		return n.node.Local() == name
+	}, nil
+}
+
+// attrWord reads the name after # or . and matches it against an
+// attribute.
+func (p *selectorParser) attrWord(key, op string) (cssMatcher, error) {
+	if !p.startsName() {
+		return nil, p.unexpected()
+	}
+	word, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	test := attrOperators[op]
+	return func(n, scope *navNode) bool {
+		for _, a := range n.node.Attributes {
+			if a.Key == key && test(a.Value, word) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+var attrOperators = map[string]func(value, want string) bool{
+	"=":  func(value, want string) bool { return value == want },
+	"^=": func(value, want string) bool { return want != "" && strings.HasPrefix(value, want) },
+	"$=": func(value, want string) bool { return want != "" && strings.HasSuffix(value, want) },
+	"*=": func(value, want string) bool { return want != "" && strings.Contains(value, want) },
+	"~=": func(value, want string) bool {
+		return want != "" && !strings.ContainsAny(want, " \t\r\n") && slices.Contains(strings.Fields(value), want)
+	},
+	"|=": func(value, want string) bool { return value == want || strings.HasPrefix(value, want+"-") },
+}
+
+// attribute reads the rest of an attribute selector after the '['.
+// Without a namespace the name matches the attribute's key as written.
+func (p *selectorParser) attribute() (cssMatcher, error) {
+	p.skipSpace()
+	space, name, err := p.qualifiedName()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, p.errorf(p.pos-1, "expected an attribute name")
+	}
+	p.skipSpace()
+
+	var op, want string
+	if p.peek() != ']' {
+		opPos := p.pos
+		for len(op) < 2 && p.pos < len(p.src) && strings.IndexByte("=^$*~|", p.src[p.pos]) >= 0 {
+			op += p.src[p.pos : p.pos+1]
+			p.pos++
+			if op[len(op)-1] == '=' {
+				break
+			}
+		}
+		if attrOperators[op] == nil {
+			p.pos = opPos
+			return nil, p.unexpected()
+		}
+		p.skipSpace()
+		if want, err = p.value(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(']'); err != nil {
+		return nil, err
+	}
+
+	test := attrOperators[op]
+	return func(n, scope *navNode) bool {
+		for _, a := range n.node.Attributes {
+			if a.Namespace == XMLNSNamespace {
+				continue
+			}
+			switch {
+			case space == nil && a.Key != name:
+				continue
+			case space != nil && (a.Namespace != *space || a.Local() != name):
+				continue
+			}
+			if test == nil || test(a.Value, want) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// value reads an attribute value, either quoted or as a bare name.
+func (p *selectorParser) value() (string, error) {
+	quote := p.peek()
+	if quote != '"' && quote != '\'' {
+		if !p.startsName() && !isDigit(p.peek()) {
+			return "", p.unexpected()
+		}
+		return p.name()
+	}
+	start := p.pos
+	p.pos++
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch c {
+		case quote:
+			p.pos++
+			return sb.String(), nil
+		case '\\':
+			p.pos++
+			if p.pos >= len(p.src) {
+				continue
+			}
+			c = p.src[p.pos]
+		}
+		sb.WriteByte(c)
+		p.pos++
+	}
+	return "", p.errorf(start, "unterminated string")
+}
+
+func (p *selectorParser) pseudo() (cssMatcher, error) {
+	start := p.pos - 1
+	if !p.startsName() {
+		return nil, p.unexpected()
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(name) {
+	case "first-child":
+		return nthChild(0, 1, false), nil
+	case "last-child":
+		return nthChild(0, 1, true), nil
+	case "nth-child", "nth-last-child":
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		argPos := p.pos
+		end := strings.IndexByte(p.src[p.pos:], ')')
+		if end < 0 {
+			p.pos = len(p.src)
+			return nil, p.unexpected()
+		}
+		a, b, ok := parseNth(p.src[p.pos : p.pos+end])
+		if !ok {
+			return nil, p.errorf(argPos, "bad argument to :%s()", name)
+		}
+		p.pos += end + 1
+		return nthChild(a, b, name == "nth-last-child"), nil
+	case "not", "has":
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		list, err := p.list(name == "has")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+		if name == "not" {
+			return func(n, scope *navNode) bool { return !list.matches(n, scope) }, nil
+		}
+		return func(n, scope *navNode) bool {
+			// Whatever a relative selector can reach is below n's parent
+			for _, m := range descendants(n.parent, nil) {
+				if m.kind == elementNav && m != n && list.matches(m, n) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	return nil, p.errorf(start, "unknown pseudo-class ':%s'", name)
+}
+
+// nthChild matches elements whose position among their element siblings
+// is a*k+b for some k >= 0, counting from the end when fromEnd is set.
+func nthChild(a, b int, fromEnd bool) cssMatcher {
+	return func(n, scope *navNode) bool {
+		siblings := elementSiblings(n)
+		pos := indexOf(siblings, n) + 1
+		if fromEnd {
+			pos = len(siblings) - pos + 1
+		}
+		if a == 0 {
+			return pos == b
+		}
+		k := pos - b
+		return k%a == 0 && k/a >= 0
+	}
+}
+
+// parseNth reads the an+b argument of :nth-child(), along with odd and
+// even.
+func parseNth(s string) (int, int, bool) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	switch s {
+	case "odd":
+		return 2, 1, true
+	case "even":
+		return 2, 0, true
+	}
+	before, after, found := strings.Cut(s, "n")
+	if !found {
+		b, err := strconv.Atoi(s)
+		return 0, b, err == nil
+	}
+
+	var a int
+	switch before {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		var err error
+		if a, err = strconv.Atoi(before); err != nil {
+			return 0, 0, false
+		}
+	}
+	if after == "" {
+		return a, 0, true
+	}
+	if after[0] != '+' && after[0] != '-' {
+		return 0, 0, false
+	}
+	b, err := strconv.Atoi(after)
+	return a, b, err == nil
+}
@@ -0,0 +1,107 @@
+package xmlparser
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const selectXML = `<rss xmlns:itunes="urn:itunes">
+	<channel>
+		<title>Feed</title>
+		<item id="a" class="new featured"><title>One</title><enclosure type="audio/mpeg" url="https://x/1.mp3"/></item>
+		<item id="b"><title>Two</title><enclosure type="video/mp4" url="http://x/2.mp4"/></item>
+		<item id="c" lang="en-GB"><title>Three</title><itunes:duration>30</itunes:duration></item>
+		<link>https://x</link>
+	</channel>
+</rss>`
+
+func TestSelect(t *testing.T) {
+	root, err := Parse(selectXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		selector string
+		want     []string
+	}{
+		{"channel > item enclosure[type^=audio]", []string{`<enclosure type="audio/mpeg" url="https://x/1.mp3"/>`}},
+		{"item > title", []string{"<title>One</title>", "<title>Two</title>", "<title>Three</title>"}},
+		{"rss > title", nil},
+		{"rss title:first-child", []string{"<title>Feed</title>", "<title>One</title>", "<title>Two</title>", "<title>Three</title>"}},
+		{"channel > title + item title", []string{"<title>One</title>"}},
+		{"channel > title ~ link", []string{"<link>https://x</link>"}},
+		{"[url$='.mp4']", []string{`<enclosure type="video/mp4" url="http://x/2.mp4"/>`}},
+		{"[url*=x]", []string{`<enclosure type="audio/mpeg" url="https://x/1.mp3"/>`, `<enclosure type="video/mp4" url="http://x/2.mp4"/>`}},
+		{"item[class~=featured] > title", []string{"<title>One</title>"}},
+		{"item[class~=feat] > title", nil},
+		{"item.new > title, #c > title", []string{"<title>One</title>", "<title>Three</title>"}},
+		{"item[lang|=en] > title", []string{"<title>Three</title>"}},
+		{"item[id=\"b\"] > title", []string{"<title>Two</title>"}},
+		{"channel > :nth-child(2n+1)", []string{"<title>Feed</title>", `<item id="b"><title>Two</title><enclosure type="video/mp4" url="http://x/2.mp4"/></item>`, "<link>https://x</link>"}},
+		{"channel > item:nth-child(even) > title", []string{"<title>One</title>", "<title>Three</title>"}},
+		{"channel > item:nth-child(3) > title", []string{"<title>Two</title>"}},
+		{"channel > :nth-last-child(1)", []string{"<link>https://x</link>"}},
+		{"channel > :last-child", []string{"<link>https://x</link>"}},
+		{"item:not(#a, #b) > title", []string{"<title>Three</title>"}},
+		{"item:has(enclosure) > title", []string{"<title>One</title>", "<title>Two</title>"}},
+		{"item:has(> title + enclosure[type^=video]) > title", []string{"<title>Two</title>"}},
+		{"title:has(+ enclosure)", []string{"<title>One</title>", "<title>Two</title>"}},
+		{"channel:has(duration) > title", []string{"<title>Feed</title>"}},
+		{"itunes|duration", []string{"<itunes:duration>30</itunes:duration>"}},
+		{"itunes\\:duration", []string{"<itunes:duration>30</itunes:duration>"}},
+		{"|duration", nil},
+		{"*|duration", []string{"<itunes:duration>30</itunes:duration>"}},
+		{"rss", []string{printNodes([]XmlNode{root})[0]}},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			got, err := root.Select(tst.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tst.want, printNodes(got)); diff != "" {
+				t.Errorf("%s: %s", tst.selector, diff)
+			}
+		})
+	}
+}
+
+func TestSelectErrors(t *testing.T) {
+	root, err := Parse(selectXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		selector string
+		want     string
+	}{
+		{"", "selector '' at 1: unexpected end of selector"},
+		{"item >", "selector 'item >' at 7: unexpected end of selector"},
+		{"item, ", "selector 'item, ' at 7: unexpected end of selector"},
+		{"item[id", "selector 'item[id' at 8: unexpected end of selector"},
+		{"item[id!=a]", "selector 'item[id!=a]' at 8: unexpected '!'"},
+		{"item[id='a]", "selector 'item[id='a]' at 9: unterminated string"},
+		{"item:hover", "selector 'item:hover' at 5: unknown pseudo-class ':hover'"},
+		{"item:nth-child(2x)", "selector 'item:nth-child(2x)' at 16: bad argument to :nth-child()"},
+		{"item:not(a", "selector 'item:not(a' at 11: unexpected end of selector"},
+		{"media|content", "selector 'media|content' at 1: unknown namespace prefix 'media'"},
+		{"item)", "selector 'item)' at 5: unexpected ')'"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := root.Select(tst.selector)
+			if err == nil {
+				t.Fatal("wanted an error but got none")
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,461 @@
+package xmlparser
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// StreamElements calls fn with each element in r that matches path,
+// building only those elements into trees. A path is a list of element
+// names separated by "/" for a child or "//" for any descendant, such as
+// "/rss/channel/item" or "//record". A path that does not start with "/"
+// can start at any depth, so "item" is the same as "//item". A name of
+// "*" matches any element.
+//
+// Once an element matches its subtree is handed to fn whole, so elements
+// nested inside it are not matched separately. Returning an error from fn
+// stops the stream and that error is returned.
+func StreamElements(r io.Reader, path string, fn func(XmlNode) error) error {
+	steps, err := parseElementPath(path)
+	if err != nil {
+		return err
+	}
+
+	d := NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := tok.(StartElement)
+		if !ok || !matchElementPath(steps, d.p.stack) {
+			continue
+		}
+
+		node, err := d.element(start)
+		if err != nil {
+			return err
+		}
+		err = fn(node)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type pathStep struct {
+	name       string
+	descendant bool
+}
+
+func parseElementPath(path string) ([]pathStep, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty element path")
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "//" + path
+	}
+
+	var steps []pathStep
+	for path != "" {
+		step := pathStep{}
+		if strings.HasPrefix(path, "//") {
+			step.descendant = true
+			path = path[2:]
+		} else {
+			path = path[1:]
+		}
+
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		step.name = path[:end]
+		path = path[end:]
+		if step.name == "" {
+			return nil, fmt.Errorf("empty step in element path")
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// matchElementPath reports whether the element at the top of stack, with
+// its ancestors below it, is selected by steps.
+func matchElementPath(steps []pathStep, stack []string) bool {
+	if len(steps) == 0 {
+		return len(stack) == 0
+	}
+	if len(stack) == 0 {
+		return false
+	}
+
+	last := steps[len(steps)-1]
+	name := stack[len(stack)-1]
+	if last.name != "*" && last.name != name {
+		return false
+	}
+
+	rest, ancestors := steps[:len(steps)-1], stack[:len(stack)-1]
+	if !last.descendant {
+		return matchElementPath(rest, ancestors)
+	}
+	for i := len(ancestors); i >= 0; i-- {
+		if matchElementPath(rest, ancestors[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamStep is a step of a Path that can be matched as tokens arrive.
+// kind is elementNav, attributeNav or textNav, and descendant is set when
+// the step can be taken from any descendant of its context rather than
+// only its children.
+type streamStep struct {
+	kind       navKind
+	test       nodeTest
+	descendant bool
+	predicates []streamPredicate
+}
+
+// streamPredicate is [n] when position is set, and otherwise tests for an
+// attribute, or compares its value when op is "=" or "!=".
+type streamPredicate struct {
+	position int
+	attr     nodeTest
+	op       string
+	value    string
+}
+
+// Stream matches the path against the tokens in d in a single pass,
+// calling fn with each element it selects, built into a tree, and with
+// each attribute or run of text. Paths are limited to child and
+// descendant steps, such as //item/enclosure/@url, with predicates of
+// the form [n], [@a] and [@a = 'v']. Other paths give a *PathError.
+//
+// A relative path starts from the root element. Prefixes are resolved as
+// for QueryNS, except that a prefix not bound when compiling means what
+// it is declared to mean where it is used. As with StreamElements,
+// elements nested inside one that is selected are not matched
+// separately, and text that is only whitespace is skipped.
+func (p *Path) Stream(d *Decoder, fn func(XmlNode) error) error {
+	path, steps, err := p.streamSteps()
+	if err != nil {
+		return err
+	}
+	m := &streamMatcher{steps: steps, namespaces: p.namespaces, d: d}
+	last := len(steps) - 1
+
+	doc := &streamFrame{}
+	if path.absolute {
+		doc.contexts = []int{0}
+	}
+	stack := []*streamFrame{doc}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		top := stack[len(stack)-1]
+		switch tok := tok.(type) {
+		case StartElement:
+			var frame *streamFrame
+			selected := false
+			if len(stack) == 1 && !path.absolute {
+				frame = &streamFrame{contexts: []int{0}}
+			} else {
+				frame, selected = m.open(top, tok)
+			}
+
+			if selected {
+				node, err := d.element(tok)
+				if err == nil {
+					err = fn(node)
+				}
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if steps[last].kind == attributeNav && m.active(frame, last) {
+				for _, a := range tok.Attributes {
+					if a.Namespace == XMLNSNamespace || !m.matches(steps[last].test, a.Namespace, a.Local()) {
+						continue
+					}
+					if err := fn(attributeNode(a)); err != nil {
+						return err
+					}
+				}
+			}
+			stack = append(stack, frame)
+
+		case EndElement:
+			stack = stack[:len(stack)-1]
+
+		case CharData:
+			if len(stack) == 1 || steps[last].kind != textNav || !m.active(top, last) || !tok.CData && strings.TrimSpace(tok.Text) == "" {
+				continue
+			}
+			text := XmlNode{Type: TextNode, Contents: tok.Text, Span: tok.Span}
+			if tok.CData {
+				text.Type = CDataNode
+			}
+			if err := fn(text); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *Path) streamErrorf(pos int, format string, args ...any) *PathError {
+	return &PathError{p.source, pos, "cannot be streamed: " + fmt.Sprintf(format, args...)}
+}
+
+// streamSteps works out the steps of the path for Stream, or why it cannot
+// be streamed.
+func (p *Path) streamSteps() (*pathExpr, []streamStep, error) {
+	path, ok := p.expr.(*pathExpr)
+	if !ok || path.filter != nil {
+		return nil, nil, p.streamErrorf(0, "only a location path can be")
+	}
+
+	var steps []streamStep
+	descendant := false
+	for i, s := range path.steps {
+		switch {
+		case s.axis == descendantOrSelfAxis && s.test.kind == typeTest && s.test.node == rootNav && len(s.predicates) == 0:
+			// The // between two steps
+			descendant = true
+			continue
+		case s.axis == selfAxis && s.test.kind == typeTest && s.test.node == rootNav && len(s.predicates) == 0:
+			continue
+		}
+
+		st := streamStep{kind: elementNav, test: s.test, descendant: descendant}
+		descendant = false
+		switch s.axis {
+		case childAxis:
+		case descendantAxis:
+			st.descendant = true
+		case attributeAxis:
+			st.kind = attributeNav
+		default:
+			return nil, nil, p.streamErrorf(path.pos, "the %s axis can only be used on the tree", axisName(s.axis))
+		}
+
+		if s.test.kind == typeTest {
+			if s.test.node != textNav || s.axis == attributeAxis {
+				return nil, nil, p.streamErrorf(path.pos, "only text() can be used as a node type test")
+			}
+			st.kind = textNav
+		}
+		if st.kind != elementNav && i < len(path.steps)-1 {
+			return nil, nil, p.streamErrorf(path.pos, "attributes and text can only be selected by the last step")
+		}
+		if st.kind != elementNav && len(s.predicates) > 0 {
+			return nil, nil, p.streamErrorf(path.pos, "only elements can be filtered")
+		}
+
+		for _, e := range s.predicates {
+			pred, ok := streamPredicateOf(e)
+			if !ok {
+				return nil, nil, p.streamErrorf(path.pos, "predicates can only be [n], [@a] or [@a = 'v']")
+			}
+			if pred.position > 0 && s.axis == descendantAxis {
+				return nil, nil, p.streamErrorf(path.pos, "positions can only be counted among children")
+			}
+			st.predicates = append(st.predicates, pred)
+		}
+		steps = append(steps, st)
+	}
+	if len(steps) == 0 {
+		return nil, nil, p.streamErrorf(path.pos, "the path selects no elements")
+	}
+	return path, steps, nil
+}
+
+func axisName(a axis) string {
+	for name, b := range axes {
+		if a == b {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+func streamPredicateOf(e xpathExpr) (streamPredicate, bool) {
+	switch e := e.(type) {
+	case *literalExpr:
+		n, ok := e.value.(float64)
+		if !ok || n < 1 || n != float64(int(n)) {
+			return streamPredicate{}, false
+		}
+		return streamPredicate{position: int(n)}, true
+	case *pathExpr:
+		attr, ok := attributeTest(e)
+		return streamPredicate{attr: attr}, ok
+	case *binaryExpr:
+		if e.op != "=" && e.op != "!=" {
+			return streamPredicate{}, false
+		}
+		path, lit := e.left, e.right
+		if _, ok := path.(*literalExpr); ok {
+			path, lit = lit, path
+		}
+		attr, ok := attributeTest(path)
+		value, isString := lit.(*literalExpr)
+		if !ok || !isString {
+			return streamPredicate{}, false
+		}
+		s, ok := value.value.(string)
+		return streamPredicate{attr: attr, op: e.op, value: s}, ok
+	}
+	return streamPredicate{}, false
+}
+
+// attributeTest gives the name test of a path that is just @name.
+func attributeTest(e xpathExpr) (nodeTest, bool) {
+	path, ok := e.(*pathExpr)
+	if !ok || path.absolute || path.filter != nil || len(path.steps) != 1 {
+		return nodeTest{}, false
+	}
+	s := path.steps[0]
+	if s.axis != attributeAxis || s.test.kind == typeTest || len(s.predicates) > 0 {
+		return nodeTest{}, false
+	}
+	return s.test, true
+}
+
+// streamFrame is what is known about an open element. contexts holds the
+// steps it is the context node for, and pending the descendant steps
+// that can be taken from it because of an ancestor. counts keeps how many
+// children have reached each positional predicate.
+type streamFrame struct {
+	contexts []int
+	pending  []int
+	counts   map[[2]int]int
+}
+
+type streamMatcher struct {
+	steps      []streamStep
+	namespaces map[string]string
+	d          *Decoder
+}
+
+// open works out the frame of an element that has just started under
+// parent, and whether the element is selected by the last step.
+func (m *streamMatcher) open(parent *streamFrame, start StartElement) (*streamFrame, bool) {
+	frame := &streamFrame{}
+	selected := false
+	for _, i := range mergeSteps(parent.contexts, parent.pending) {
+		s := m.steps[i]
+		if s.descendant {
+			frame.pending = appendNew(frame.pending, i)
+		}
+		if s.kind != elementNav || !m.matchElement(parent, i, start) {
+			continue
+		}
+		if i == len(m.steps)-1 {
+			selected = true
+		} else {
+			frame.contexts = appendNew(frame.contexts, i+1)
+		}
+	}
+	return frame, selected
+}
+
+// active reports whether step i can be taken from the element of frame.
+func (m *streamMatcher) active(frame *streamFrame, i int) bool {
+	return slices.Contains(frame.contexts, i) || m.steps[i].descendant && slices.Contains(frame.pending, i)
+}
+
+func (m *streamMatcher) matchElement(parent *streamFrame, i int, start StartElement) bool {
+	s := m.steps[i]
+	if !m.matches(s.test, start.Namespace, start.Local()) {
+		return false
+	}
+	for j, pred := range s.predicates {
+		if pred.position == 0 {
+			if !m.matchAttribute(pred, start.Attributes) {
+				return false
+			}
+			continue
+		}
+		if parent.counts == nil {
+			parent.counts = map[[2]int]int{}
+		}
+		key := [2]int{i, j}
+		parent.counts[key]++
+		if parent.counts[key] != pred.position {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *streamMatcher) matchAttribute(pred streamPredicate, attrs []Attribute) bool {
+	for _, a := range attrs {
+		if a.Namespace == XMLNSNamespace || !m.matches(pred.attr, a.Namespace, a.Local()) {
+			continue
+		}
+		switch pred.op {
+		case "":
+			return true
+		case "=":
+			if a.Value == pred.value {
+				return true
+			}
+		case "!=":
+			if a.Value != pred.value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches reports whether a name passes test, resolving its prefix
+// against the bindings of the path and then those in scope.
+func (m *streamMatcher) matches(test nodeTest, space, local string) bool {
+	if test.kind == anyNameTest {
+		return true
+	}
+	uri := ""
+	if test.prefix != "" {
+		var ok bool
+		uri, ok = m.namespaces[test.prefix]
+		if !ok {
+			uri, ok = m.d.p.lookupNamespace(test.prefix)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return space == uri && (test.kind == prefixTest || local == test.local)
+}
+
+func mergeSteps(a, b []int) []int {
+	out := slices.Clone(a)
+	for _, i := range b {
+		out = appendNew(out, i)
+	}
+	return out
+}
+
+func appendNew(s []int, i int) []int {
+	if slices.Contains(s, i) {
+		return s
+	}
+	return append(s, i)
+}
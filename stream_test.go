@@ -0,0 +1,229 @@
+package xmlparser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+const streamInput = `<?xml version="1.0"?>
+<rss>
+	<channel>
+		<title>Feed</title>
+		<item><title>One</title></item>
+		<item><title>Two</title><item><title>Nested</title></item></item>
+		<extra><item><title>Elsewhere</title></item></extra>
+	</channel>
+</rss>`
+
+func TestStreamElements(t *testing.T) {
+	table := []struct {
+		path string
+		want []string
+	}{
+		{"/rss/channel/item", []string{"One", "Two"}},
+		{"item", []string{"One", "Two", "Elsewhere"}},
+		{"//extra//item", []string{"Elsewhere"}},
+		{"/rss/*/title", []string{"Feed"}},
+		{"channel/title", []string{"Feed"}},
+		{"/channel/item", nil},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			var got []string
+			err := StreamElements(strings.NewReader(streamInput), tst.path, func(node XmlNode) error {
+				if node.Name == "title" {
+					got = append(got, node.Contents)
+				} else {
+					got = append(got, node.Children[0].Contents)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("failed on path '%v'. %v.", tst.path, err)
+			}
+			if diff := cmp.Diff(tst.want, got); diff != "" {
+				t.Fatalf("failed on path '%v' with diff '%v'", tst.path, diff)
+			}
+		})
+	}
+}
+
+func TestStreamElementsBuildsSubtrees(t *testing.T) {
+	var got []XmlNode
+	err := StreamElements(strings.NewReader(streamInput), "/rss/channel/item", func(node XmlNode) error {
+		got = append(got, node)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := XmlNode{
+		Name: "item",
+		Children: []XmlNode{
+			{Name: "title", Contents: "Two"},
+			{Name: "item", Children: []XmlNode{{Name: "title", Contents: "Nested"}}},
+		},
+	}
+	if diff := cmp.Diff(want, got[1], cmpopts.EquateEmpty(), cmpopts.IgnoreTypes(Span{})); diff != "" {
+		t.Fatalf("wrong subtree with diff '%v'", diff)
+	}
+}
+
+func TestStreamElementsErrors(t *testing.T) {
+	stop := errors.New("seen enough")
+	calls := 0
+	err := StreamElements(strings.NewReader(streamInput), "item", func(node XmlNode) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("wanted to stop after one call but got %v after %d", err, calls)
+	}
+
+	err = StreamElements(strings.NewReader(`<rss><item><title>cut short`), "item", func(node XmlNode) error {
+		t.Fatal("did not want an unfinished element")
+		return nil
+	})
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("wanted a SyntaxError but got %v", err)
+	}
+
+	for _, path := range []string{"", "/", "/rss//", "a///b"} {
+		err = StreamElements(strings.NewReader(streamInput), path, func(node XmlNode) error { return nil })
+		if err == nil {
+			t.Fatalf("wanted an error for path '%v'", path)
+		}
+	}
+}
+
+const streamFeed = `<rss xmlns:itunes="urn:itunes">
+	<channel>
+		<title>Feed</title>
+		<item id="a"><title>One</title><enclosure url="1.mp3" type="audio/mpeg"/></item>
+		<item id="b" draft="yes"><title>Two</title><itunes:duration>60</itunes:duration></item>
+		<item id="c"><title><![CDATA[Three]]></title><enclosure url="3.mp4" type="video/mp4"/></item>
+		<extra><item id="d"><title>Four</title></item></extra>
+	</channel>
+</rss>`
+
+func TestPathStream(t *testing.T) {
+	root, err := Parse(streamFeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		expr string
+		want []string
+	}{
+		{"//item/enclosure/@url", []string{`url="1.mp3"`, `url="3.mp4"`}},
+		{"/rss/channel/item/title", []string{"<title>One</title>", "<title>Two</title>", "<title><![CDATA[Three]]></title>"}},
+		{"channel/item[2]/title/text()", []string{"Two"}},
+		{"//item[@draft]/@id", []string{`id="b"`}},
+		{"//item[@id != 'a'][1]/title", []string{"<title>Two</title>", "<title>Four</title>"}},
+		{"//item[2][@draft = 'yes']/@id", []string{`id="b"`}},
+		{"//item[1][@draft]/@id", nil},
+		{"//enclosure[@type = 'video/mp4']/@url", []string{`url="3.mp4"`}},
+		{"//itunes:duration/text()", []string{"60"}},
+		{"channel/descendant::title/text()", []string{"Feed", "One", "Two", "<![CDATA[Three]]>", "Four"}},
+		{".//extra//title", []string{"<title>Four</title>"}},
+		{"//@id", []string{`id="a"`, `id="b"`, `id="c"`, `id="d"`}},
+		{"/rss/channel/*[3]/@*", []string{`id="b"`, `draft="yes"`}},
+		{"//item[3]//text()", []string{"<![CDATA[Three]]>"}},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			p, err := CompilePath(tst.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []XmlNode
+			err = p.Stream(NewDecoder(strings.NewReader(streamFeed)), func(node XmlNode) error {
+				got = append(got, node)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tst.want, printNodes(got)); diff != "" {
+				t.Errorf("%s: %s", tst.expr, diff)
+			}
+			fromTree, err := p.Query(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(printNodes(fromTree), printNodes(got)); diff != "" {
+				t.Errorf("%s: streamed differently to the tree: %s", tst.expr, diff)
+			}
+		})
+	}
+}
+
+func TestPathStreamStops(t *testing.T) {
+	p, err := CompilePath("//item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := errors.New("stop")
+	calls := 0
+	err = p.Stream(NewDecoder(strings.NewReader(streamFeed)), func(node XmlNode) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("wanted to stop after one call but got %d calls and %v", calls, err)
+	}
+
+	err = p.Stream(NewDecoder(strings.NewReader(`<rss><item><title>One</title>`)), func(node XmlNode) error {
+		return nil
+	})
+	want := "1:30: at end of input but 'item' is still open (in /rss/item)"
+	if err == nil || err.Error() != want {
+		t.Errorf("wanted %s but got %v", want, err)
+	}
+}
+
+func TestPathStreamErrors(t *testing.T) {
+	table := []struct {
+		expr string
+		want string
+	}{
+		{"count(//item)", "xpath 'count(//item)' at 1: cannot be streamed: only a location path can be"},
+		{"//item/..", "xpath '//item/..' at 1: cannot be streamed: the parent axis can only be used on the tree"},
+		{"//item/following-sibling::item", "xpath '//item/following-sibling::item' at 1: cannot be streamed: the following-sibling axis can only be used on the tree"},
+		{"//item[last()]", "xpath '//item[last()]' at 1: cannot be streamed: predicates can only be [n], [@a] or [@a = 'v']"},
+		{"//item[title]", "xpath '//item[title]' at 1: cannot be streamed: predicates can only be [n], [@a] or [@a = 'v']"},
+		{"//item/descendant::title[1]", "xpath '//item/descendant::title[1]' at 1: cannot be streamed: positions can only be counted among children"},
+		{"//@id/..", "xpath '//@id/..' at 1: cannot be streamed: attributes and text can only be selected by the last step"},
+		{"//@id/text()", "xpath '//@id/text()' at 1: cannot be streamed: attributes and text can only be selected by the last step"},
+		{"//item/comment()", "xpath '//item/comment()' at 1: cannot be streamed: only text() can be used as a node type test"},
+		{"//text()[1]", "xpath '//text()[1]' at 1: cannot be streamed: only elements can be filtered"},
+		{"/", "xpath '/' at 1: cannot be streamed: the path selects no elements"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			p, err := CompilePath(tst.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = p.Stream(NewDecoder(strings.NewReader(streamFeed)), func(node XmlNode) error {
+				return nil
+			})
+			if err == nil {
+				t.Fatal("wanted an error but got none")
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package tokeniser
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"strings"
-	"unicode"
 )
 
 //go:generate stringer -type=TokenType
@@ -19,103 +21,267 @@ const (
 	ProcLB
 	ProcRB
 	SelfRB
+	Comment
+	CData
+	Doctype
+	ProcInst
+	EOF // never produced by Tokenise, used to report running out of input
 )
 
+// Position is a location in the input. Line and Col count from 1, with
+// Col counted in characters rather than bytes.
+type Position struct {
+	Offset int
+	Line   int
+	Col    int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
 type Token struct {
 	T   TokenType
 	Val string
+	Pos Position
+	End Position
+}
+
+type Error struct {
+	Pos Position
+	Msg string
 }
 
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %s", e.Pos, e.Msg)
+}
+
+// Tokeniser splits XML into tokens. When reading from an io.Reader
+// input only holds a window of the document, and the bytes already
+// tokenised are dropped once they make up half of it. Quotes, '=' and
+// '>' are only split out inside a tag; in text they are plain characters.
 type Tokeniser struct {
-	Input string
+	input []byte
 	curr  int
 	l     int
+	line  int
+	col   int
+	base  int
+	r     io.Reader
+	err   error
+	chunk []byte
+	inTag bool
 }
 
+const chunkSize = 64 * 1024
+
 func NewTokeniser(input string) Tokeniser {
 	return Tokeniser{
-		input,
+		[]byte(input),
 		0,
 		len(input),
+		1,
+		1,
+		0,
+		nil,
+		nil,
+		nil,
+		false,
 	}
 }
 
+func NewReaderTokeniser(r io.Reader) Tokeniser {
+	t := NewTokeniser("")
+	t.r = r
+	return t
+}
+
 func (t *Tokeniser) Tokenise() ([]Token, error) {
 	var tokens []Token
-	for t.curr < t.l {
-		switch t.Input[t.curr] {
-		case ' ', '\n', '\t':
-			token, err := t.getWhitespace()
-			if err != nil {
-				return tokens, err
-			}
-			tokens = append(tokens, token)
-		case '<':
-			if t.curr+1 < t.l {
-				switch t.Input[t.curr+1] {
-				case '/':
-					tokens = append(tokens, Token{CloB, "</"})
-					t.curr += 2
-				case '?':
-					tokens = append(tokens, Token{ProcLB, "<?"})
-					t.curr += 2
-				default:
-					tokens = append(tokens, Token{LB, "<"})
-					t.curr++
-				}
-			} else {
-				tokens = append(tokens, Token{LB, "<"})
-				t.curr++
-			}
-		case '>':
-			tokens = append(tokens, Token{RB, ">"})
-			t.curr++
-		case '=':
-			tokens = append(tokens, Token{EQ, "="})
-			t.curr++
-		case '?':
-			if t.curr+1 < t.l && t.Input[t.curr+1] == '>' {
-				tokens = append(tokens, Token{ProcRB, "?>"})
-				t.curr += 2
-			} else {
-				tokens = append(tokens, Token{Keyword, "?"})
-				t.curr++
-			}
-		case '/':
-			if t.curr+1 < t.l && t.Input[t.curr+1] == '>' {
-				tokens = append(tokens, Token{SelfRB, "/>"})
-				t.curr += 2
-			} else {
-				tokens = append(tokens, Token{Keyword, "/"})
-				t.curr++
-			}
-		case '"':
-			token, err := t.getString()
-			if err != nil {
-				return tokens, err
-			}
-			tokens = append(tokens, token)
-		default:
-			keyword, err := t.getKeyword()
-			if err != nil {
-				return tokens, err
+	for {
+		token, err := t.Next()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+// Next returns the next token, or io.EOF once the input is used up.
+func (t *Tokeniser) Next() (Token, error) {
+	if !t.ensure(1) {
+		if t.err != nil {
+			return Token{}, t.err
+		}
+		return Token{}, io.EOF
+	}
+	start := t.pos()
+	token, err := t.next()
+	if t.err != nil {
+		return Token{}, t.err
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	token.Pos = start
+	token.End = t.pos()
+	return token, nil
+}
+
+// ensure tries to have at least n unread bytes in input, reading more
+// from the reader if there is one.
+func (t *Tokeniser) ensure(n int) bool {
+	for t.l-t.curr < n && t.r != nil {
+		t.read()
+	}
+	return t.l-t.curr >= n
+}
+
+func (t *Tokeniser) read() {
+	if t.chunk == nil {
+		t.chunk = make([]byte, chunkSize)
+	}
+	n, err := t.r.Read(t.chunk)
+	if t.curr > 0 && t.curr >= len(t.input)/2 {
+		t.base += t.curr
+		t.input = append(t.input[:0], t.input[t.curr:]...)
+		t.curr = 0
+	}
+	t.input = append(t.input, t.chunk[:n]...)
+	t.l = len(t.input)
+	if err == io.EOF {
+		t.r = nil
+	} else if err != nil {
+		t.r = nil
+		t.err = err
+	}
+}
+
+func (t *Tokeniser) hasPrefix(prefix string) bool {
+	return t.ensure(len(prefix)) && string(t.input[t.curr:t.curr+len(prefix)]) == prefix
+}
+
+func (t *Tokeniser) next() (Token, error) {
+	peek := t.input[t.curr]
+	if isSpace(peek) {
+		return t.getWhitespace()
+	}
+	if peek == '<' {
+		switch {
+		case t.hasPrefix("</"):
+			t.advance(2)
+			t.inTag = true
+			return Token{T: CloB, Val: "</"}, nil
+		case t.hasPrefix("<?"):
+			if !t.atDeclaration() {
+				return t.getProcInst()
 			}
-			tokens = append(tokens, keyword)
+			t.advance(2)
+			t.inTag = true
+			return Token{T: ProcLB, Val: "<?"}, nil
+		case t.hasPrefix("<!--"):
+			return t.getComment()
+		case t.hasPrefix("<![CDATA["):
+			return t.getCData()
+		case t.hasPrefix("<!DOCTYPE"):
+			return t.getDoctype()
+		}
+		t.advance(1)
+		t.inTag = true
+		return Token{T: LB, Val: "<"}, nil
+	}
+	if !t.inTag {
+		return t.getText()
+	}
+
+	switch peek {
+	case '>':
+		t.advance(1)
+		t.inTag = false
+		return Token{T: RB, Val: ">"}, nil
+	case '=':
+		t.advance(1)
+		return Token{T: EQ, Val: "="}, nil
+	case '?':
+		if t.hasPrefix("?>") {
+			t.advance(2)
+			t.inTag = false
+			return Token{T: ProcRB, Val: "?>"}, nil
+		}
+		t.advance(1)
+		return Token{T: Keyword, Val: "?"}, nil
+	case '/':
+		if t.hasPrefix("/>") {
+			t.advance(2)
+			t.inTag = false
+			return Token{T: SelfRB, Val: "/>"}, nil
 		}
+		t.advance(1)
+		return Token{T: Keyword, Val: "/"}, nil
+	case '"', '\'':
+		return t.getString()
+	default:
+		return t.getKeyword()
 	}
+}
+
+// isSpace reports whether b is one of the four whitespace characters XML
+// allows between tokens.
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
 
-	return tokens, nil
+func (t *Tokeniser) pos() Position {
+	return Position{t.base + t.curr, t.line, t.col}
+}
+
+func (t *Tokeniser) advance(n int) {
+	for i := 0; i < n && t.curr < t.l; i++ {
+		b := t.input[t.curr]
+		if b == '\n' {
+			t.line++
+			t.col = 1
+		} else if b&0xC0 != 0x80 {
+			// Continuation bytes of a multi-byte character share its column
+			t.col++
+		}
+		t.curr++
+	}
 }
 
 func (t *Tokeniser) getKeyword() (Token, error) {
 	var sb strings.Builder
-	for t.curr < t.l {
-		peek := t.Input[t.curr]
-		if peek == '>' || peek == ' ' || peek == '=' || peek == '<' {
+	for t.ensure(1) {
+		peek := t.input[t.curr]
+		if peek == '>' || peek == '=' || peek == '<' || isSpace(peek) {
 			break
 		}
-		sb.WriteByte(t.Input[t.curr])
-		t.curr++
+		if (peek == '/' || peek == '?') && t.hasPrefix(string(peek)+">") {
+			break
+		}
+		sb.WriteByte(t.input[t.curr])
+		t.advance(1)
+	}
+	return Token{
+		T:   Keyword,
+		Val: sb.String(),
+	}, nil
+}
+
+// getText reads a run of text outside a tag up to the next markup or
+// whitespace.
+func (t *Tokeniser) getText() (Token, error) {
+	var sb strings.Builder
+	for t.ensure(1) {
+		peek := t.input[t.curr]
+		if peek == '<' || isSpace(peek) {
+			break
+		}
+		sb.WriteByte(peek)
+		t.advance(1)
 	}
 	return Token{
 		T:   Keyword,
@@ -125,15 +291,16 @@ func (t *Tokeniser) getKeyword() (Token, error) {
 
 func (t *Tokeniser) getString() (Token, error) {
 	var sb strings.Builder
-	t.curr++ // eat the opening quotes
-	for t.curr < t.l {
-		peek := t.Input[t.curr]
-		if peek == '"' {
-			t.curr++
+	quote := t.input[t.curr]
+	t.advance(1) // eat the opening quote
+	for t.ensure(1) {
+		peek := t.input[t.curr]
+		if peek == quote {
+			t.advance(1)
 			break
 		}
-		sb.WriteByte(t.Input[t.curr])
-		t.curr++
+		sb.WriteByte(t.input[t.curr])
+		t.advance(1)
 	}
 	return Token{
 		T:   String,
@@ -141,15 +308,110 @@ func (t *Tokeniser) getString() (Token, error) {
 	}, nil
 }
 
+func (t *Tokeniser) getComment() (Token, error) {
+	return t.getDelimited(Comment, "<!--", "-->", "comment")
+}
+
+func (t *Tokeniser) getCData() (Token, error) {
+	return t.getDelimited(CData, "<![CDATA[", "]]>", "CDATA section")
+}
+
+// getProcInst reads a processing instruction other than the XML
+// declaration whole, giving everything between "<?" and "?>".
+func (t *Tokeniser) getProcInst() (Token, error) {
+	return t.getDelimited(ProcInst, "<?", "?>", "processing instruction")
+}
+
+// atDeclaration tells the XML declaration, whose pseudo-attributes are
+// split into tokens, from other processing instructions.
+func (t *Tokeniser) atDeclaration() bool {
+	if !t.ensure(len("<?xml")) || !strings.EqualFold(string(t.input[t.curr:t.curr+len("<?xml")]), "<?xml") {
+		return false
+	}
+	if !t.ensure(len("<?xml") + 1) {
+		return true
+	}
+	switch t.input[t.curr+len("<?xml")] {
+	case ' ', '\t', '\n', '\r', '?':
+		return true
+	}
+	return false
+}
+
+func (t *Tokeniser) getDelimited(tt TokenType, open, close, what string) (Token, error) {
+	start := t.pos()
+	t.advance(len(open))
+	searched := 0
+	for {
+		end := bytes.Index(t.input[t.curr+searched:], []byte(close))
+		if end >= 0 {
+			end += searched
+			val := string(t.input[t.curr : t.curr+end])
+			t.advance(end + len(close))
+			return Token{
+				T:   tt,
+				Val: val,
+			}, nil
+		}
+		// The closing delimiter might straddle what has been read so far
+		searched = max(0, t.l-t.curr-len(close)+1)
+		if !t.ensure(t.l - t.curr + 1) {
+			return Token{}, &Error{start, fmt.Sprintf("unterminated %s", what)}
+		}
+	}
+}
+
+// getDoctype reads a whole DOCTYPE declaration, giving everything between
+// "<!DOCTYPE" and its closing '>'. Quoted strings, comments and the
+// brackets of an internal subset can all hide a '>' that does not end it.
+func (t *Tokeniser) getDoctype() (Token, error) {
+	start := t.pos()
+	t.advance(len("<!DOCTYPE"))
+	var sb strings.Builder
+	var quote byte
+	depth := 0
+	for t.ensure(1) {
+		peek := t.input[t.curr]
+		switch {
+		case quote != 0:
+			if peek == quote {
+				quote = 0
+			}
+		case peek == '"' || peek == '\'':
+			quote = peek
+		case depth > 0 && t.hasPrefix("<!--"):
+			comment, err := t.getComment()
+			if err != nil {
+				return Token{}, err
+			}
+			sb.WriteString("<!--" + comment.Val + "-->")
+			continue
+		case peek == '[':
+			depth++
+		case peek == ']':
+			depth--
+		case peek == '>' && depth <= 0:
+			t.advance(1)
+			return Token{
+				T:   Doctype,
+				Val: sb.String(),
+			}, nil
+		}
+		sb.WriteByte(peek)
+		t.advance(1)
+	}
+	return Token{}, &Error{start, "unterminated DOCTYPE declaration"}
+}
+
 func (t *Tokeniser) getWhitespace() (Token, error) {
 	var sb strings.Builder
-	for t.curr < t.l {
-		peek := t.Input[t.curr]
-		if !unicode.IsSpace(rune(peek)) {
+	for t.ensure(1) {
+		peek := t.input[t.curr]
+		if !isSpace(peek) {
 			break
 		}
-		sb.WriteByte(t.Input[t.curr])
-		t.curr++
+		sb.WriteByte(t.input[t.curr])
+		t.advance(1)
 	}
 	return Token{
 		T:   Whitespace,
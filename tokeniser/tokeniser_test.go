@@ -1,10 +1,15 @@
 package tokeniser
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 func TestTokenise(t *testing.T) {
@@ -125,8 +130,7 @@ func TestTokenise(t *testing.T) {
 				{T: Keyword, Val: "foo"},
 				{T: RB, Val: ">"},
 
-				{T: String, Val: "problem"},
-				{T: Keyword, Val: "?"},
+				{T: Keyword, Val: `"problem"?`},
 				{T: Whitespace, Val: " "},
 				{T: Keyword, Val: "no"},
 
@@ -166,15 +170,107 @@ func TestTokenise(t *testing.T) {
 				{T: Keyword, Val: "url"},
 				{T: RB, Val: ">"},
 
-				{T: Keyword, Val: "https://megaphone.imgix.net/podcasts/00c0a118-2426-11ee-b258-73d331d0123b/image/show-cover.jpg?ixlib"},
-				{T: EQ, Val: "="},
-				{T: Keyword, Val: "rails-4.3.1"},
+				{T: Keyword, Val: "https://megaphone.imgix.net/podcasts/00c0a118-2426-11ee-b258-73d331d0123b/image/show-cover.jpg?ixlib=rails-4.3.1"},
 
 				{T: CloB, Val: "</"},
 				{T: Keyword, Val: "url"},
 				{T: RB, Val: ">"},
 			},
 		},
+		{
+			`<foo><!-- a <comment> --></foo>`,
+			[]Token{
+				{T: LB, Val: "<"},
+				{T: Keyword, Val: "foo"},
+				{T: RB, Val: ">"},
+
+				{T: Comment, Val: " a <comment> "},
+
+				{T: CloB, Val: "</"},
+				{T: Keyword, Val: "foo"},
+				{T: RB, Val: ">"},
+			},
+		},
+		{
+			`<description><![CDATA[<p>Hi & "bye"</p>]]></description>`,
+			[]Token{
+				{T: LB, Val: "<"},
+				{T: Keyword, Val: "description"},
+				{T: RB, Val: ">"},
+
+				{T: CData, Val: `<p>Hi & "bye"</p>`},
+
+				{T: CloB, Val: "</"},
+				{T: Keyword, Val: "description"},
+				{T: RB, Val: ">"},
+			},
+		},
+		{
+			`<br/><?page?>`,
+			[]Token{
+				{T: LB, Val: "<"},
+				{T: Keyword, Val: "br"},
+				{T: SelfRB, Val: "/>"},
+				{T: ProcInst, Val: "page"},
+			},
+		},
+		{
+			`<?php if ($a < 1) echo "?"; ?><?xml-stylesheet href='a.css'?>`,
+			[]Token{
+				{T: ProcInst, Val: `php if ($a < 1) echo "?"; `},
+				{T: ProcInst, Val: `xml-stylesheet href='a.css'`},
+			},
+		},
+		{
+			`<!DOCTYPE html><html/>`,
+			[]Token{
+				{T: Doctype, Val: " html"},
+				{T: LB, Val: "<"},
+				{T: Keyword, Val: "html"},
+				{T: SelfRB, Val: "/>"},
+			},
+		},
+		{
+			`<!DOCTYPE note SYSTEM "a>b.dtd" [<!ENTITY gt '>'><!-- ]> -->]>`,
+			[]Token{
+				{T: Doctype, Val: ` note SYSTEM "a>b.dtd" [<!ENTITY gt '>'><!-- ]> -->]`},
+			},
+		},
+		{
+			"<item\n  url='u'\tlen=\"1\"/>",
+			[]Token{
+				{T: LB, Val: "<"},
+				{T: Keyword, Val: "item"},
+				{T: Whitespace, Val: "\n  "},
+				{T: Keyword, Val: "url"},
+				{T: EQ, Val: "="},
+				{T: String, Val: "u"},
+				{T: Whitespace, Val: "\t"},
+				{T: Keyword, Val: "len"},
+				{T: EQ, Val: "="},
+				{T: String, Val: "1"},
+				{T: SelfRB, Val: "/>"},
+			},
+		},
+		{
+			"<a>x > 'y'</a\r\n>",
+			[]Token{
+				{T: LB, Val: "<"},
+				{T: Keyword, Val: "a"},
+				{T: RB, Val: ">"},
+
+				{T: Keyword, Val: "x"},
+				{T: Whitespace, Val: " "},
+				{T: Keyword, Val: ">"},
+				{T: Whitespace, Val: " "},
+				{T: Keyword, Val: "'y'"},
+
+				{T: CloB, Val: "</"},
+				{T: Keyword, Val: "a"},
+				{T: Whitespace, Val: "\r\n"},
+				{T: RB, Val: ">"},
+			},
+		},
 	}
 
 	for i, tst := range table {
@@ -184,9 +280,123 @@ func TestTokenise(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			if diff := cmp.Diff(tst.want, got); diff != "" {
+			if diff := cmp.Diff(tst.want, got, cmpopts.IgnoreTypes(Position{})); diff != "" {
 				t.Fatalf("failed on input '%v' with diff '%v' (-want +got)", tst.input, diff)
 			}
+
+			// Reading a byte at a time must give the same tokens and positions
+			streamed := NewReaderTokeniser(iotest.OneByteReader(strings.NewReader(tst.input)))
+			gotStreamed, err := streamed.Tokenise()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, gotStreamed); diff != "" {
+				t.Fatalf("streaming differed on input '%v' with diff '%v' (-want +got)", tst.input, diff)
+			}
 		})
 	}
 }
+
+func TestTokeniseUnterminatedComment(t *testing.T) {
+	ter := NewTokeniser(`<foo><!-- never ends</foo>`)
+	_, err := ter.Tokenise()
+	if err == nil {
+		t.Fatal("wanted an error for an unterminated comment")
+	}
+	if got := err.Error(); got != "1:6: unterminated comment" {
+		t.Fatalf("wrong error message '%v'", got)
+	}
+}
+
+func TestTokeniseUnterminatedCData(t *testing.T) {
+	ter := NewTokeniser(`<foo><![CDATA[never ends</foo>`)
+	_, err := ter.Tokenise()
+	if err == nil {
+		t.Fatal("wanted an error for an unterminated CDATA section")
+	}
+}
+
+func TestTokeniseUnterminatedDoctype(t *testing.T) {
+	ter := NewTokeniser(`<!DOCTYPE note [<!ELEMENT note ANY>`)
+	_, err := ter.Tokenise()
+	if err == nil {
+		t.Fatal("wanted an error for an unterminated DOCTYPE")
+	}
+	if got := err.Error(); got != "1:1: unterminated DOCTYPE declaration" {
+		t.Fatalf("wrong error message '%v'", got)
+	}
+}
+
+func TestTokeniseUnterminatedProcInst(t *testing.T) {
+	ter := NewTokeniser(`<foo><?php echo 1; </foo>`)
+	_, err := ter.Tokenise()
+	if err == nil {
+		t.Fatal("wanted an error for an unterminated processing instruction")
+	}
+	if got := err.Error(); got != "1:6: unterminated processing instruction" {
+		t.Fatalf("wrong error message '%v'", got)
+	}
+}
+
+func TestTokenisePositions(t *testing.T) {
+	ter := NewTokeniser("<a>\n\t<b x=\"é\">caf\u00e9!</b>\n</a>")
+	got, err := ter.Tokenise()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Token{
+		{T: LB, Val: "<", Pos: Position{0, 1, 1}, End: Position{1, 1, 2}},
+		{T: Keyword, Val: "a", Pos: Position{1, 1, 2}, End: Position{2, 1, 3}},
+		{T: RB, Val: ">", Pos: Position{2, 1, 3}, End: Position{3, 1, 4}},
+		{T: Whitespace, Val: "\n\t", Pos: Position{3, 1, 4}, End: Position{5, 2, 2}},
+		{T: LB, Val: "<", Pos: Position{5, 2, 2}, End: Position{6, 2, 3}},
+		{T: Keyword, Val: "b", Pos: Position{6, 2, 3}, End: Position{7, 2, 4}},
+		{T: Whitespace, Val: " ", Pos: Position{7, 2, 4}, End: Position{8, 2, 5}},
+		{T: Keyword, Val: "x", Pos: Position{8, 2, 5}, End: Position{9, 2, 6}},
+		{T: EQ, Val: "=", Pos: Position{9, 2, 6}, End: Position{10, 2, 7}},
+		{T: String, Val: "é", Pos: Position{10, 2, 7}, End: Position{14, 2, 10}},
+		{T: RB, Val: ">", Pos: Position{14, 2, 10}, End: Position{15, 2, 11}},
+		{T: Keyword, Val: "café!", Pos: Position{15, 2, 11}, End: Position{21, 2, 16}},
+		{T: CloB, Val: "</", Pos: Position{21, 2, 16}, End: Position{23, 2, 18}},
+		{T: Keyword, Val: "b", Pos: Position{23, 2, 18}, End: Position{24, 2, 19}},
+		{T: RB, Val: ">", Pos: Position{24, 2, 19}, End: Position{25, 2, 20}},
+		{T: Whitespace, Val: "\n", Pos: Position{25, 2, 20}, End: Position{26, 3, 1}},
+		{T: CloB, Val: "</", Pos: Position{26, 3, 1}, End: Position{28, 3, 3}},
+		{T: Keyword, Val: "a", Pos: Position{28, 3, 3}, End: Position{29, 3, 4}},
+		{T: RB, Val: ">", Pos: Position{29, 3, 4}, End: Position{30, 3, 5}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("wrong positions with diff '%v' (-want +got)", diff)
+	}
+}
+
+func TestTokeniseReaderError(t *testing.T) {
+	readErr := errors.New("disk on fire")
+	ter := NewReaderTokeniser(io.MultiReader(strings.NewReader("<foo>bar"), iotest.ErrReader(readErr)))
+	_, err := ter.Tokenise()
+	if !errors.Is(err, readErr) {
+		t.Fatalf("wanted the read error but got %v", err)
+	}
+}
+
+func TestTokeniseReaderLongDelimited(t *testing.T) {
+	body := strings.Repeat("x", 200_000)
+	input := "<a><!--" + body + "--><![CDATA[" + body + "]]></a>"
+
+	var got []Token
+	allocs := testing.AllocsPerRun(1, func() {
+		ter := NewReaderTokeniser(iotest.OneByteReader(strings.NewReader(input)))
+		var err error
+		got, err = ter.Tokenise()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if len(got) != 8 || got[3].Val != body || got[4].Val != body {
+		t.Fatalf("wrong tokens for input of length %d", len(input))
+	}
+	// One read buffer and a window that grows by doubling
+	if allocs > 200 {
+		t.Fatalf("wanted reading a byte at a time to reuse its buffer but got %v allocations", allocs)
+	}
+}
@@ -0,0 +1,256 @@
+package xmlparser
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/danwhitford/xmlparser/dtd"
+	"github.com/danwhitford/xmlparser/tokeniser"
+)
+
+type validator struct {
+	d        *dtd.DTD
+	entities *entityExpander
+	models   map[string]*regexp.Regexp
+	ids      map[string]bool
+	idrefs   []idref
+	errs     []*ValidationError
+	stack    []string
+}
+
+type idref struct {
+	id    string
+	pos   tokeniser.Position
+	stack []string
+}
+
+// Validate checks doc against the declarations in d, returning every
+// way in which it falls short. It gives nil if doc is valid.
+func Validate(doc Document, d *dtd.DTD) []*ValidationError {
+	v := validator{
+		d:        d,
+		entities: newEntityExpander(d, nil),
+		models:   map[string]*regexp.Regexp{},
+		ids:      map[string]bool{},
+	}
+
+	if doc.Doctype != nil && doc.Doctype.Name != doc.Root.Name {
+		v.errs = append(v.errs, &ValidationError{
+			Pos:   doc.Root.Span.Start,
+			Msg:   fmt.Sprintf("root element '%s' does not match the DOCTYPE name '%s'", doc.Root.Name, doc.Doctype.Name),
+			Stack: []string{doc.Root.Name},
+		})
+	}
+	v.validateElement(doc.Root)
+
+	for _, ref := range v.idrefs {
+		if !v.ids[ref.id] {
+			v.errs = append(v.errs, &ValidationError{
+				Pos:   ref.pos,
+				Msg:   fmt.Sprintf("no element has the ID '%s'", ref.id),
+				Stack: ref.stack,
+			})
+		}
+	}
+	return v.errs
+}
+
+func (v *validator) errorf(pos tokeniser.Position, format string, args ...any) {
+	v.errs = append(v.errs, &ValidationError{
+		Pos:   pos,
+		Msg:   fmt.Sprintf(format, args...),
+		Stack: slices.Clone(v.stack),
+	})
+}
+
+func (v *validator) validateElement(node XmlNode) {
+	v.stack = append(v.stack, node.Name)
+	defer func() { v.stack = v.stack[:len(v.stack)-1] }()
+
+	el, ok := v.d.Elements[node.Name]
+	if !ok {
+		v.errorf(node.Span.Start, "element '%s' is not declared", node.Name)
+	} else {
+		v.validateContent(node, el)
+	}
+	v.validateAttributes(node)
+
+	for _, child := range node.Children {
+		if child.Type == ElementNode {
+			v.validateElement(child)
+		}
+	}
+}
+
+func (v *validator) validateContent(node XmlNode, el *dtd.Element) {
+	switch el.Kind {
+	case dtd.Empty:
+		if node.Contents != "" || len(node.Children) > 0 {
+			v.errorf(node.Span.Start, "element '%s' is declared EMPTY but has content", node.Name)
+		}
+	case dtd.Mixed:
+		for _, child := range node.Children {
+			if child.Type == ElementNode && !slices.Contains(el.Names, child.Name) {
+				v.errorf(child.Span.Start, "element '%s' is not allowed in '%s', which allows text and %s", child.Name, node.Name, describeNames(el.Names))
+			}
+		}
+	case dtd.Children:
+		if strings.TrimSpace(node.Contents) != "" || node.CData {
+			v.errorf(node.Span.Start, "element '%s' cannot contain text", node.Name)
+		}
+		var names strings.Builder
+		for _, child := range node.Children {
+			switch child.Type {
+			case ElementNode:
+				names.WriteString(child.Name + " ")
+			case TextNode, CDataNode:
+				if child.Type == CDataNode || strings.TrimSpace(child.Contents) != "" {
+					v.errorf(child.Span.Start, "element '%s' cannot contain text", node.Name)
+				}
+			}
+		}
+		if !v.model(el).MatchString(names.String()) {
+			v.errorf(node.Span.Start, "content of '%s' does not match %v", node.Name, el.Particle)
+		}
+	}
+}
+
+func describeNames(names []string) string {
+	if len(names) == 0 {
+		return "no elements"
+	}
+	return "'" + strings.Join(names, "', '") + "'"
+}
+
+// model compiles the content model of el to a regular expression over the
+// names of its children, each followed by a space.
+func (v *validator) model(el *dtd.Element) *regexp.Regexp {
+	re, ok := v.models[el.Name]
+	if !ok {
+		re = regexp.MustCompile("^" + particlePattern(el.Particle) + "$")
+		v.models[el.Name] = re
+	}
+	return re
+}
+
+func particlePattern(p *dtd.Particle) string {
+	var pattern string
+	switch p.Kind {
+	case dtd.NameParticle:
+		pattern = "(?:" + regexp.QuoteMeta(p.Name) + " )"
+	case dtd.Sequence:
+		for _, child := range p.Children {
+			pattern += particlePattern(child)
+		}
+		pattern = "(?:" + pattern + ")"
+	case dtd.Choice:
+		alternatives := make([]string, len(p.Children))
+		for i, child := range p.Children {
+			alternatives[i] = particlePattern(child)
+		}
+		pattern = "(?:" + strings.Join(alternatives, "|") + ")"
+	}
+	if p.Occurs != 0 {
+		pattern += string(p.Occurs)
+	}
+	return pattern
+}
+
+func (v *validator) validateAttributes(node XmlNode) {
+	for _, attr := range node.Attributes {
+		pos := attr.Span.Start
+		if attr.Span == (Span{}) {
+			// Defaults added from the DTD have no span of their own
+			pos = node.Span.Start
+		}
+		decl, ok := v.d.Attribute(node.Name, attr.Key)
+		if !ok {
+			v.errorf(pos, "attribute '%s' is not declared for '%s'", attr.Key, node.Name)
+			continue
+		}
+		v.validateAttribute(attr.Value, decl, pos)
+	}
+
+	for _, decl := range v.d.Attlists[node.Name] {
+		if decl.Default != dtd.Required {
+			continue
+		}
+		if !slices.ContainsFunc(node.Attributes, func(attr Attribute) bool { return attr.Key == decl.Name }) {
+			v.errorf(node.Span.Start, "element '%s' is missing required attribute '%s'", node.Name, decl.Name)
+		}
+	}
+}
+
+func (v *validator) validateAttribute(value string, decl *dtd.AttributeDecl, pos tokeniser.Position) {
+	if decl.Default == dtd.Fixed {
+		fixed, err := decodeReferences(decl.Value, v.entities.resolve)
+		if err == nil && value != fixed {
+			v.errorf(pos, "attribute '%s' must be '%s' but is '%s'", decl.Name, fixed, value)
+		}
+	}
+
+	tokens := strings.Fields(value)
+	switch decl.Type {
+	case dtd.ID:
+		if !dtd.IsName(value) {
+			v.errorf(pos, "attribute '%s' must be a name but is '%s'", decl.Name, value)
+		} else if v.ids[value] {
+			v.errorf(pos, "ID '%s' is used more than once", value)
+		}
+		v.ids[value] = true
+	case dtd.IDREF, dtd.IDREFS:
+		if decl.Type == dtd.IDREF && len(tokens) != 1 || len(tokens) == 0 {
+			v.errorf(pos, "attribute '%s' must be %s but is '%s'", decl.Name, describeType(decl.Type), value)
+			return
+		}
+		for _, token := range tokens {
+			if !dtd.IsName(token) {
+				v.errorf(pos, "attribute '%s' must be %s but is '%s'", decl.Name, describeType(decl.Type), value)
+				return
+			}
+			v.idrefs = append(v.idrefs, idref{token, pos, slices.Clone(v.stack)})
+		}
+	case dtd.ENTITY, dtd.ENTITIES:
+		if decl.Type == dtd.ENTITY && len(tokens) != 1 || len(tokens) == 0 {
+			v.errorf(pos, "attribute '%s' must be %s but is '%s'", decl.Name, describeType(decl.Type), value)
+			return
+		}
+		for _, token := range tokens {
+			e, ok := v.d.Entities[token]
+			if !ok || e.NData == "" {
+				v.errorf(pos, "attribute '%s' names '%s', which is not an unparsed entity", decl.Name, token)
+			}
+		}
+	case dtd.NMTOKEN, dtd.NMTOKENS:
+		valid := len(tokens) > 0 && (decl.Type == dtd.NMTOKENS || len(tokens) == 1)
+		for _, token := range tokens {
+			valid = valid && dtd.IsNmtoken(token)
+		}
+		if !valid {
+			v.errorf(pos, "attribute '%s' must be %s but is '%s'", decl.Name, describeType(decl.Type), value)
+		}
+	case dtd.NOTATION, dtd.Enumeration:
+		if !slices.Contains(decl.Values, value) {
+			v.errorf(pos, "attribute '%s' must be one of %s but is '%s'", decl.Name, describeNames(decl.Values), value)
+		}
+	}
+}
+
+func describeType(t dtd.AttributeType) string {
+	switch t {
+	case dtd.IDREF:
+		return "an ID reference"
+	case dtd.IDREFS:
+		return "a list of ID references"
+	case dtd.ENTITY:
+		return "an entity name"
+	case dtd.ENTITIES:
+		return "a list of entity names"
+	case dtd.NMTOKEN:
+		return "a name token"
+	default:
+		return "a list of name tokens"
+	}
+}
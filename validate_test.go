@@ -0,0 +1,105 @@
+package xmlparser
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const noteDTD = `<!DOCTYPE note [
+	<!ELEMENT note (to+, from?, (body | empty), ref*)>
+	<!ELEMENT to (#PCDATA)>
+	<!ELEMENT from (#PCDATA)>
+	<!ELEMENT body (#PCDATA | b | i)*>
+	<!ELEMENT b (#PCDATA)>
+	<!ELEMENT i (#PCDATA)>
+	<!ELEMENT empty EMPTY>
+	<!ELEMENT ref ANY>
+	<!ENTITY pic SYSTEM "pic.png" NDATA png>
+	<!NOTATION png SYSTEM "image/png">
+	<!ATTLIST note
+		id ID #REQUIRED
+		lang (en | fr) "en"
+		version CDATA #FIXED "1.0">
+	<!ATTLIST to id ID #IMPLIED>
+	<!ATTLIST ref
+		target IDREF #IMPLIED
+		targets IDREFS #IMPLIED
+		image ENTITY #IMPLIED
+		tags NMTOKENS #IMPLIED>
+]>
+`
+
+func TestValidate(t *testing.T) {
+	table := []struct {
+		input string
+		want  []string
+	}{
+		{
+			noteDTD + `<note id="n1">
+				<to id="t1">Tove</to>
+				<to>Jani</to>
+				<from>Me</from>
+				<body>Don't <b>forget</b> <i>me</i></body>
+				<ref target="t1" targets="n1 t1" image="pic" tags="a-1 b.2"><b>anything</b></ref>
+			</note>`,
+			nil,
+		},
+		{
+			noteDTD + `<note id="n1"><to>Tove</to><empty/></note>`,
+			nil,
+		},
+		{
+			noteDTD + `<memo/>`,
+			[]string{
+				"23:1: root element 'memo' does not match the DOCTYPE name 'note' (in /memo)",
+				"23:1: element 'memo' is not declared (in /memo)",
+			},
+		},
+		{
+			noteDTD + `<note lang="de" version="2.0">
+				<from>Me</from>
+				<to>Tove</to>
+				<body>Hi <to>you</to></body>
+				text
+			</note>`,
+			[]string{
+				"26:33: element 'note' cannot contain text (in /note)",
+				"23:1: content of 'note' does not match (to+,from?,(body|empty),ref*) (in /note)",
+				"23:7: attribute 'lang' must be one of 'en', 'fr' but is 'de' (in /note)",
+				"23:17: attribute 'version' must be '1.0' but is '2.0' (in /note)",
+				"23:1: element 'note' is missing required attribute 'id' (in /note)",
+				"26:14: element 'to' is not allowed in 'body', which allows text and 'b', 'i' (in /note/body)",
+			},
+		},
+		{
+			noteDTD + `<note id="a"><to id="a">x</to><empty>no</empty><ref colour="red" target="nope" targets="" image="missing" tags="a b,c"/></note>`,
+			[]string{
+				"23:18: ID 'a' is used more than once (in /note/to)",
+				"23:31: element 'empty' is declared EMPTY but has content (in /note/empty)",
+				"23:53: attribute 'colour' is not declared for 'ref' (in /note/ref)",
+				"23:80: attribute 'targets' must be a list of ID references but is '' (in /note/ref)",
+				"23:91: attribute 'image' names 'missing', which is not an unparsed entity (in /note/ref)",
+				"23:107: attribute 'tags' must be a list of name tokens but is 'a b,c' (in /note/ref)",
+				"23:66: no element has the ID 'nope' (in /note/ref)",
+			},
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			doc, err := ParseDocument(tst.input)
+			if err != nil {
+				t.Fatalf("failed on input '%v'. %v.", tst.input, err)
+			}
+			var got []string
+			for _, err := range Validate(doc, doc.Doctype.DTD) {
+				got = append(got, err.Error())
+			}
+			if diff := cmp.Diff(tst.want, got); diff != "" {
+				t.Fatalf("failed on input '%v' with diff '%v'", tst.input, diff)
+			}
+		})
+	}
+}
@@ -3,23 +3,58 @@ package xmlparser
 import (
 	"fmt"
 	"io"
+	"strings"
+
+	"github.com/danwhitford/xmlparser/tokeniser"
 )
 
+// Span is the stretch of input a node or attribute was parsed from. It
+// is left zero for nodes built in code.
+type Span struct {
+	Start, End tokeniser.Position
+}
+
+// Namespace is the URI the prefix of Key resolves to. Attributes without
+// a prefix are in no namespace.
 type Attribute struct {
 	Key, Value string
+	Namespace  string
+	Span       Span
 }
 
+// Instruction is a processing instruction before the root element. Data
+// is its raw text after the target, which for the XML declaration is also
+// split into Attributes.
 type Instruction struct {
 	Name       string
 	Attributes []Attribute
+	Data       string
 }
 
+type NodeType int
+
+const (
+	ElementNode NodeType = iota
+	CommentNode
+	TextNode
+	CDataNode
+	ProcInstNode
+
+	// AttributeNode is only made by queries that select attributes. Name
+	// and Namespace are those of the attribute and Contents is its value.
+	AttributeNode
+)
+
 type XmlNode struct {
+	Type         NodeType
 	Name         string
+	Namespace    string
 	Children     []XmlNode
 	Contents     string
+	CData        bool
 	Attributes   []Attribute
 	Instructions []Instruction
+	Span         Span
 }
 
 func (node XmlNode) prettyPrintIndented(sb io.Writer, indent int) {
@@ -28,23 +63,22 @@ func (node XmlNode) prettyPrintIndented(sb io.Writer, indent int) {
 		indentString += "\t"
 	}
 
+	if node.Type != ElementNode {
+		fmt.Fprint(sb, indentString)
+		node.printInline(sb)
+		fmt.Fprintln(sb)
+		return
+	}
+
 	if len(node.Instructions) > 0 {
 		for _, instruction := range node.Instructions {
-			fmt.Fprintf(sb, "<?%s", instruction.Name)
-			for _, attr := range instruction.Attributes {
-				fmt.Fprintf(sb, " %s=\"%s\"", attr.Key, attr.Value)
-			}
-			fmt.Fprintln(sb, "?>")
+			printInstruction(sb, instruction.Name, instruction.Data)
+			fmt.Fprintln(sb)
 		}
 	}
 
 	fmt.Fprintf(sb, "%s<%s", indentString, node.Name)
-
-	if len(node.Attributes) > 0 {
-		for _, attr := range node.Attributes {
-			fmt.Fprintf(sb, ` %s="%s"`, attr.Key, attr.Value)
-		}
-	}
+	printAttributes(sb, node.Attributes)
 
 	if node.Contents == "" && len(node.Children) == 0 {
 		fmt.Fprintf(sb, "/>\n")
@@ -54,19 +88,100 @@ func (node XmlNode) prettyPrintIndented(sb io.Writer, indent int) {
 	}
 
 	if node.Contents != "" {
-		fmt.Fprintf(sb, "%s</%s>\n", node.Contents, node.Name)
+		node.printContents(sb)
+		fmt.Fprintf(sb, "</%s>\n", node.Name)
+		return
+	}
+
+	if node.isMixed() {
+		// Any whitespace added here would become part of the text
+		for _, child := range node.Children {
+			child.printInline(sb)
+		}
+		fmt.Fprintf(sb, "</%s>\n", node.Name)
 		return
 	}
 
 	if len(node.Children) > 0 {
 		fmt.Fprintln(sb)
 		for _, child := range node.Children {
-			child.prettyPrintIndented(sb, indent+1)
+			if !child.isSpace() {
+				child.prettyPrintIndented(sb, indent+1)
+			}
 		}
 	}
 	fmt.Fprintf(sb, "%s</%s>\n", indentString, node.Name)
 }
 
+func (node XmlNode) printInline(sb io.Writer) {
+	switch node.Type {
+	case CommentNode:
+		fmt.Fprintf(sb, "<!--%s-->", escapeComment(node.Contents))
+	case TextNode:
+		fmt.Fprint(sb, escapeText(node.Contents))
+	case CDataNode:
+		fmt.Fprintf(sb, "<![CDATA[%s]]>", escapeCData(node.Contents))
+	case ProcInstNode:
+		printInstruction(sb, node.Name, node.Contents)
+	case AttributeNode:
+		fmt.Fprintf(sb, `%s="%s"`, node.Name, escape(node.Contents))
+	default:
+		fmt.Fprintf(sb, "<%s", node.Name)
+		printAttributes(sb, node.Attributes)
+		if node.Contents == "" && len(node.Children) == 0 {
+			fmt.Fprint(sb, "/>")
+			return
+		}
+		fmt.Fprint(sb, ">")
+		if node.Contents != "" {
+			node.printContents(sb)
+		} else {
+			for _, child := range node.Children {
+				child.printInline(sb)
+			}
+		}
+		fmt.Fprintf(sb, "</%s>", node.Name)
+	}
+}
+
+func (node XmlNode) printContents(sb io.Writer) {
+	if node.CData {
+		fmt.Fprintf(sb, "<![CDATA[%s]]>", escapeCData(node.Contents))
+	} else {
+		fmt.Fprint(sb, escapeText(node.Contents))
+	}
+}
+
+// isMixed reports whether text is interleaved with the other children.
+// Whitespace on its own is taken to be formatting, which indenting
+// replaces.
+func (node XmlNode) isMixed() bool {
+	for _, child := range node.Children {
+		if child.Type == CDataNode || child.Type == TextNode && !child.isSpace() {
+			return true
+		}
+	}
+	return false
+}
+
+func (node XmlNode) isSpace() bool {
+	return node.Type == TextNode && strings.Trim(node.Contents, " \t\r\n") == ""
+}
+
+func printAttributes(sb io.Writer, attrs []Attribute) {
+	for _, attr := range attrs {
+		fmt.Fprintf(sb, ` %s="%s"`, attr.Key, escape(attr.Value))
+	}
+}
+
+func printInstruction(sb io.Writer, name string, data string) {
+	if data == "" {
+		fmt.Fprintf(sb, "<?%s?>", name)
+		return
+	}
+	fmt.Fprintf(sb, "<?%s %s?>", name, escapeInstruction(data))
+}
+
 func (node XmlNode) PrettyPrint(sb io.Writer) {
 	node.prettyPrintIndented(sb, 0)
 }
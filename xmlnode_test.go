@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 func TestPrintXml(t *testing.T) {
@@ -24,7 +25,7 @@ func TestPrintXml(t *testing.T) {
 				Name:     "foo",
 				Contents: "bar",
 				Attributes: []Attribute{
-					{"version", "1.0"},
+					{Key: "version", Value: "1.0"},
 				},
 			},
 			"<foo version=\"1.0\">bar</foo>\n",
@@ -66,12 +67,85 @@ func TestPrintXml(t *testing.T) {
 				Name:     "foo",
 				Contents: "bar",
 				Attributes: []Attribute{
-					{"version", "1.0"},
-					{"type", "test"},
+					{Key: "version", Value: "1.0"},
+					{Key: "type", Value: "test"},
 				},
 			},
 			"<foo version=\"1.0\" type=\"test\">bar</foo>\n",
 		},
+		{
+			XmlNode{
+				Name: "config",
+				Children: []XmlNode{
+					{Type: CommentNode, Contents: " the port to listen on "},
+					{Name: "port", Contents: "8080"},
+				},
+			},
+			"<config>\n" +
+				"\t<!-- the port to listen on -->\n" +
+				"\t<port>8080</port>\n" +
+				"</config>\n",
+		},
+		{
+			XmlNode{
+				Name:     "description",
+				Contents: "<p>Some <b>HTML</b></p>",
+				CData:    true,
+			},
+			"<description><![CDATA[<p>Some <b>HTML</b></p>]]></description>\n",
+		},
+		{
+			XmlNode{
+				Name:     "q",
+				Contents: `if a < b && b > c say "hi"`,
+				Attributes: []Attribute{
+					{Key: "title", Value: `Tom & "Jerry" <3`},
+				},
+			},
+			"<q title=\"Tom &amp; &quot;Jerry&quot; &lt;3\">if a &lt; b &amp;&amp; b &gt; c say \"hi\"</q>\n",
+		},
+		{
+			XmlNode{
+				Name:     "code",
+				Contents: "a[b[0]]>c",
+				CData:    true,
+			},
+			"<code><![CDATA[a[b[0]]]]><![CDATA[>c]]></code>\n",
+		},
+		{
+			XmlNode{
+				Name: "div",
+				Children: []XmlNode{
+					{Name: "p", Children: []XmlNode{
+						{Type: TextNode, Contents: "Hello "},
+						{Name: "b", Contents: "world"},
+						{Type: TextNode, Contents: " & "},
+						{Type: CDataNode, Contents: "<again>"},
+						{Name: "br"},
+					}},
+					{Type: ProcInstNode, Name: "page", Contents: `break="yes"`},
+				},
+			},
+			"<div>\n" +
+				"\t<p>Hello <b>world</b> &amp; <![CDATA[<again>]]><br/></p>\n" +
+				"\t<?page break=\"yes\"?>\n" +
+				"</div>\n",
+		},
+		{
+			XmlNode{
+				Name: "a",
+				Children: []XmlNode{
+					{Type: CommentNode, Contents: "x -- y --> z-"},
+					{Type: CommentNode, Contents: "---"},
+					{Type: ProcInstNode, Name: "php", Contents: `echo "?>";`},
+				},
+			},
+			"<a>\n" +
+				"\t<!--x - - y - -> z- -->\n" +
+				"\t<!--- - - -->\n" +
+				"\t<?php echo \"? >\";?>\n" +
+				"</a>\n",
+		},
 	}
 
 	for _, tst := range table {
@@ -84,3 +158,54 @@ func TestPrintXml(t *testing.T) {
 		}
 	}
 }
+
+func TestPrintParseRoundTrip(t *testing.T) {
+	table := []XmlNode{
+		{
+			Name:     "q",
+			Contents: `  if a < b && b > c say "hi" `,
+			Attributes: []Attribute{
+				{Key: "title", Value: `Tom & "Jerry" <3 =?/>`},
+			},
+		},
+		{
+			Name: "list",
+			Children: []XmlNode{
+				{Name: "item", Contents: " "},
+				{Name: "item", Contents: "a[b[0]]>c", CData: true},
+				{Type: CommentNode, Contents: " <not markup> "},
+			},
+		},
+		{
+			Name: "article",
+			Children: []XmlNode{
+				{Type: ProcInstNode, Name: "render", Contents: `mode="fast"`},
+				{Name: "para", Children: []XmlNode{
+					{Type: TextNode, Contents: "  Some "},
+					{Name: "emphasis", Children: []XmlNode{
+						{Type: TextNode, Contents: "very "},
+						{Name: "b", Contents: "important"},
+					}},
+					{Type: TextNode, Contents: " text\n"},
+					{Type: CommentNode, Contents: "note"},
+					{Type: CDataNode, Contents: "x < y"},
+				}},
+			},
+		},
+	}
+
+	for _, input := range table {
+		var sb strings.Builder
+		input.PrettyPrint(&sb)
+
+		got, err := Parse(sb.String())
+		if err != nil {
+			t.Fatalf("could not parse printed output '%v'. %v", sb.String(), err)
+		}
+		// The indenting comes back as whitespace between the children
+		indenting := cmpopts.IgnoreSliceElements(func(n XmlNode) bool { return n.isSpace() })
+		if diff := cmp.Diff(input, got, cmpopts.EquateEmpty(), cmpopts.IgnoreTypes(Span{}), indenting); diff != "" {
+			t.Fatalf("failed to round trip '%v' with diff '%v'", sb.String(), diff)
+		}
+	}
+}
@@ -1,130 +1,479 @@
 package xmlparser
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"strings"
+	"unicode"
 
+	"github.com/danwhitford/xmlparser/dtd"
 	"github.com/danwhitford/xmlparser/tokeniser"
 )
 
+type tokenSource interface {
+	Next() (tokeniser.Token, error)
+}
+
+type tokenSlice struct {
+	tokens []tokeniser.Token
+	curr   int
+}
+
+func (ts *tokenSlice) Next() (tokeniser.Token, error) {
+	if ts.curr >= len(ts.tokens) {
+		return tokeniser.Token{}, io.EOF
+	}
+	ts.curr++
+	return ts.tokens[ts.curr-1], nil
+}
+
+// splicedSource gives the tokens of an expanded entity before going back
+// to the source the reference was read from.
+type splicedSource struct {
+	tokens []tokeniser.Token
+	src    tokenSource
+}
+
+func (ss *splicedSource) Next() (tokeniser.Token, error) {
+	if len(ss.tokens) == 0 {
+		return ss.src.Next()
+	}
+	t := ss.tokens[0]
+	ss.tokens = ss.tokens[1:]
+	return t, nil
+}
+
+// parser reads from its source one token ahead. Running into an error
+// from the tokeniser ends the input early, and the error is kept in err.
 type parser struct {
-	Input []tokeniser.Token
-	curr  int
-	l     int
+	src      tokenSource
+	next     tokeniser.Token
+	more     bool
+	last     tokeniser.Token
+	read     bool
+	err      error
+	entities map[string]string
+	file     string
+
+	// dtd is the internal subset of the document, if it had one, and
+	// expander expands the entities it declares.
+	dtd      *dtd.DTD
+	expander *entityExpander
+
+	// stack holds the names of the open elements, opened where each of
+	// them started and bindings the namespaces each of them declared.
+	stack      []string
+	opened     []tokeniser.Position
+	bindings   []map[string]string
+	pendingEnd *EndElement
 }
 
 func Parse(input string) (XmlNode, error) {
 	t := tokeniser.NewTokeniser(input)
-	tokens, err := t.Tokenise()
+	return parse("", &t, nil)
+}
+
+// ParseWithEntities is like Parse but also expands the named entities
+// in entities, for documents relying on entities declared in a DTD.
+func ParseWithEntities(input string, entities map[string]string) (XmlNode, error) {
+	t := tokeniser.NewTokeniser(input)
+	return parse("", &t, entities)
+}
+
+// ParseReader is like Parse but tokenises r as it goes rather than
+// reading it all into memory first.
+func ParseReader(r io.Reader) (XmlNode, error) {
+	t := tokeniser.NewReaderTokeniser(r)
+	return parse("", &t, nil)
+}
+
+// ParseFile parses the file at path, naming it in any error positions.
+func ParseFile(path string) (XmlNode, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return XmlNode{}, fmt.Errorf("error tokenising. %s", err)
+		return XmlNode{}, err
 	}
-	p := newParser(tokens)
+	defer f.Close()
+	t := tokeniser.NewReaderTokeniser(f)
+	return parse(path, &t, nil)
+}
+
+func parse(file string, src tokenSource, entities map[string]string) (XmlNode, error) {
+	p := newStreamParser(src)
+	p.entities = entities
+	p.file = file
 	out, err := p.runParser()
-	if err != nil {
-		return XmlNode{}, fmt.Errorf("error running parser. %s", err)
+	if p.err != nil {
+		return XmlNode{}, p.err
 	}
-	return out, nil
+	return out, err
 }
 
 func newParser(input []tokeniser.Token) parser {
-	return parser{
-		input,
-		0,
-		len(input),
+	return newStreamParser(&tokenSlice{tokens: input})
+}
+
+func newStreamParser(src tokenSource) parser {
+	p := parser{src: src}
+	p.advance()
+	return p
+}
+
+func (p *parser) advance() {
+	t, err := p.src.Next()
+	if err != nil {
+		p.more = false
+		if err != io.EOF {
+			p.err = p.tokeniserError(err)
+		}
+		return
+	}
+	p.next = t
+	p.more = true
+}
+
+func (p *parser) tokeniserError(err error) error {
+	var terr *tokeniser.Error
+	if errors.As(err, &terr) {
+		return &SyntaxError{
+			File:  p.file,
+			Pos:   terr.Pos,
+			Msg:   terr.Msg,
+			Got:   tokeniser.EOF,
+			Stack: append([]string(nil), p.stack...),
+		}
+	}
+	return err
+}
+
+// pos is where the parser has got up to, which is the start of the next
+// token or the end of the input.
+func (p *parser) pos() tokeniser.Position {
+	if p.more {
+		return p.next.Pos
+	}
+	return p.lastEnd()
+}
+
+func (p *parser) errorf(format string, args ...any) *SyntaxError {
+	got := tokeniser.EOF
+	if p.more {
+		got = p.Peek().T
+	}
+	return &SyntaxError{
+		File:  p.file,
+		Pos:   p.pos(),
+		Msg:   fmt.Sprintf(format, args...),
+		Got:   got,
+		Stack: append([]string(nil), p.stack...),
+	}
+}
+
+func (p *parser) errorAt(t tokeniser.Token, err error) *SyntaxError {
+	return &SyntaxError{
+		File:  p.file,
+		Pos:   t.Pos,
+		Msg:   err.Error(),
+		Got:   t.T,
+		Stack: append([]string(nil), p.stack...),
+	}
+}
+
+// errorIn reports a problem with something already read, such as an
+// attribute.
+func (p *parser) errorIn(span Span, format string, args ...any) *SyntaxError {
+	return &SyntaxError{
+		File:  p.file,
+		Pos:   span.Start,
+		Msg:   fmt.Sprintf(format, args...),
+		Got:   tokeniser.Keyword,
+		Stack: append([]string(nil), p.stack...),
 	}
 }
 
+// unclosedError reports running out of input with elements still open.
+func (p *parser) unclosedError() *SyntaxError {
+	err := p.errorf("at end of input but '%s' is still open", p.stack[len(p.stack)-1])
+	err.Expected = []tokeniser.TokenType{tokeniser.CloB}
+	return err
+}
+
+// lastEnd is the end of the most recently read token.
+func (p *parser) lastEnd() tokeniser.Position {
+	if p.read {
+		return p.last.End
+	}
+	return tokeniser.Position{Line: 1, Col: 1}
+}
+
 func (p *parser) runParser() (XmlNode, error) {
 	root := XmlNode{}
 
-	if p.Peek().T == tokeniser.ProcLB {
-		err := p.readProcessingInstruction(&root)
+	for {
+		tok, err := p.nextEvent()
+		if err == io.EOF {
+			return root, p.errorf("no content to parse")
+		}
 		if err != nil {
-			return root, fmt.Errorf("error reading a processing instruction. %s", err)
+			return root, err
 		}
-	}
 
-	for p.curr < p.l {
-		if p.Peek().T == tokeniser.Whitespace {
-			_, err := p.readNext(tokeniser.Whitespace)
+		switch t := tok.(type) {
+		case ProcInst:
+			root.Instructions = append(root.Instructions, Instruction{t.Target, t.Attributes, t.Data})
+		case StartElement:
+			err := p.buildElement(&root, t)
 			if err != nil {
-				return root, fmt.Errorf("error skipping through whitespace. %v", err)
+				return root, err
+			}
+			// Only comments, processing instructions and whitespace can follow
+			return root, p.readEpilog(&Document{})
+		case CharData:
+			if t.CData || strings.TrimSpace(t.Text) != "" {
+				return root, p.errorIn(t.Span, "text is not allowed outside of the root element")
 			}
-		} else {
-			break
+		case Comment, Doctype:
+			// Only a Document has anywhere to keep these
 		}
 	}
+}
+
+// buildElement reads the rest of the element started by start into node,
+// up to its end tag. Running out of input first is an error.
+func (p *parser) buildElement(node *XmlNode, start StartElement) error {
+	node.Name = start.Name
+	node.Namespace = start.Namespace
+	node.Attributes = start.Attributes
+	node.Span = start.Span
 
-	if p.curr < p.l {
-		err := p.readOpeningTag(&root)
+	for {
+		tok, err := p.nextEvent()
+		if err == io.EOF {
+			return p.unclosedError()
+		}
 		if err != nil {
-			return root, fmt.Errorf("error reading opening tag. %v. %#v", err, p.Input[p.curr])
+			return err
 		}
-		if p.curr < p.l && p.Peek().T == tokeniser.SelfRB {
-			_, err := p.readNext(tokeniser.SelfRB)
+
+		switch t := tok.(type) {
+		case CharData:
+			nodeType := TextNode
+			if t.CData {
+				nodeType = CDataNode
+			}
+			node.Children = append(node.Children, XmlNode{
+				Type:     nodeType,
+				Contents: t.Text,
+				Span:     t.Span,
+			})
+		case StartElement:
+			child := XmlNode{}
+			err := p.buildElement(&child, t)
 			if err != nil {
-				return root, fmt.Errorf("error with self closing tag. %v", err)
+				return err
 			}
-			return root, nil
+			node.Children = append(node.Children, child)
+		case Comment:
+			node.Children = append(node.Children, XmlNode{
+				Type:     CommentNode,
+				Contents: t.Text,
+				Span:     t.Span,
+			})
+		case ProcInst:
+			node.Children = append(node.Children, instructionNode(t))
+		case EndElement:
+			settleContents(node)
+			node.Span.End = t.Span.End
+			return nil
 		}
 	}
+}
 
-	for p.curr < p.l {
-		switch p.Peek().T {
-		case tokeniser.Keyword:
-			contents, err := p.readContents()
-			if err != nil {
-				return root, err
-			}
-			root.Contents = contents
-		case tokeniser.LB:
-			child, err := p.runParser()
-			if err != nil {
-				return root, err
-			}
-			root.Children = append(root.Children, child)
-		case tokeniser.CloB:
-			err := p.chompClosingTag(root.Name)
-			if err != nil {
-				return root, err
-			}
-			return root, nil
-		case tokeniser.Whitespace:
-			_, err := p.readNext(tokeniser.Whitespace)
+// settleContents decides how the text read into an element is kept. Text
+// on its own is joined into Contents, and text mixed in with other nodes,
+// whitespace included, stays where it is in Children.
+func settleContents(node *XmlNode) {
+	textOnly := true
+	for _, child := range node.Children {
+		if child.Type != TextNode && child.Type != CDataNode {
+			textOnly = false
+		}
+	}
+
+	if textOnly {
+		var sb strings.Builder
+		for _, child := range node.Children {
+			sb.WriteString(child.Contents)
+			node.CData = node.CData || child.Type == CDataNode
+		}
+		node.Children = nil
+		node.Contents = sb.String()
+		return
+	}
+}
+
+// nextEvent reads the next start tag, end tag, run of text, comment or
+// processing instruction from the tokens. It returns io.EOF once the
+// tokens run out, whether or not every element has been closed.
+func (p *parser) nextEvent() (Token, error) {
+	if p.pendingEnd != nil {
+		end := *p.pendingEnd
+		p.pendingEnd = nil
+		p.pop()
+		return end, nil
+	}
+
+	if !p.more {
+		if p.err != nil {
+			return nil, p.err
+		}
+		return nil, io.EOF
+	}
+
+	switch p.Peek().T {
+	case tokeniser.ProcLB:
+		start := p.Peek().Pos
+		instruction, err := p.readProcessingInstruction()
+		if err != nil {
+			return nil, err
+		}
+		return ProcInst{instruction.Name, instruction.Data, instruction.Attributes, Span{start, p.lastEnd()}}, nil
+	case tokeniser.ProcInst:
+		t, err := p.readNext(tokeniser.ProcInst)
+		if err != nil {
+			return nil, err
+		}
+		span := Span{t.Pos, t.End}
+		target, data := splitInstruction(t.Val)
+		if target == "" {
+			return nil, p.errorIn(span, "processing instruction has no target")
+		}
+		return ProcInst{target, data, nil, span}, nil
+	case tokeniser.LB:
+		node := XmlNode{}
+		err := p.readOpeningTag(&node)
+		if err != nil {
+			return nil, err
+		}
+		p.stack = append(p.stack, node.Name)
+		p.opened = append(p.opened, node.Span.Start)
+		err = p.applyAttlist(&node)
+		if err != nil {
+			return nil, err
+		}
+		bindings, err := p.declareNamespaces(node.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		p.bindings = append(p.bindings, bindings)
+		if p.more && p.Peek().T == tokeniser.SelfRB {
+			_, err := p.readNext(tokeniser.SelfRB)
 			if err != nil {
-				return root, err
+				return nil, err
 			}
-		default:
-			// fmt.Println(p.Input[p.curr-10 : p.curr+10])
-			return root, fmt.Errorf("dunno what to do with '%v' at '%d'", p.Peek(), p.curr)
 		}
+		start := StartElement{
+			Name:       node.Name,
+			Attributes: node.Attributes,
+			Span:       Span{node.Span.Start, p.lastEnd()},
+		}
+		err = p.resolveNamespaces(&start)
+		if err != nil {
+			return nil, err
+		}
+		if p.last.T == tokeniser.SelfRB {
+			end := p.lastEnd()
+			p.pendingEnd = &EndElement{Name: start.Name, Namespace: start.Namespace, Span: Span{end, end}}
+		}
+		return start, nil
+	case tokeniser.CloB:
+		start := p.Peek().Pos
+		if len(p.stack) == 0 {
+			return nil, p.errorf("closing tag with no element open")
+		}
+		name := p.stack[len(p.stack)-1]
+		err := p.chompClosingTag(name, p.opened[len(p.opened)-1])
+		if err != nil {
+			return nil, err
+		}
+		prefix, _ := splitName(name)
+		space, _ := p.lookupNamespace(prefix)
+		p.pop()
+		return EndElement{Name: name, Namespace: space, Span: Span{start, p.lastEnd()}}, nil
+	case tokeniser.Comment:
+		t, err := p.readNext(tokeniser.Comment)
+		if err != nil {
+			return nil, err
+		}
+		return Comment{t.Val, Span{t.Pos, t.End}}, nil
+	case tokeniser.CData:
+		t, err := p.readNext(tokeniser.CData)
+		if err != nil {
+			return nil, err
+		}
+		return CharData{t.Val, true, Span{t.Pos, t.End}}, nil
+	case tokeniser.Doctype:
+		if len(p.stack) > 0 {
+			return nil, p.errorf("DOCTYPE is not allowed inside an element")
+		}
+		doctype, err := p.readDoctype()
+		if err != nil {
+			return nil, err
+		}
+		p.useDTD(doctype.DTD)
+		return doctype, nil
+	case tokeniser.Keyword, tokeniser.Whitespace:
+		start := p.Peek().Pos
+		contents, err := p.readContents()
+		if err != nil {
+			return nil, err
+		}
+		if contents == "" {
+			// The text began with an entity holding markup
+			return p.nextEvent()
+		}
+		return CharData{contents, false, Span{start, p.lastEnd()}}, nil
+	default:
+		return nil, p.errorf("dunno what to do with '%v'", p.Peek().Val)
 	}
+}
 
-	return root, nil
+func (p *parser) pop() {
+	p.stack = p.stack[:len(p.stack)-1]
+	p.opened = p.opened[:len(p.opened)-1]
+	p.bindings = p.bindings[:len(p.bindings)-1]
 }
 
 func (p *parser) readNext(expected tokeniser.TokenType) (tokeniser.Token, error) {
-	if p.curr >= p.l {
-		return tokeniser.Token{}, fmt.Errorf("at end of input but expecting '%v'", expected)
+	if !p.more {
+		err := p.errorf("at end of input but expecting %v", expected)
+		err.Expected = []tokeniser.TokenType{expected}
+		return tokeniser.Token{}, err
 	}
-	t := p.Input[p.curr]
+	t := p.next
 	if t.T != expected {
-		return t, fmt.Errorf("token incorrect type. want '%v' got '%v'", expected, t.T)
+		err := p.errorf("expected %v but got %v '%v'", expected, t.T, t.Val)
+		err.Expected = []tokeniser.TokenType{expected}
+		return t, err
 	}
-	p.curr++
+	p.last = t
+	p.read = true
+	p.advance()
 	return t, nil
 }
 
 func (p *parser) Peek() tokeniser.Token {
-	return p.Input[p.curr]
+	return p.next
 }
 
 func (p *parser) readOpeningTag(root *XmlNode) error {
-	_, err := p.readNext(tokeniser.LB)
+	lb, err := p.readNext(tokeniser.LB)
 	if err != nil {
-		return fmt.Errorf("failed to read name tag. %v", err)
+		return err
 	}
+	root.Span.Start = lb.Pos
 
 	nameToken, err := p.readNext(tokeniser.Keyword)
 	if err != nil {
@@ -133,7 +482,7 @@ func (p *parser) readOpeningTag(root *XmlNode) error {
 
 	root.Name = nameToken.Val
 
-	for p.curr < p.l {
+	for p.more {
 		switch p.Peek().T {
 		case tokeniser.RB:
 			_, err = p.readNext(tokeniser.RB)
@@ -149,98 +498,130 @@ func (p *parser) readOpeningTag(root *XmlNode) error {
 				return err
 			}
 		case tokeniser.Keyword:
-			key, val, err := p.readAttr()
+			attr, err := p.readAttr()
 			if err != nil {
-				return fmt.Errorf("error reading attr. %s", err)
+				return err
 			}
-			root.Attributes = append(root.Attributes, Attribute{key, val})
+			root.Attributes = append(root.Attributes, attr)
 		default:
-			return fmt.Errorf("did not expect '%v' while reading opening tag", p.Peek())
+			return p.errorf("did not expect '%v' while reading opening tag", p.Peek().Val)
 		}
 	}
 
 	return nil
 }
 
-func (p *parser) readProcessingInstruction(root *XmlNode) error {
+// splitInstruction splits the text of a processing instruction into its
+// target and the data after it.
+func splitInstruction(text string) (string, string) {
+	i := strings.IndexFunc(text, unicode.IsSpace)
+	if i < 0 {
+		return text, ""
+	}
+	return text[:i], strings.TrimLeftFunc(text[i:], unicode.IsSpace)
+}
+
+// readProcessingInstruction reads the XML declaration, the only processing
+// instruction split into tokens, and its pseudo-attributes.
+func (p *parser) readProcessingInstruction() (Instruction, error) {
 	_, err := p.readNext(tokeniser.ProcLB)
 	if err != nil {
-		return fmt.Errorf("failed to read name tag. %v", err)
+		return Instruction{}, err
 	}
 
 	nameToken, err := p.readNext(tokeniser.Keyword)
 	if err != nil {
-		return err
+		return Instruction{}, err
 	}
 
 	var attrs []Attribute
 
-	for {
+	for p.more {
 		switch p.Peek().T {
 		case tokeniser.ProcRB:
 			_, err = p.readNext(tokeniser.ProcRB)
 			if err != nil {
-				return err
+				return Instruction{}, err
 			}
-			root.Instructions = append(root.Instructions, Instruction{
+			var data strings.Builder
+			printAttributes(&data, attrs)
+			return Instruction{
 				nameToken.Val,
 				attrs,
-			})
-			return nil
+				strings.TrimPrefix(data.String(), " "),
+			}, nil
 		case tokeniser.Whitespace:
 			_, err = p.readNext(tokeniser.Whitespace)
 			if err != nil {
-				return err
+				return Instruction{}, err
 			}
 		case tokeniser.Keyword:
-			key, val, err := p.readAttr()
+			attr, err := p.readAttr()
 			if err != nil {
-				return fmt.Errorf("error reading attr. %s", err)
+				return Instruction{}, err
 			}
-			attrs = append(attrs, Attribute{key, val})
+			attrs = append(attrs, attr)
 		default:
-			return fmt.Errorf("did not expect '%v' while reading processing instruction", p.Peek())
+			return Instruction{}, p.errorf("did not expect '%v' while reading processing instruction", p.Peek().Val)
 		}
 	}
+
+	_, err = p.readNext(tokeniser.ProcRB)
+	return Instruction{}, err
 }
 
-func (p *parser) readAttr() (string, string, error) {
+func (p *parser) readAttr() (Attribute, error) {
 	key, err := p.readNext(tokeniser.Keyword)
 	if err != nil {
-		return "", "", err
+		return Attribute{}, err
 	}
+	p.skipWhitespace()
 	_, err = p.readNext(tokeniser.EQ)
 	if err != nil {
-		return "", "", err
+		return Attribute{}, err
 	}
+	p.skipWhitespace()
 	val, err := p.readNext(tokeniser.String)
 	if err != nil {
-		return "", "", err
+		return Attribute{}, err
 	}
-	return key.Val, val.Val, nil
+	decoded, err := p.decodeEntities(val.Val)
+	if err != nil {
+		return Attribute{}, p.errorAt(val, err)
+	}
+	return Attribute{
+		Key:   key.Val,
+		Value: decoded,
+		Span:  Span{key.Pos, val.End},
+	}, nil
 }
 
 func (p *parser) readContents() (string, error) {
 	var sb strings.Builder
 
-	for p.curr < p.l {
+	for p.more {
 		switch p.Peek().T {
 		case tokeniser.Keyword:
 			t, err := p.readNext(tokeniser.Keyword)
 			if err != nil {
 				return "", err
 			}
-			sb.WriteString(t.Val)
-
-		case tokeniser.Whitespace:
-			t, err := p.readNext(tokeniser.Whitespace)
+			if start, end, ok := p.markupReference(t.Val); ok {
+				val, err := p.decodeEntities(t.Val[:start])
+				if err != nil {
+					return "", p.errorAt(t, err)
+				}
+				sb.WriteString(val)
+				return sb.String(), p.spliceEntity(t, start, end)
+			}
+			val, err := p.decodeEntities(t.Val)
 			if err != nil {
-				return "", err
+				return "", p.errorAt(t, err)
 			}
-			sb.WriteString(t.Val)
+			sb.WriteString(val)
 
-		case tokeniser.EQ:
-			t, err := p.readNext(tokeniser.EQ)
+		case tokeniser.Whitespace:
+			t, err := p.readNext(tokeniser.Whitespace)
 			if err != nil {
 				return "", err
 			}
@@ -254,22 +635,98 @@ func (p *parser) readContents() (string, error) {
 	return sb.String(), nil
 }
 
-func (p *parser) chompClosingTag(rootName string) error {
-	_, err := p.readNext(tokeniser.CloB)
+// skipWhitespace reads past any whitespace inside a tag.
+func (p *parser) skipWhitespace() {
+	for p.more && p.Peek().T == tokeniser.Whitespace {
+		p.readNext(tokeniser.Whitespace)
+	}
+}
+
+// markupReference finds the first reference in text to a declared entity
+// that expands to markup, giving where it starts and ends.
+func (p *parser) markupReference(text string) (int, int, bool) {
+	if p.expander == nil {
+		return 0, 0, false
+	}
+	for start := 0; ; {
+		amp := strings.IndexByte(text[start:], '&')
+		if amp < 0 {
+			return 0, 0, false
+		}
+		amp += start
+		semi := strings.IndexByte(text[amp:], ';')
+		if semi < 0 {
+			return 0, 0, false
+		}
+		end := amp + semi + 1
+		name := text[amp+1 : end-1]
+		if p.expander.declares(name) && p.expander.hasMarkup(name) {
+			return amp, end, true
+		}
+		start = end
+	}
+}
+
+// spliceEntity reads the replacement text of the entity referenced at
+// text[start:end] in t as if it had been written there, followed by the
+// rest of t. Everything read from it is placed at the reference.
+func (p *parser) spliceEntity(t tokeniser.Token, start, end int) error {
+	name := t.Val[start+1 : end-1]
+	val, err := p.expander.expand(name)
+	if err != nil {
+		return p.errorAt(t, err)
+	}
+	ter := tokeniser.NewTokeniser(val)
+	tokens, err := ter.Tokenise()
+	if err != nil {
+		return p.errorAt(t, fmt.Errorf("entity '&%s;': %v", name, err))
+	}
+	if !balanced(tokens) {
+		return p.errorAt(t, fmt.Errorf("entity '&%s;' does not close every tag it opens", name))
+	}
+	if end < len(t.Val) {
+		tokens = append(tokens, tokeniser.Token{T: tokeniser.Keyword, Val: t.Val[end:]})
+	}
+	for i := range tokens {
+		tokens[i].Pos, tokens[i].End = t.Pos, t.End
+	}
+
+	if p.more {
+		tokens = append(tokens, p.next)
+	}
+	if ss, ok := p.src.(*splicedSource); ok {
+		ss.tokens = append(tokens, ss.tokens...)
+	} else {
+		p.src = &splicedSource{tokens, p.src}
+	}
+	p.advance()
+	return nil
+}
+
+func (p *parser) chompClosingTag(want string, opened tokeniser.Position) error {
+	clob, err := p.readNext(tokeniser.CloB)
 	if err != nil {
-		return fmt.Errorf("error while chomping at position %d. %v", p.curr, err)
+		return err
 	}
 	nameToken, err := p.readNext(tokeniser.Keyword)
 	if err != nil {
-		return fmt.Errorf("error while chomping. %v", err)
+		return err
 	}
 	name := nameToken.Val
-	if name != rootName {
-		return fmt.Errorf("'%v' did not match '%v'", name, rootName)
+	if name != want {
+		return &MismatchedTagError{
+			File:   p.file,
+			Pos:    clob.Pos,
+			Want:   want,
+			Got:    name,
+			Opened: opened,
+			Stack:  append([]string(nil), p.stack...),
+		}
 	}
+	p.skipWhitespace()
 	_, err = p.readNext(tokeniser.RB)
 	if err != nil {
-		return fmt.Errorf("error while chomping. %v", err)
+		return err
 	}
 	return nil
 }
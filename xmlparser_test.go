@@ -1,8 +1,13 @@
 package xmlparser
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/danwhitford/xmlparser/tokeniser"
 	"github.com/google/go-cmp/cmp"
@@ -127,7 +132,7 @@ func TestParseXml(t *testing.T) {
 			},
 		},
 		{
-			[]tokeniser.Token{ // <foo version="1.0">
+			[]tokeniser.Token{ // <foo version="1.0"></foo>
 				{T: tokeniser.LB, Val: "<"},
 				{T: tokeniser.Keyword, Val: "foo"},
 				{T: tokeniser.Whitespace, Val: " "},
@@ -135,16 +140,20 @@ func TestParseXml(t *testing.T) {
 				{T: tokeniser.EQ, Val: "="},
 				{T: tokeniser.String, Val: "1.0"},
 				{T: tokeniser.RB, Val: ">"},
+
+				{T: tokeniser.CloB, Val: "</"},
+				{T: tokeniser.Keyword, Val: "foo"},
+				{T: tokeniser.RB, Val: ">"},
 			},
 			XmlNode{
 				Name:       "foo",
 				Contents:   "",
 				Children:   nil,
-				Attributes: []Attribute{{"version", "1.0"}},
+				Attributes: []Attribute{{Key: "version", Value: "1.0"}},
 			},
 		},
 		{
-			[]tokeniser.Token{ // <foo version="1.0" type="nonsense">
+			[]tokeniser.Token{ // <foo version="1.0" type="nonsense"></foo>
 				{T: tokeniser.LB, Val: "<"},
 				{T: tokeniser.Keyword, Val: "foo"},
 				{T: tokeniser.Whitespace, Val: " "},
@@ -155,19 +164,23 @@ func TestParseXml(t *testing.T) {
 				{T: tokeniser.EQ, Val: "="},
 				{T: tokeniser.String, Val: "nonsense"},
 				{T: tokeniser.RB, Val: ">"},
+
+				{T: tokeniser.CloB, Val: "</"},
+				{T: tokeniser.Keyword, Val: "foo"},
+				{T: tokeniser.RB, Val: ">"},
 			},
 			XmlNode{
 				Name:     "foo",
 				Contents: "",
 				Children: nil,
 				Attributes: []Attribute{
-					{"version", "1.0"},
-					{"type", "nonsense"},
+					{Key: "version", Value: "1.0"},
+					{Key: "type", Value: "nonsense"},
 				},
 			},
 		},
 		{
-			[]tokeniser.Token{ //<?xml version="1.0" encoding="UTF-8"?>
+			[]tokeniser.Token{ //<?xml version="1.0" encoding="UTF-8"?><foo/>
 				{T: tokeniser.ProcLB, Val: "<?"},
 				{T: tokeniser.Keyword, Val: "xml"},
 				{T: tokeniser.Whitespace, Val: " "},
@@ -181,15 +194,21 @@ func TestParseXml(t *testing.T) {
 				{T: tokeniser.EQ, Val: "="},
 				{T: tokeniser.String, Val: "UTF-8"},
 				{T: tokeniser.ProcRB, Val: "?>"},
+
+				{T: tokeniser.LB, Val: "<"},
+				{T: tokeniser.Keyword, Val: "foo"},
+				{T: tokeniser.SelfRB, Val: "/>"},
 			},
 			XmlNode{
+				Name: "foo",
 				Instructions: []Instruction{
 					{
 						"xml",
 						[]Attribute{
-							{"version", "1.0"},
-							{"encoding", "UTF-8"},
+							{Key: "version", Value: "1.0"},
+							{Key: "encoding", Value: "UTF-8"},
 						},
+						`version="1.0" encoding="UTF-8"`,
 					},
 				},
 			},
@@ -227,9 +246,10 @@ func TestParseXml(t *testing.T) {
 					{
 						"xml",
 						[]Attribute{
-							{"version", "1.0"},
-							{"encoding", "UTF-8"},
+							{Key: "version", Value: "1.0"},
+							{Key: "encoding", Value: "UTF-8"},
 						},
+						`version="1.0" encoding="UTF-8"`,
 					},
 				},
 				Name:     "foo",
@@ -258,8 +278,8 @@ func TestParseXml(t *testing.T) {
 			XmlNode{
 				Name: "enclosure",
 				Attributes: []Attribute{
-					{"length", "7500000"},
-					{"type", "audio/mpeg"},
+					{Key: "length", Value: "7500000"},
+					{Key: "type", Value: "audio/mpeg"},
 				},
 			},
 		},
@@ -269,9 +289,7 @@ func TestParseXml(t *testing.T) {
 				{T: tokeniser.Keyword, Val: "url"},
 				{T: tokeniser.RB, Val: ">"},
 
-				{T: tokeniser.Keyword, Val: "https://megaphone.imgix.net/podcasts/00c0a118-2426-11ee-b258-73d331d0123b/image/show-cover.jpg?ixlib"},
-				{T: tokeniser.EQ, Val: "="},
-				{T: tokeniser.Keyword, Val: "rails-4.3.1"},
+				{T: tokeniser.Keyword, Val: "https://megaphone.imgix.net/podcasts/00c0a118-2426-11ee-b258-73d331d0123b/image/show-cover.jpg?ixlib=rails-4.3.1"},
 
 				{T: tokeniser.CloB, Val: "</"},
 				{T: tokeniser.Keyword, Val: "url"},
@@ -282,6 +300,50 @@ func TestParseXml(t *testing.T) {
 				Contents: "https://megaphone.imgix.net/podcasts/00c0a118-2426-11ee-b258-73d331d0123b/image/show-cover.jpg?ixlib=rails-4.3.1",
 			},
 		},
+		{
+			[]tokeniser.Token{ // <foo><!-- note --><bar/></foo>
+				{T: tokeniser.LB, Val: "<"},
+				{T: tokeniser.Keyword, Val: "foo"},
+				{T: tokeniser.RB, Val: ">"},
+
+				{T: tokeniser.Comment, Val: " note "},
+
+				{T: tokeniser.LB, Val: "<"},
+				{T: tokeniser.Keyword, Val: "bar"},
+				{T: tokeniser.SelfRB, Val: "/>"},
+
+				{T: tokeniser.CloB, Val: "</"},
+				{T: tokeniser.Keyword, Val: "foo"},
+				{T: tokeniser.RB, Val: ">"},
+			},
+			XmlNode{
+				Name: "foo",
+				Children: []XmlNode{
+					{Type: CommentNode, Contents: " note "},
+					{Name: "bar"},
+				},
+			},
+		},
+		{
+			[]tokeniser.Token{ // <foo>bar <![CDATA[<b>baz</b>]]></foo>
+				{T: tokeniser.LB, Val: "<"},
+				{T: tokeniser.Keyword, Val: "foo"},
+				{T: tokeniser.RB, Val: ">"},
+
+				{T: tokeniser.Keyword, Val: "bar"},
+				{T: tokeniser.Whitespace, Val: " "},
+				{T: tokeniser.CData, Val: "<b>baz</b>"},
+
+				{T: tokeniser.CloB, Val: "</"},
+				{T: tokeniser.Keyword, Val: "foo"},
+				{T: tokeniser.RB, Val: ">"},
+			},
+			XmlNode{
+				Name:     "foo",
+				Contents: "bar <b>baz</b>",
+				CData:    true,
+			},
+		},
 	}
 
 	for i, tst := range table {
@@ -297,3 +359,331 @@ func TestParseXml(t *testing.T) {
 		})
 	}
 }
+
+func TestParseEntities(t *testing.T) {
+	got, err := ParseWithEntities(`<foo title="Q&amp;A &#x2014; &company;">Tom &amp; Jerry&#8217;s</foo>`, map[string]string{
+		"company": "Acme",
+	})
+	if err != nil {
+		t.Fatalf("did not want an error. %v", err)
+	}
+	want := XmlNode{
+		Name:       "foo",
+		Contents:   "Tom & Jerry\u2019s",
+		Attributes: []Attribute{{Key: "title", Value: "Q&A \u2014 Acme"}},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty(), cmpopts.IgnoreTypes(Span{})); diff != "" {
+		t.Fatalf("wrong parse with diff '%v'", diff)
+	}
+
+	_, err = Parse(`<foo>&company;</foo>`)
+	if err == nil {
+		t.Fatal("wanted an error for an unknown entity")
+	}
+}
+
+func TestParseSpans(t *testing.T) {
+	got, err := Parse("<a>\n\t<b x=\"1\"/>\n\t<!--c-->\n</a>")
+	if err != nil {
+		t.Fatalf("did not want an error. %v", err)
+	}
+	want := XmlNode{
+		Name: "a",
+		Span: Span{tokeniser.Position{Offset: 0, Line: 1, Col: 1}, tokeniser.Position{Offset: 30, Line: 4, Col: 5}},
+		Children: []XmlNode{
+			{
+				Type:     TextNode,
+				Contents: "\n\t",
+				Span:     Span{tokeniser.Position{Offset: 3, Line: 1, Col: 4}, tokeniser.Position{Offset: 5, Line: 2, Col: 2}},
+			},
+			{
+				Name: "b",
+				Attributes: []Attribute{{
+					Key:   "x",
+					Value: "1",
+					Span:  Span{tokeniser.Position{Offset: 8, Line: 2, Col: 5}, tokeniser.Position{Offset: 13, Line: 2, Col: 10}},
+				}},
+				Span: Span{tokeniser.Position{Offset: 5, Line: 2, Col: 2}, tokeniser.Position{Offset: 15, Line: 2, Col: 12}},
+			},
+			{
+				Type:     TextNode,
+				Contents: "\n\t",
+				Span:     Span{tokeniser.Position{Offset: 15, Line: 2, Col: 12}, tokeniser.Position{Offset: 17, Line: 3, Col: 2}},
+			},
+			{
+				Type:     CommentNode,
+				Contents: "c",
+				Span:     Span{tokeniser.Position{Offset: 17, Line: 3, Col: 2}, tokeniser.Position{Offset: 25, Line: 3, Col: 10}},
+			},
+			{
+				Type:     TextNode,
+				Contents: "\n",
+				Span:     Span{tokeniser.Position{Offset: 25, Line: 3, Col: 10}, tokeniser.Position{Offset: 26, Line: 4, Col: 1}},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Fatalf("wrong spans with diff '%v'", diff)
+	}
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	table := []struct {
+		input string
+		want  string
+	}{
+		{
+			"<a>\n\t<b>text</c>\n</a>",
+			"2:9: closing tag 'c' does not match 'b' opened at 2:2",
+		},
+		{
+			"<a>\n\t<!-- oops\n</a>",
+			"2:2: unterminated comment (in /a)",
+		},
+		{
+			"<a>\n\t<b x=1/>\n</a>",
+			"2:7: expected String but got Keyword '1' (in /a)",
+		},
+		{
+			"",
+			"1:1: no content to parse",
+		},
+		{
+			"<a><? b?></a>",
+			"1:4: processing instruction has no target (in /a)",
+		},
+		{
+			"<a><b>",
+			"1:7: at end of input but 'b' is still open (in /a/b)",
+		},
+		{
+			"<a/>junk<b>",
+			"1:5: text is not allowed outside of the root element",
+		},
+		{
+			"<a/>\n<b/>",
+			"2:1: a document can only have one root element (in /b)",
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := Parse(tst.input)
+			if err == nil {
+				t.Fatalf("wanted an error for input '%v'", tst.input)
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Fatalf("wrong error for input '%v' with diff '%v'", tst.input, diff)
+			}
+		})
+	}
+}
+
+func TestParseErrorTypes(t *testing.T) {
+	_, err := ParseFile("testdata/does-not-exist.xml")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("wanted a not exist error but got %v", err)
+	}
+
+	_, err = Parse("<a>\n\t<b>\n\t\t<c x=\"1\" y>\n\t</b>\n</a>")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("wanted a SyntaxError but got %v", err)
+	}
+	want := &SyntaxError{
+		Pos:      tokeniser.Position{Offset: 21, Line: 3, Col: 13},
+		Msg:      "expected EQ but got RB '>'",
+		Expected: []tokeniser.TokenType{tokeniser.EQ},
+		Got:      tokeniser.RB,
+		Stack:    []string{"a", "b"},
+	}
+	if diff := cmp.Diff(want, syntaxErr); diff != "" {
+		t.Fatalf("wrong error with diff '%v'", diff)
+	}
+
+	_, err = Parse("<a>\n\t<b x=")
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("wanted a SyntaxError but got %v", err)
+	}
+	if syntaxErr.Got != tokeniser.EOF {
+		t.Fatalf("wanted to run out of input but got %v", syntaxErr.Got)
+	}
+
+	_, err = Parse("<a>\n\t<b></a>\n</b>")
+	var mismatchErr *MismatchedTagError
+	if !errors.As(err, &mismatchErr) {
+		t.Fatalf("wanted a MismatchedTagError but got %v", err)
+	}
+	wantMismatch := &MismatchedTagError{
+		Pos:    tokeniser.Position{Offset: 8, Line: 2, Col: 5},
+		Want:   "b",
+		Got:    "a",
+		Opened: tokeniser.Position{Offset: 5, Line: 2, Col: 2},
+		Stack:  []string{"a", "b"},
+	}
+	if diff := cmp.Diff(wantMismatch, mismatchErr); diff != "" {
+		t.Fatalf("wrong error with diff '%v'", diff)
+	}
+}
+
+func TestParseReaderErrors(t *testing.T) {
+	readErr := errors.New("connection reset")
+	_, err := ParseReader(io.MultiReader(strings.NewReader("<a><b>text"), iotest.ErrReader(readErr)))
+	if !errors.Is(err, readErr) {
+		t.Fatalf("wanted the read error but got %v", err)
+	}
+
+	_, err = ParseReader(strings.NewReader("<a>\n<!-- no end</a>"))
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("wanted a SyntaxError but got %v", err)
+	}
+	if diff := cmp.Diff("2:1: unterminated comment (in /a)", err.Error()); diff != "" {
+		t.Fatalf("wrong error with diff '%v'", diff)
+	}
+
+	_, err = ParseReader(iotest.OneByteReader(strings.NewReader("<rss><channel><title>x</title>")))
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("wanted a SyntaxError but got %v", err)
+	}
+	if diff := cmp.Diff("1:31: at end of input but 'channel' is still open (in /rss/channel)", err.Error()); diff != "" {
+		t.Fatalf("wrong error with diff '%v'", diff)
+	}
+}
+
+func TestParseMixedContent(t *testing.T) {
+	table := []struct {
+		input string
+		want  XmlNode
+	}{
+		{
+			`<p>Hello <b>world</b> again</p>`,
+			XmlNode{
+				Name: "p",
+				Children: []XmlNode{
+					{Type: TextNode, Contents: "Hello "},
+					{Name: "b", Contents: "world"},
+					{Type: TextNode, Contents: " again"},
+				},
+			},
+		},
+		{
+			"<div>\n\t<p>Hi <em>there</em>, <![CDATA[<you>]]><?tick?></p>\n\t<?page break=\"yes\"?>\n</div>",
+			XmlNode{
+				Name: "div",
+				Children: []XmlNode{
+					{Type: TextNode, Contents: "\n\t"},
+					{Name: "p", Children: []XmlNode{
+						{Type: TextNode, Contents: "Hi "},
+						{Name: "em", Contents: "there"},
+						{Type: TextNode, Contents: ", "},
+						{Type: CDataNode, Contents: "<you>"},
+						{Type: ProcInstNode, Name: "tick"},
+					}},
+					{Type: TextNode, Contents: "\n\t"},
+					{Type: ProcInstNode, Name: "page", Contents: `break="yes"`},
+					{Type: TextNode, Contents: "\n"},
+				},
+			},
+		},
+		{
+			"<?php echo 1; ?><a><?pi d?></a>",
+			XmlNode{
+				Instructions: []Instruction{{Name: "php", Data: "echo 1; "}},
+				Name:         "a",
+				Children: []XmlNode{
+					{Type: ProcInstNode, Name: "pi", Contents: "d"},
+				},
+			},
+		},
+		{
+			"<a> <!-- just a comment --> </a>",
+			XmlNode{
+				Name: "a",
+				Children: []XmlNode{
+					{Type: TextNode, Contents: " "},
+					{Type: CommentNode, Contents: " just a comment "},
+					{Type: TextNode, Contents: " "},
+				},
+			},
+		},
+		{
+			"<p><b>Hello</b> <i>world</i></p>",
+			XmlNode{
+				Name: "p",
+				Children: []XmlNode{
+					{Name: "b", Contents: "Hello"},
+					{Type: TextNode, Contents: " "},
+					{Name: "i", Contents: "world"},
+				},
+			},
+		},
+		{
+			"<a><b/>&#32;<c/></a>",
+			XmlNode{
+				Name: "a",
+				Children: []XmlNode{
+					{Name: "b"},
+					{Type: TextNode, Contents: " "},
+					{Name: "c"},
+				},
+			},
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			got, err := Parse(tst.input)
+			if err != nil {
+				t.Fatalf("failed on input '%v'. %v.", tst.input, err)
+			}
+			if diff := cmp.Diff(tst.want, got, cmpopts.EquateEmpty(), cmpopts.IgnoreTypes(Span{})); diff != "" {
+				t.Fatalf("failed on input '%v' with diff '%v'", tst.input, diff)
+			}
+		})
+	}
+}
+
+func TestParseTagWhitespace(t *testing.T) {
+	table := []struct {
+		input string
+		want  XmlNode
+	}{
+		{
+			"<item\n  url=\"u\"/>",
+			XmlNode{Name: "item", Attributes: []Attribute{{Key: "url", Value: "u"}}},
+		},
+		{
+			"<a\tb='1'/>",
+			XmlNode{Name: "a", Attributes: []Attribute{{Key: "b", Value: "1"}}},
+		},
+		{
+			"<a\r\n>x</a\n>",
+			XmlNode{Name: "a", Contents: "x"},
+		},
+		{
+			"<a>x > y</a>",
+			XmlNode{Name: "a", Contents: "x > y"},
+		},
+		{
+			`<a b = "it's" c='say "hi"'>'quoted' &amp; "more" = less</a>`,
+			XmlNode{
+				Name:       "a",
+				Contents:   `'quoted' & "more" = less`,
+				Attributes: []Attribute{{Key: "b", Value: "it's"}, {Key: "c", Value: `say "hi"`}},
+			},
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			got, err := Parse(tst.input)
+			if err != nil {
+				t.Fatalf("failed on input '%v'. %v.", tst.input, err)
+			}
+			if diff := cmp.Diff(tst.want, got, cmpopts.EquateEmpty(), cmpopts.IgnoreTypes(Span{})); diff != "" {
+				t.Fatalf("failed on input '%v' with diff '%v'", tst.input, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,644 @@
+package xmlparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PathError reports an XPath expression that could not be compiled or
+// evaluated. Pos is the byte offset in Expr the problem was found at.
+type PathError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("xpath '%s' at %d: %s", e.Expr, e.Pos+1, e.Msg)
+}
+
+type xpathTokenKind int
+
+const (
+	xpathEnd xpathTokenKind = iota
+	xpathName
+	xpathOperator
+	xpathLiteral
+	xpathNumber
+	xpathVariable
+	xpathPunct
+)
+
+type xpathToken struct {
+	kind xpathTokenKind
+	text string
+	pos  int
+}
+
+// lexXPath splits an expression into tokens. Following the XPath rules,
+// '*' and the names and, or, div and mod are operators whenever there is
+// a token before them that could end an operand.
+func lexXPath(expr string) ([]xpathToken, error) {
+	var tokens []xpathToken
+	i := 0
+	operand := func() bool {
+		if len(tokens) == 0 {
+			return false
+		}
+		prev := tokens[len(tokens)-1]
+		switch prev.kind {
+		case xpathOperator:
+			return false
+		case xpathPunct:
+			return prev.text == ")" || prev.text == "]" || prev.text == "." || prev.text == ".."
+		}
+		return true
+	}
+	for {
+		for i < len(expr) && strings.ContainsRune(" \t\r\n", rune(expr[i])) {
+			i++
+		}
+		if i >= len(expr) {
+			tokens = append(tokens, xpathToken{xpathEnd, "", i})
+			return tokens, nil
+		}
+		start := i
+		c := expr[i]
+		switch {
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, &PathError{expr, start, "unterminated string"}
+			}
+			i += end + 2
+			tokens = append(tokens, xpathToken{xpathLiteral, expr[start+1 : i-1], start})
+		case isDigit(c) || c == '.' && i+1 < len(expr) && isDigit(expr[i+1]):
+			for i < len(expr) && isDigit(expr[i]) {
+				i++
+			}
+			if i < len(expr) && expr[i] == '.' {
+				i++
+				for i < len(expr) && isDigit(expr[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, xpathToken{xpathNumber, expr[start:i], start})
+		case c == '.':
+			i++
+			if i < len(expr) && expr[i] == '.' {
+				i++
+			}
+			tokens = append(tokens, xpathToken{xpathPunct, expr[start:i], start})
+		case c == '$':
+			i++
+			name := scanQName(expr, i)
+			if name == "" {
+				return nil, &PathError{expr, start, "expected a variable name after '$'"}
+			}
+			i += len(name)
+			tokens = append(tokens, xpathToken{xpathVariable, name, start})
+		case c == '*':
+			i++
+			kind := xpathName
+			if operand() {
+				kind = xpathOperator
+			}
+			tokens = append(tokens, xpathToken{kind, "*", start})
+		case strings.HasPrefix(expr[i:], "::"):
+			i += 2
+			tokens = append(tokens, xpathToken{xpathPunct, "::", start})
+		case strings.HasPrefix(expr[i:], "//"), strings.HasPrefix(expr[i:], "!="),
+			strings.HasPrefix(expr[i:], "<="), strings.HasPrefix(expr[i:], ">="):
+			i += 2
+			tokens = append(tokens, xpathToken{xpathOperator, expr[start:i], start})
+		case strings.IndexByte("/|+-=<>", c) >= 0:
+			i++
+			tokens = append(tokens, xpathToken{xpathOperator, expr[start:i], start})
+		case strings.IndexByte("()[]@,", c) >= 0:
+			i++
+			tokens = append(tokens, xpathToken{xpathPunct, expr[start:i], start})
+		default:
+			name := scanQName(expr, i)
+			if name == "" {
+				return nil, &PathError{expr, start, fmt.Sprintf("unexpected '%c'", rune(expr[i]))}
+			}
+			i += len(name)
+			if strings.HasPrefix(expr[i:], ":*") {
+				i += 2
+				name += ":*"
+			}
+			kind := xpathName
+			if operand() && (name == "and" || name == "or" || name == "div" || name == "mod") {
+				kind = xpathOperator
+			}
+			tokens = append(tokens, xpathToken{kind, name, start})
+		}
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || r == '-' || r == '.' || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// scanNCName gives the name without colons at the start of s[i:].
+func scanNCName(s string, i int) string {
+	for j, r := range s[i:] {
+		if j == 0 && !isNameStart(r) || j > 0 && !isNameChar(r) {
+			return s[i : i+j]
+		}
+	}
+	return s[i:]
+}
+
+// scanQName gives the possibly prefixed name at the start of s[i:].
+func scanQName(s string, i int) string {
+	name := scanNCName(s, i)
+	if name == "" {
+		return ""
+	}
+	rest := i + len(name)
+	if rest < len(s) && s[rest] == ':' && !strings.HasPrefix(s[rest:], "::") {
+		if local := scanNCName(s, rest+1); local != "" {
+			return name + ":" + local
+		}
+	}
+	return name
+}
+
+type axis int
+
+const (
+	childAxis axis = iota
+	descendantAxis
+	parentAxis
+	ancestorAxis
+	followingSiblingAxis
+	precedingSiblingAxis
+	followingAxis
+	precedingAxis
+	attributeAxis
+	namespaceAxis
+	selfAxis
+	descendantOrSelfAxis
+	ancestorOrSelfAxis
+)
+
+var axes = map[string]axis{
+	"child":              childAxis,
+	"descendant":         descendantAxis,
+	"parent":             parentAxis,
+	"ancestor":           ancestorAxis,
+	"following-sibling":  followingSiblingAxis,
+	"preceding-sibling":  precedingSiblingAxis,
+	"following":          followingAxis,
+	"preceding":          precedingAxis,
+	"attribute":          attributeAxis,
+	"namespace":          namespaceAxis,
+	"self":               selfAxis,
+	"descendant-or-self": descendantOrSelfAxis,
+	"ancestor-or-self":   ancestorOrSelfAxis,
+}
+
+// reverse reports whether positions on the axis count back towards the
+// start of the document.
+func (a axis) reverse() bool {
+	return a == ancestorAxis || a == ancestorOrSelfAxis || a == precedingAxis || a == precedingSiblingAxis
+}
+
+type testKind int
+
+const (
+	nameTest testKind = iota
+	anyNameTest
+	prefixTest
+	typeTest
+)
+
+// nodeTest picks nodes out of an axis. Prefixes are resolved when the
+// expression is evaluated. A typeTest of rootNav stands for node().
+type nodeTest struct {
+	kind   testKind
+	prefix string
+	local  string
+	node   navKind
+	target string
+}
+
+var nodeTypes = map[string]navKind{
+	"node":                   rootNav,
+	"text":                   textNav,
+	"comment":                commentNav,
+	"processing-instruction": procInstNav,
+}
+
+type xpathExpr interface {
+	eval(ctx *xpathContext) (any, error)
+}
+
+type binaryExpr struct {
+	op          string
+	left, right xpathExpr
+	pos         int
+}
+
+type negateExpr struct {
+	operand xpathExpr
+}
+
+type literalExpr struct {
+	value any
+}
+
+type variableExpr struct {
+	name string
+	pos  int
+}
+
+type functionExpr struct {
+	name string
+	fn   *xpathFunction
+	args []xpathExpr
+	pos  int
+}
+
+type filterExpr struct {
+	primary    xpathExpr
+	predicates []xpathExpr
+	pos        int
+}
+
+// pathExpr is a location path, starting from the document node when
+// absolute, from the node-set given by filter when it has one, and from
+// the context node otherwise.
+type pathExpr struct {
+	absolute bool
+	filter   xpathExpr
+	steps    []step
+	pos      int
+}
+
+type step struct {
+	axis       axis
+	test       nodeTest
+	predicates []xpathExpr
+}
+
+type xpathParser struct {
+	expr   string
+	tokens []xpathToken
+	i      int
+}
+
+// compileXPath parses expr into something that can be evaluated.
+func compileXPath(expr string) (xpathExpr, error) {
+	tokens, err := lexXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &xpathParser{expr: expr, tokens: tokens}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != xpathEnd {
+		return nil, p.errorf(t, "unexpected '%s'", t.text)
+	}
+	return e, nil
+}
+
+func (p *xpathParser) peek() xpathToken {
+	return p.tokens[p.i]
+}
+
+func (p *xpathParser) peekAt(n int) xpathToken {
+	if p.i+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.i+n]
+}
+
+func (p *xpathParser) next() xpathToken {
+	t := p.tokens[p.i]
+	if t.kind != xpathEnd {
+		p.i++
+	}
+	return t
+}
+
+func (p *xpathParser) errorf(t xpathToken, format string, args ...any) *PathError {
+	if t.kind == xpathEnd {
+		return &PathError{p.expr, t.pos, "unexpected end of expression"}
+	}
+	return &PathError{p.expr, t.pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *xpathParser) is(kind xpathTokenKind, text string) bool {
+	t := p.peek()
+	return t.kind == kind && t.text == text
+}
+
+func (p *xpathParser) expect(kind xpathTokenKind, text string) error {
+	t := p.next()
+	if t.kind != kind || t.text != text {
+		return p.errorf(t, "expected '%s' but got '%s'", text, t.text)
+	}
+	return nil
+}
+
+// binary parses a left associative run of operands separated by ops.
+func (p *xpathParser) binary(operand func() (xpathExpr, error), ops ...string) (xpathExpr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		found := false
+		for _, op := range ops {
+			found = found || t.kind == xpathOperator && t.text == op
+		}
+		if !found {
+			return left, nil
+		}
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: t.text, left: left, right: right, pos: t.pos}
+	}
+}
+
+func (p *xpathParser) or() (xpathExpr, error) {
+	return p.binary(p.and, "or")
+}
+
+func (p *xpathParser) and() (xpathExpr, error) {
+	return p.binary(p.equality, "and")
+}
+
+func (p *xpathParser) equality() (xpathExpr, error) {
+	return p.binary(p.relational, "=", "!=")
+}
+
+func (p *xpathParser) relational() (xpathExpr, error) {
+	return p.binary(p.additive, "<", "<=", ">", ">=")
+}
+
+func (p *xpathParser) additive() (xpathExpr, error) {
+	return p.binary(p.multiplicative, "+", "-")
+}
+
+func (p *xpathParser) multiplicative() (xpathExpr, error) {
+	return p.binary(p.unary, "*", "div", "mod")
+}
+
+func (p *xpathParser) unary() (xpathExpr, error) {
+	if p.is(xpathOperator, "-") {
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &negateExpr{operand}, nil
+	}
+	return p.binary(p.path, "|")
+}
+
+// path parses a location path, or a filter expression possibly followed
+// by more steps.
+func (p *xpathParser) path() (xpathExpr, error) {
+	t := p.peek()
+	if !p.startsFilter() {
+		return p.locationPath()
+	}
+	filter, err := p.filter()
+	if err != nil {
+		return nil, err
+	}
+	if !p.is(xpathOperator, "/") && !p.is(xpathOperator, "//") {
+		return filter, nil
+	}
+	path := &pathExpr{filter: filter, pos: t.pos}
+	return path, p.steps(path)
+}
+
+func (p *xpathParser) startsFilter() bool {
+	t := p.peek()
+	switch t.kind {
+	case xpathLiteral, xpathNumber, xpathVariable:
+		return true
+	case xpathPunct:
+		return t.text == "("
+	case xpathName:
+		_, isType := nodeTypes[t.text]
+		return !isType && p.peekAt(1).kind == xpathPunct && p.peekAt(1).text == "("
+	}
+	return false
+}
+
+func (p *xpathParser) filter() (xpathExpr, error) {
+	t := p.peek()
+	primary, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	predicates, err := p.predicates()
+	if err != nil {
+		return nil, err
+	}
+	if len(predicates) == 0 {
+		return primary, nil
+	}
+	return &filterExpr{primary: primary, predicates: predicates, pos: t.pos}, nil
+}
+
+func (p *xpathParser) primary() (xpathExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case xpathLiteral:
+		return &literalExpr{t.text}, nil
+	case xpathNumber:
+		f, _ := strconv.ParseFloat(t.text, 64)
+		return &literalExpr{f}, nil
+	case xpathVariable:
+		return &variableExpr{t.text, t.pos}, nil
+	case xpathPunct:
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(xpathPunct, ")")
+	}
+	return p.function(t)
+}
+
+func (p *xpathParser) function(name xpathToken) (xpathExpr, error) {
+	fn, ok := xpathFunctions[name.text]
+	if !ok {
+		return nil, p.errorf(name, "unknown function '%s'", name.text)
+	}
+	p.next()
+	var args []xpathExpr
+	for !p.is(xpathPunct, ")") {
+		if len(args) > 0 {
+			if err := p.expect(xpathPunct, ","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	if len(args) < fn.min || fn.max >= 0 && len(args) > fn.max {
+		return nil, p.errorf(name, "wrong number of arguments to %s()", name.text)
+	}
+	return &functionExpr{name: name.text, fn: fn, args: args, pos: name.pos}, nil
+}
+
+func (p *xpathParser) predicates() ([]xpathExpr, error) {
+	var predicates []xpathExpr
+	for p.is(xpathPunct, "[") {
+		p.next()
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(xpathPunct, "]"); err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, e)
+	}
+	return predicates, nil
+}
+
+func (p *xpathParser) locationPath() (xpathExpr, error) {
+	t := p.peek()
+	path := &pathExpr{pos: t.pos}
+	switch {
+	case p.is(xpathOperator, "/"):
+		path.absolute = true
+		p.next()
+		if !p.startsStep() {
+			return path, nil
+		}
+	case p.is(xpathOperator, "//"):
+		path.absolute = true
+		p.next()
+		path.steps = append(path.steps, anyNode(descendantOrSelfAxis))
+	}
+	s, err := p.step()
+	if err != nil {
+		return nil, err
+	}
+	path.steps = append(path.steps, s)
+	return path, p.steps(path)
+}
+
+// anyNode is the step node() along a.
+func anyNode(a axis) step {
+	return step{axis: a, test: nodeTest{kind: typeTest, node: rootNav}}
+}
+
+func (p *xpathParser) startsStep() bool {
+	t := p.peek()
+	switch t.kind {
+	case xpathName:
+		return true
+	case xpathPunct:
+		return t.text == "@" || t.text == "." || t.text == ".."
+	}
+	return false
+}
+
+// steps parses any '/' or '//' separated steps that follow.
+func (p *xpathParser) steps(path *pathExpr) error {
+	for {
+		switch {
+		case p.is(xpathOperator, "/"):
+			p.next()
+		case p.is(xpathOperator, "//"):
+			p.next()
+			path.steps = append(path.steps, anyNode(descendantOrSelfAxis))
+		default:
+			return nil
+		}
+		s, err := p.step()
+		if err != nil {
+			return err
+		}
+		path.steps = append(path.steps, s)
+	}
+}
+
+func (p *xpathParser) step() (step, error) {
+	if p.is(xpathPunct, ".") {
+		p.next()
+		return anyNode(selfAxis), nil
+	}
+	if p.is(xpathPunct, "..") {
+		p.next()
+		return anyNode(parentAxis), nil
+	}
+
+	s := step{axis: childAxis}
+	if p.is(xpathPunct, "@") {
+		p.next()
+		s.axis = attributeAxis
+	} else if t := p.peek(); t.kind == xpathName && p.peekAt(1).text == "::" {
+		a, ok := axes[t.text]
+		if !ok {
+			return s, p.errorf(t, "unknown axis '%s'", t.text)
+		}
+		s.axis = a
+		p.next()
+		p.next()
+	}
+
+	test, err := p.nodeTest()
+	if err != nil {
+		return s, err
+	}
+	s.test = test
+	s.predicates, err = p.predicates()
+	return s, err
+}
+
+func (p *xpathParser) nodeTest() (nodeTest, error) {
+	t := p.next()
+	if t.kind != xpathName {
+		return nodeTest{}, p.errorf(t, "expected a node test but got '%s'", t.text)
+	}
+	if kind, ok := nodeTypes[t.text]; ok && p.is(xpathPunct, "(") {
+		p.next()
+		test := nodeTest{kind: typeTest, node: kind}
+		if kind == procInstNav && p.peek().kind == xpathLiteral {
+			test.target = p.next().text
+		}
+		return test, p.expect(xpathPunct, ")")
+	}
+	if p.is(xpathPunct, "(") {
+		return nodeTest{}, p.errorf(t, "unknown node type '%s'", t.text)
+	}
+	if t.text == "*" {
+		return nodeTest{kind: anyNameTest}, nil
+	}
+	prefix, local := splitName(t.text)
+	if local == "*" {
+		return nodeTest{kind: prefixTest, prefix: prefix}, nil
+	}
+	return nodeTest{kind: nameTest, prefix: prefix, local: local}, nil
+}
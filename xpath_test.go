@@ -0,0 +1,88 @@
+package xmlparser
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLexXPath(t *testing.T) {
+	table := []struct {
+		input string
+		want  []string
+	}{
+		{"a/b", []string{"a", "/", "b"}},
+		{"* * *", []string{"*", "*", "*"}},
+		{"div div div", []string{"div", "div", "div"}},
+		{"@x and x:*", []string{"@", "x", "and", "x:*"}},
+		{"child::a:b[.5 >= -1.]", []string{"child", "::", "a:b", "[", ".5", ">=", "-", "1.", "]"}},
+		{"$v != 'a\"b'", []string{"v", "!=", `a"b`}},
+		{"../a-b//.", []string{"..", "/", "a-b", "//", "."}},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			tokens, err := lexXPath(tst.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, token := range tokens[:len(tokens)-1] {
+				got = append(got, token.text)
+			}
+			if diff := cmp.Diff(tst.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestLexXPathOperators(t *testing.T) {
+	tokens, err := lexXPath("* * div div")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []xpathTokenKind{xpathName, xpathOperator, xpathName, xpathOperator, xpathEnd}
+	var got []xpathTokenKind
+	for _, token := range tokens {
+		got = append(got, token.kind)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestCompileXPathErrors(t *testing.T) {
+	table := []struct {
+		input string
+		want  string
+	}{
+		{"a[", "xpath 'a[' at 3: unexpected end of expression"},
+		{"a/", "xpath 'a/' at 3: unexpected end of expression"},
+		{"/a b", "xpath '/a b' at 4: unexpected 'b'"},
+		{"(1", "xpath '(1' at 3: unexpected end of expression"},
+		{"a[1)", "xpath 'a[1)' at 4: expected ']' but got ')'"},
+		{"foo()", "xpath 'foo()' at 1: unknown function 'foo'"},
+		{"count()", "xpath 'count()' at 1: wrong number of arguments to count()"},
+		{"concat('a')", "xpath 'concat('a')' at 1: wrong number of arguments to concat()"},
+		{"bogus::a", "xpath 'bogus::a' at 1: unknown axis 'bogus'"},
+		{"child::'a'", "xpath 'child::'a'' at 8: expected a node test but got 'a'"},
+		{"a/element()", "xpath 'a/element()' at 3: unknown node type 'element'"},
+		{"'abc", "xpath ''abc' at 1: unterminated string"},
+		{"a!b", "xpath 'a!b' at 2: unexpected '!'"},
+		{"$", "xpath '$' at 1: expected a variable name after '$'"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := compileXPath(tst.input)
+			if err == nil {
+				t.Fatal("wanted an error but got none")
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
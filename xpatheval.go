@@ -0,0 +1,731 @@
+package xmlparser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// nodeSet is an XPath node-set, kept in document order.
+type nodeSet []*navNode
+
+// xpathEnv holds what stays the same across one evaluation.
+type xpathEnv struct {
+	expr       string
+	doc        *navNode
+	namespaces map[string]string
+	variables  map[string]any
+	resolved   map[string]string
+}
+
+type xpathContext struct {
+	node           *navNode
+	position, size int
+	env            *xpathEnv
+}
+
+// evalXPath evaluates e, compiled from source, with n as the context
+// node inside the tree under doc.
+func evalXPath(e xpathExpr, source string, doc, n *navNode, namespaces map[string]string, variables map[string]any) (any, error) {
+	env := &xpathEnv{expr: source, doc: doc, namespaces: namespaces, variables: variables}
+	return e.eval(&xpathContext{node: n, position: 1, size: 1, env: env})
+}
+
+func (env *xpathEnv) errorf(pos int, format string, args ...any) *PathError {
+	return &PathError{env.expr, pos, fmt.Sprintf(format, args...)}
+}
+
+// resolve gives the namespace bound to prefix. Prefixes not bound when
+// the expression is evaluated mean whatever the document first declares
+// them to mean.
+func (env *xpathEnv) resolve(prefix string) (string, bool) {
+	switch prefix {
+	case "":
+		return "", true
+	case "xml":
+		return XMLNamespace, true
+	}
+	if uri, ok := env.namespaces[prefix]; ok {
+		return uri, true
+	}
+	if uri, ok := env.resolved[prefix]; ok {
+		return uri, true
+	}
+	uri, ok := env.doc.lookupPrefix(prefix)
+	if ok {
+		if env.resolved == nil {
+			env.resolved = map[string]string{}
+		}
+		env.resolved[prefix] = uri
+	}
+	return uri, ok
+}
+
+func (e *literalExpr) eval(ctx *xpathContext) (any, error) {
+	return e.value, nil
+}
+
+func (e *variableExpr) eval(ctx *xpathContext) (any, error) {
+	v, ok := ctx.env.variables[e.name]
+	if !ok {
+		return nil, ctx.env.errorf(e.pos, "variable '$%s' is not set", e.name)
+	}
+	return v, nil
+}
+
+func (e *negateExpr) eval(ctx *xpathContext) (any, error) {
+	v, err := e.operand.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return -toNumber(v), nil
+}
+
+func (e *binaryExpr) eval(ctx *xpathContext) (any, error) {
+	left, err := e.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "or":
+		if toBoolean(left) {
+			return true, nil
+		}
+	case "and":
+		if !toBoolean(left) {
+			return false, nil
+		}
+	}
+	right, err := e.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "or", "and":
+		return toBoolean(right), nil
+	case "|":
+		l, lok := left.(nodeSet)
+		r, rok := right.(nodeSet)
+		if !lok || !rok {
+			return nil, ctx.env.errorf(e.pos, "'|' needs node-sets on both sides")
+		}
+		return union(l, r), nil
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compare(e.op, left, right), nil
+	}
+
+	l, r := toNumber(left), toNumber(right)
+	switch e.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "div":
+		return l / r, nil
+	}
+	return math.Mod(l, r), nil
+}
+
+func (e *functionExpr) eval(ctx *xpathContext) (any, error) {
+	args := make([]any, len(e.args))
+	for i, arg := range e.args {
+		v, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := e.fn.call(ctx, args)
+	if err != nil {
+		return nil, ctx.env.errorf(e.pos, "%s(): %v", e.name, err)
+	}
+	return v, nil
+}
+
+func (e *filterExpr) eval(ctx *xpathContext) (any, error) {
+	v, err := e.primary.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.(nodeSet)
+	if !ok {
+		return nil, ctx.env.errorf(e.pos, "only a node-set can be filtered")
+	}
+	return filter(nodes, e.predicates, ctx.env)
+}
+
+func (e *pathExpr) eval(ctx *xpathContext) (any, error) {
+	var nodes nodeSet
+	switch {
+	case e.filter != nil:
+		v, err := e.filter.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		nodes, ok = v.(nodeSet)
+		if !ok {
+			return nil, ctx.env.errorf(e.pos, "a path can only start from a node-set")
+		}
+	case e.absolute:
+		nodes = nodeSet{ctx.env.doc}
+	default:
+		nodes = nodeSet{ctx.node}
+	}
+
+	for _, s := range e.steps {
+		var next nodeSet
+		for _, n := range nodes {
+			found, err := s.apply(n, ctx.env)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, found...)
+		}
+		nodes = inDocumentOrder(next)
+	}
+	return nodes, nil
+}
+
+// apply gives the nodes the step selects from n, in the order of its axis.
+func (s step) apply(n *navNode, env *xpathEnv) (nodeSet, error) {
+	var found nodeSet
+	principal := elementNav
+	switch s.axis {
+	case attributeAxis:
+		principal = attributeNav
+	case namespaceAxis:
+		principal = namespaceNav
+	}
+	for _, m := range axisNodes(n, s.axis) {
+		if s.test.matches(m, principal, env) {
+			found = append(found, m)
+		}
+	}
+	return filter(found, s.predicates, env)
+}
+
+func (t nodeTest) matches(n *navNode, principal navKind, env *xpathEnv) bool {
+	switch t.kind {
+	case typeTest:
+		if t.node == rootNav {
+			return true
+		}
+		if t.node == procInstNav && t.target != "" {
+			return n.kind == procInstNav && n.node.Name == t.target
+		}
+		return n.kind == t.node
+	case anyNameTest:
+		return n.kind == principal
+	}
+	if n.kind != principal {
+		return false
+	}
+	_, space, local := n.name()
+	uri, ok := env.resolve(t.prefix)
+	if !ok || space != uri {
+		return false
+	}
+	return t.kind == prefixTest || local == t.local
+}
+
+// filter keeps the nodes that pass each predicate in turn. A predicate
+// giving a number keeps only the node at that position.
+func filter(nodes nodeSet, predicates []xpathExpr, env *xpathEnv) (nodeSet, error) {
+	for _, predicate := range predicates {
+		var kept nodeSet
+		for i, n := range nodes {
+			v, err := predicate.eval(&xpathContext{node: n, position: i + 1, size: len(nodes), env: env})
+			if err != nil {
+				return nil, err
+			}
+			keep := false
+			if f, ok := v.(float64); ok {
+				keep = f == float64(i+1)
+			} else {
+				keep = toBoolean(v)
+			}
+			if keep {
+				kept = append(kept, n)
+			}
+		}
+		nodes = kept
+	}
+	return nodes, nil
+}
+
+func axisNodes(n *navNode, a axis) nodeSet {
+	var out nodeSet
+	switch a {
+	case childAxis:
+		return n.children
+	case descendantAxis:
+		return descendants(n, nil)
+	case descendantOrSelfAxis:
+		return descendants(n, nodeSet{n})
+	case parentAxis:
+		if n.parent != nil {
+			out = append(out, n.parent)
+		}
+	case ancestorOrSelfAxis:
+		out = append(out, n)
+		fallthrough
+	case ancestorAxis:
+		for p := n.parent; p != nil; p = p.parent {
+			out = append(out, p)
+		}
+	case selfAxis:
+		out = append(out, n)
+	case attributeAxis:
+		return n.attrs
+	case namespaceAxis:
+		if n.kind == elementNav {
+			return n.namespaces()
+		}
+	case followingSiblingAxis:
+		if isSibling(n) {
+			out = append(out, n.parent.children[n.index+1:]...)
+		}
+	case precedingSiblingAxis:
+		if isSibling(n) {
+			siblings := n.parent.children[:n.index]
+			for i := len(siblings) - 1; i >= 0; i-- {
+				out = append(out, siblings[i])
+			}
+		}
+	case followingAxis:
+		if !isSibling(n) && n.parent != nil {
+			out = descendants(n.parent, nil)
+			n = n.parent
+		}
+		for ; n != nil && isSibling(n); n = n.parent {
+			for _, sibling := range n.parent.children[n.index+1:] {
+				out = descendants(sibling, append(out, sibling))
+			}
+		}
+	case precedingAxis:
+		if !isSibling(n) && n.parent != nil {
+			n = n.parent
+		}
+		for ; n != nil && isSibling(n); n = n.parent {
+			siblings := n.parent.children[:n.index]
+			for i := len(siblings) - 1; i >= 0; i-- {
+				out = reverseDescendants(siblings[i], out)
+				out = append(out, siblings[i])
+			}
+		}
+	}
+	return out
+}
+
+// isSibling reports whether n is one of its parent's children, rather
+// than an attribute or namespace node or the document.
+func isSibling(n *navNode) bool {
+	return n.parent != nil && n.kind != attributeNav && n.kind != namespaceNav
+}
+
+func descendants(n *navNode, out nodeSet) nodeSet {
+	for _, child := range n.children {
+		out = append(out, child)
+		out = descendants(child, out)
+	}
+	return out
+}
+
+func reverseDescendants(n *navNode, out nodeSet) nodeSet {
+	for i := len(n.children) - 1; i >= 0; i-- {
+		out = reverseDescendants(n.children[i], out)
+		out = append(out, n.children[i])
+	}
+	return out
+}
+
+// inDocumentOrder sorts nodes and drops any repeats.
+func inDocumentOrder(nodes nodeSet) nodeSet {
+	if len(nodes) < 2 {
+		return nodes
+	}
+	slices.SortFunc(nodes, func(a, b *navNode) int {
+		switch {
+		case a == b:
+			return 0
+		case a.before(b):
+			return -1
+		}
+		return 1
+	})
+	return slices.Compact(nodes)
+}
+
+func union(a, b nodeSet) nodeSet {
+	return inDocumentOrder(append(slices.Clone(a), b...))
+}
+
+func toString(v any) string {
+	switch v := v.(type) {
+	case nodeSet:
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0].stringValue()
+	case float64:
+		return formatNumber(v)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	return v.(string)
+}
+
+var numberPattern = regexp.MustCompile(`^-?([0-9]+(\.[0-9]*)?|\.[0-9]+)$`)
+
+func toNumber(v any) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	}
+	s := strings.Trim(toString(v), " \t\r\n")
+	if !numberPattern.MatchString(s) {
+		return math.NaN()
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+func toBoolean(v any) bool {
+	switch v := v.(type) {
+	case nodeSet:
+		return len(v) > 0
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case bool:
+		return v
+	}
+	return v.(string) != ""
+}
+
+func formatNumber(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		return "0"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// compare follows the XPath rules, where comparing a node-set holds if it
+// holds for any node in it.
+func compare(op string, left, right any) bool {
+	if isBool(left) || isBool(right) {
+		if _, ok := left.(nodeSet); ok {
+			left = toBoolean(left)
+		}
+		if _, ok := right.(nodeSet); ok {
+			right = toBoolean(right)
+		}
+	}
+	if l, ok := left.(nodeSet); ok {
+		for _, n := range l {
+			if compare(op, nodeValue(n, right), right) {
+				return true
+			}
+		}
+		return false
+	}
+	if r, ok := right.(nodeSet); ok {
+		for _, n := range r {
+			if compare(op, left, nodeValue(n, left)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch op {
+	case "=", "!=":
+		var equal bool
+		switch {
+		case isBool(left) || isBool(right):
+			equal = toBoolean(left) == toBoolean(right)
+		case isNumber(left) || isNumber(right):
+			equal = toNumber(left) == toNumber(right)
+		default:
+			equal = toString(left) == toString(right)
+		}
+		return equal == (op == "=")
+	}
+	l, r := toNumber(left), toNumber(right)
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	}
+	return l >= r
+}
+
+// nodeValue gives the value of n to compare with other.
+func nodeValue(n *navNode, other any) any {
+	if isNumber(other) {
+		return toNumber(n.stringValue())
+	}
+	return n.stringValue()
+}
+
+func isBool(v any) bool {
+	_, ok := v.(bool)
+	return ok
+}
+
+func isNumber(v any) bool {
+	_, ok := v.(float64)
+	return ok
+}
+
+type xpathFunction struct {
+	min, max int
+	call     func(ctx *xpathContext, args []any) (any, error)
+}
+
+var errNotNodeSet = errors.New("expected a node-set")
+
+// contextOr gives the node-set in args, or the context node if there is
+// no argument.
+func contextOr(ctx *xpathContext, args []any) (nodeSet, error) {
+	if len(args) == 0 {
+		return nodeSet{ctx.node}, nil
+	}
+	nodes, ok := args[0].(nodeSet)
+	if !ok {
+		return nil, errNotNodeSet
+	}
+	return nodes, nil
+}
+
+func stringArg(ctx *xpathContext, args []any) string {
+	if len(args) == 0 {
+		return ctx.node.stringValue()
+	}
+	return toString(args[0])
+}
+
+// nameFunction makes one of the functions giving part of the name of the
+// first node in a node-set.
+func nameFunction(part func(name, space, local string) string) *xpathFunction {
+	return &xpathFunction{0, 1, func(ctx *xpathContext, args []any) (any, error) {
+		nodes, err := contextOr(ctx, args)
+		if err != nil || len(nodes) == 0 {
+			return "", err
+		}
+		return part(nodes[0].name()), nil
+	}}
+}
+
+func stringFunction(min, max int, fn func(args []string) any) *xpathFunction {
+	return &xpathFunction{min, max, func(ctx *xpathContext, args []any) (any, error) {
+		strs := make([]string, len(args))
+		for i, arg := range args {
+			strs[i] = toString(arg)
+		}
+		return fn(strs), nil
+	}}
+}
+
+func numberFunction(fn func(float64) float64) *xpathFunction {
+	return &xpathFunction{1, 1, func(ctx *xpathContext, args []any) (any, error) {
+		return fn(toNumber(args[0])), nil
+	}}
+}
+
+func isXMLSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+}
+
+// xpathRound rounds halves up, as XPath does.
+func xpathRound(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+	if f < 0 && f >= -0.5 {
+		return math.Copysign(0, -1)
+	}
+	return math.Floor(f + 0.5)
+}
+
+var xpathFunctions = map[string]*xpathFunction{
+	"last": {0, 0, func(ctx *xpathContext, args []any) (any, error) {
+		return float64(ctx.size), nil
+	}},
+	"position": {0, 0, func(ctx *xpathContext, args []any) (any, error) {
+		return float64(ctx.position), nil
+	}},
+	"count": {1, 1, func(ctx *xpathContext, args []any) (any, error) {
+		nodes, ok := args[0].(nodeSet)
+		if !ok {
+			return nil, errNotNodeSet
+		}
+		return float64(len(nodes)), nil
+	}},
+	"id": {1, 1, func(ctx *xpathContext, args []any) (any, error) {
+		return idFunction(ctx, args[0]), nil
+	}},
+	"local-name": nameFunction(func(name, space, local string) string {
+		return local
+	}),
+	"namespace-uri": nameFunction(func(name, space, local string) string {
+		return space
+	}),
+	"name": nameFunction(func(name, space, local string) string {
+		return name
+	}),
+	"string": {0, 1, func(ctx *xpathContext, args []any) (any, error) {
+		return stringArg(ctx, args), nil
+	}},
+	"concat": stringFunction(2, -1, func(args []string) any {
+		return strings.Join(args, "")
+	}),
+	"starts-with": stringFunction(2, 2, func(args []string) any {
+		return strings.HasPrefix(args[0], args[1])
+	}),
+	"contains": stringFunction(2, 2, func(args []string) any {
+		return strings.Contains(args[0], args[1])
+	}),
+	"substring-before": stringFunction(2, 2, func(args []string) any {
+		before, _, found := strings.Cut(args[0], args[1])
+		if !found {
+			return ""
+		}
+		return before
+	}),
+	"substring-after": stringFunction(2, 2, func(args []string) any {
+		_, after, _ := strings.Cut(args[0], args[1])
+		return after
+	}),
+	"substring": {2, 3, func(ctx *xpathContext, args []any) (any, error) {
+		start := xpathRound(toNumber(args[1]))
+		end := math.Inf(1)
+		if len(args) == 3 {
+			end = start + xpathRound(toNumber(args[2]))
+		}
+		var sb strings.Builder
+		for i, r := range []rune(toString(args[0])) {
+			p := float64(i + 1)
+			if p >= start && p < end {
+				sb.WriteRune(r)
+			}
+		}
+		return sb.String(), nil
+	}},
+	"string-length": {0, 1, func(ctx *xpathContext, args []any) (any, error) {
+		return float64(len([]rune(stringArg(ctx, args)))), nil
+	}},
+	"normalize-space": {0, 1, func(ctx *xpathContext, args []any) (any, error) {
+		return strings.Join(strings.FieldsFunc(stringArg(ctx, args), isXMLSpace), " "), nil
+	}},
+	"translate": stringFunction(3, 3, func(args []string) any {
+		from, to := []rune(args[1]), []rune(args[2])
+		return strings.Map(func(r rune) rune {
+			i := slices.Index(from, r)
+			switch {
+			case i < 0:
+				return r
+			case i < len(to):
+				return to[i]
+			}
+			return -1
+		}, args[0])
+	}),
+	"boolean": {1, 1, func(ctx *xpathContext, args []any) (any, error) {
+		return toBoolean(args[0]), nil
+	}},
+	"not": {1, 1, func(ctx *xpathContext, args []any) (any, error) {
+		return !toBoolean(args[0]), nil
+	}},
+	"true": {0, 0, func(ctx *xpathContext, args []any) (any, error) {
+		return true, nil
+	}},
+	"false": {0, 0, func(ctx *xpathContext, args []any) (any, error) {
+		return false, nil
+	}},
+	"lang": {1, 1, func(ctx *xpathContext, args []any) (any, error) {
+		return langFunction(ctx.node, toString(args[0])), nil
+	}},
+	"number": {0, 1, func(ctx *xpathContext, args []any) (any, error) {
+		if len(args) == 0 {
+			return toNumber(ctx.node.stringValue()), nil
+		}
+		return toNumber(args[0]), nil
+	}},
+	"sum": {1, 1, func(ctx *xpathContext, args []any) (any, error) {
+		nodes, ok := args[0].(nodeSet)
+		if !ok {
+			return nil, errNotNodeSet
+		}
+		total := 0.0
+		for _, n := range nodes {
+			total += toNumber(n.stringValue())
+		}
+		return total, nil
+	}},
+	"floor":   numberFunction(math.Floor),
+	"ceiling": numberFunction(math.Ceil),
+	"round":   numberFunction(xpathRound),
+}
+
+// idFunction finds the elements with the given IDs. Without a DTD to say
+// which attributes are IDs, xml:id and id attributes are taken to be.
+func idFunction(ctx *xpathContext, arg any) nodeSet {
+	var ids []string
+	if nodes, ok := arg.(nodeSet); ok {
+		for _, n := range nodes {
+			ids = append(ids, strings.FieldsFunc(n.stringValue(), isXMLSpace)...)
+		}
+	} else {
+		ids = strings.FieldsFunc(toString(arg), isXMLSpace)
+	}
+
+	var found nodeSet
+	for _, n := range descendants(ctx.env.doc, nil) {
+		for _, a := range n.attrs {
+			if (a.attr.Key == "id" || a.attr.Key == "xml:id") && slices.Contains(ids, a.attr.Value) {
+				found = append(found, n)
+				break
+			}
+		}
+	}
+	return found
+}
+
+func langFunction(n *navNode, lang string) bool {
+	for ; n != nil; n = n.parent {
+		for _, a := range n.attrs {
+			if a.attr.Namespace == XMLNamespace && a.attr.Local() == "lang" {
+				have := strings.ToLower(a.attr.Value)
+				want := strings.ToLower(lang)
+				return have == want || strings.HasPrefix(have, want+"-")
+			}
+		}
+	}
+	return false
+}
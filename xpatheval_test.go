@@ -0,0 +1,198 @@
+package xmlparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const feedXML = `<rss xmlns:itunes="urn:itunes" version="2.0">
+	<channel xml:lang="en-GB">
+		<title>Feed</title>
+		<item id="a"><title>One</title><itunes:duration>60</itunes:duration></item>
+		<item id="b"><title>Two</title><!--hidden--><desc>Hi <b>bold</b> there</desc></item>
+		<item><title>Three</title><itunes:duration>30</itunes:duration></item>
+	</channel>
+</rss>`
+
+// describeValue prints an XPath result, giving the paths of nodes.
+func describeValue(v any) string {
+	switch v := v.(type) {
+	case nodeSet:
+		var paths []string
+		for _, n := range v {
+			paths = append(paths, n.path())
+		}
+		return strings.Join(paths, " ")
+	case float64:
+		return formatNumber(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return strconv.Quote(v.(string))
+}
+
+func TestEvalXPath(t *testing.T) {
+	root, err := Parse(feedXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := newNavTree(&root)
+
+	table := []struct {
+		expr string
+		want string
+	}{
+		{"/rss/channel/item[itunes:duration]/title", "/rss[1]/channel[1]/item[1]/title[1] /rss[1]/channel[1]/item[3]/title[1]"},
+		{"channel/item[2]/desc/b", "/rss[1]/channel[1]/item[2]/desc[1]/b[1]"},
+		{"//item[last()]/title/text()", "/rss[1]/channel[1]/item[3]/title[1]/text()[1]"},
+		{"//title[. = 'Two']/../@id", "/rss[1]/channel[1]/item[2]/@id"},
+		{"/", "/"},
+		{"//b/ancestor::*[1]", "/rss[1]/channel[1]/item[2]/desc[1]"},
+		{"//b/ancestor-or-self::*[last()]", "/rss[1]"},
+		{"//item[@id='b']/preceding::title", "/rss[1]/channel[1]/title[1] /rss[1]/channel[1]/item[1]/title[1]"},
+		{"//item[@id='b']/preceding::title[1]", "/rss[1]/channel[1]/item[1]/title[1]"},
+		{"//item[@id='b']/preceding-sibling::*[2]", "/rss[1]/channel[1]/title[1]"},
+		{"//item[@id='b']/following-sibling::item/title", "/rss[1]/channel[1]/item[3]/title[1]"},
+		{"//item[@id='b']/following::title", "/rss[1]/channel[1]/item[3]/title[1]"},
+		{"//item/@id/following::title[1]", "/rss[1]/channel[1]/item[1]/title[1] /rss[1]/channel[1]/item[2]/title[1]"},
+		{"//item[2]/comment()", "/rss[1]/channel[1]/item[2]/comment()[1]"},
+		{"//item[2]/node()[2]/self::comment()", "/rss[1]/channel[1]/item[2]/comment()[1]"},
+		{"//desc/text()", "/rss[1]/channel[1]/item[2]/desc[1]/text()[1] /rss[1]/channel[1]/item[2]/desc[1]/text()[2]"},
+		{"//item/*[local-name()='duration'][. > 40]", "/rss[1]/channel[1]/item[1]/itunes:duration[1]"},
+		{"//itunes:*", "/rss[1]/channel[1]/item[1]/itunes:duration[1] /rss[1]/channel[1]/item[3]/itunes:duration[1]"},
+		{"(//title)[2]", "/rss[1]/channel[1]/item[1]/title[1]"},
+		{"//item[position() mod 2 = 1]/@id", "/rss[1]/channel[1]/item[1]/@id"},
+		{"//item[not(@id)] | //item[@id='a']", "/rss[1]/channel[1]/item[1] /rss[1]/channel[1]/item[3]"},
+		{"id('b a')", "/rss[1]/channel[1]/item[1] /rss[1]/channel[1]/item[2]"},
+		{"/*/namespace::itunes", "/rss[1]/namespace::itunes"},
+		{"count(/rss/namespace::*)", "2"},
+		{"count(//title)", "4"},
+		{"sum(//itunes:duration) div 2", "45"},
+		{"string(//desc)", `"Hi bold there"`},
+		{"name(//*[namespace-uri()='urn:itunes'])", `"itunes:duration"`},
+		{"local-name(//itunes:duration)", `"duration"`},
+		{"concat(//item[1]/@id, '-', count(//item))", `"a-3"`},
+		{"substring('12345', 1.5, 2.6)", `"234"`},
+		{"substring('12345', 0, 3)", `"12"`},
+		{"substring('12345', 0 div 0, 3)", `""`},
+		{"substring-before('2024-01', '-')", `"2024"`},
+		{"substring-after('2024-01', '-')", `"01"`},
+		{"translate('bar', 'abr', 'AB')", `"BA"`},
+		{"normalize-space('  a   b  ')", `"a b"`},
+		{"string-length(//item[1]/title)", "3"},
+		{"starts-with(//title, 'Fe') and contains(//title, 'ee')", "true"},
+		{"lang('en')", "false"},
+		{"//item[lang('EN')]/@id", "/rss[1]/channel[1]/item[1]/@id /rss[1]/channel[1]/item[2]/@id"},
+		{"round(2.5)", "3"},
+		{"round(-2.5)", "-2"},
+		{"floor(-1.5) + ceiling(1.2)", "0"},
+		{"1 div 0", "Infinity"},
+		{"-1 div 0", "-Infinity"},
+		{"0 div 0", "NaN"},
+		{"-3 mod 2", "-1"},
+		{"2 * 3 - -1", "7"},
+		{"number(' 12 ')", "12"},
+		{"number('1e3')", "NaN"},
+		{"string(1.50)", `"1.5"`},
+		{"1 = '1.0'", "true"},
+		{"'1' = '1.0'", "false"},
+		{"//title = 'Two'", "true"},
+		{"//title != 'Two'", "true"},
+		{"//nothing = false()", "true"},
+		{"//itunes:duration > 50", "true"},
+		{"//itunes:duration = //item/@id", "false"},
+		{"true() = 'x'", "true"},
+		{"boolean(0) or not('')", "true"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			e, err := compileXPath(tst.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := evalXPath(e, tst.expr, doc, doc.children[0], nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tst.want, describeValue(got)); diff != "" {
+				t.Errorf("%s: %s", tst.expr, diff)
+			}
+		})
+	}
+}
+
+func TestEvalXPathNamespacesAndVariables(t *testing.T) {
+	root, err := Parse(feedXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := newNavTree(&root)
+	namespaces := map[string]string{"it": "urn:itunes", "itunes": "urn:other"}
+	variables := map[string]any{"min": 40.0, "name": "Three"}
+
+	table := []struct {
+		expr string
+		want string
+	}{
+		{"count(//it:duration)", "2"},
+		{"count(//itunes:duration)", "0"},
+		{"//it:duration[. > $min]", "/rss[1]/channel[1]/item[1]/itunes:duration[1]"},
+		{"//title[. = $name]/..", "/rss[1]/channel[1]/item[3]"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			e, err := compileXPath(tst.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := evalXPath(e, tst.expr, doc, doc, namespaces, variables)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tst.want, describeValue(got)); diff != "" {
+				t.Errorf("%s: %s", tst.expr, diff)
+			}
+		})
+	}
+}
+
+func TestEvalXPathErrors(t *testing.T) {
+	root, err := Parse(feedXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := newNavTree(&root)
+
+	table := []struct {
+		expr string
+		want string
+	}{
+		{"$x", "xpath '$x' at 1: variable '$x' is not set"},
+		{"a | 'x'", "xpath 'a | 'x'' at 3: '|' needs node-sets on both sides"},
+		{"1/a", "xpath '1/a' at 1: a path can only start from a node-set"},
+		{"'a'[1]", "xpath ''a'[1]' at 1: only a node-set can be filtered"},
+		{"count('a')", "xpath 'count('a')' at 1: count(): expected a node-set"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			e, err := compileXPath(tst.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = evalXPath(e, tst.expr, doc, doc, nil, nil)
+			if err == nil {
+				t.Fatal("wanted an error but got none")
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,424 @@
+package xsd
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// pattern is a compiled xs:pattern facet, along with the source it was
+// written as in the schema.
+type pattern struct {
+	source string
+	re     *regexp.Regexp
+}
+
+// compilePattern translates an XML Schema regular expression into the
+// syntax of the regexp package. Patterns always match the whole value, so
+// '^' and '$' are plain characters, and the escapes and character class
+// subtraction that only XML Schema has are rewritten as plain classes.
+func compilePattern(source string) (pattern, error) {
+	tr := patternTranslator{src: []rune(source)}
+	translated, err := tr.translate()
+	if err != nil {
+		return pattern{}, err
+	}
+	re, err := regexp.Compile("^(?:" + translated + ")$")
+	if err != nil {
+		return pattern{}, err
+	}
+	return pattern{source, re}, nil
+}
+
+type patternTranslator struct {
+	src []rune
+	pos int
+}
+
+func (tr *patternTranslator) more() bool {
+	return tr.pos < len(tr.src)
+}
+
+func (tr *patternTranslator) peek() rune {
+	return tr.src[tr.pos]
+}
+
+func (tr *patternTranslator) translate() (string, error) {
+	var sb strings.Builder
+	for tr.more() {
+		r := tr.peek()
+		tr.pos++
+		switch r {
+		case '\\':
+			class, err := tr.escape(false)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(class)
+		case '[':
+			class, err := tr.class()
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(class)
+		case '.':
+			sb.WriteString(`[^\n\r]`)
+		case '^', '$':
+			sb.WriteString(literal(r))
+		case '(':
+			if tr.more() && tr.peek() == '?' {
+				return "", fmt.Errorf("'(?' is not allowed in a pattern")
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String(), nil
+}
+
+// escape reads the escape after a backslash. Outside a class it gives a
+// whole class, and inside one the ranges to add to it.
+func (tr *patternTranslator) escape(inClass bool) (string, error) {
+	if !tr.more() {
+		return "", fmt.Errorf("pattern ends with a '\\'")
+	}
+	r := tr.peek()
+	tr.pos++
+
+	switch r {
+	case 'n':
+		return literal('\n'), nil
+	case 'r':
+		return literal('\r'), nil
+	case 't':
+		return literal('\t'), nil
+	case '\\', '|', '.', '?', '*', '+', '(', ')', '{', '}', '-', '[', ']', '^', '$':
+		return literal(r), nil
+	case 'p', 'P':
+		ranges, err := tr.property()
+		if err != nil {
+			return "", err
+		}
+		return wrapClass(ranges, r == 'P', inClass)
+	}
+
+	ranges, ok := multiCharEscapes[unicode.ToLower(r)]
+	if !ok {
+		return "", fmt.Errorf("unknown escape '\\%c'", r)
+	}
+	return wrapClass(ranges, unicode.IsUpper(r), inClass)
+}
+
+// multiCharEscapes are the sets matched by the escapes with a letter, in
+// the syntax of the inside of a class. The upper case escapes match
+// everything else.
+var multiCharEscapes = map[rune]string{
+	's': `\x{20}\t\n\r`,
+	'i': `\p{L}\p{Nl}_:`,
+	'c': `\p{L}\p{Nl}\p{Nd}\p{Mn}\p{Mc}._:\-\x{B7}`,
+	'd': `\p{Nd}`,
+	'w': `\p{L}\p{M}\p{N}\p{S}`,
+}
+
+// property reads the name in braces after \p or \P, giving the ranges of
+// the category or block it names.
+func (tr *patternTranslator) property() (string, error) {
+	if !tr.more() || tr.peek() != '{' {
+		return "", fmt.Errorf("expected '{' after '\\p'")
+	}
+	end := tr.pos
+	for end < len(tr.src) && tr.src[end] != '}' {
+		end++
+	}
+	if end == len(tr.src) {
+		return "", fmt.Errorf("missing '}' after '\\p'")
+	}
+	name := string(tr.src[tr.pos+1 : end])
+	tr.pos = end + 1
+
+	if block, ok := strings.CutPrefix(name, "Is"); ok {
+		bounds, ok := unicodeBlocks[block]
+		if !ok {
+			return "", fmt.Errorf("unsupported block '%s'", name)
+		}
+		return fmt.Sprintf(`\x{%X}-\x{%X}`, bounds[0], bounds[1]), nil
+	}
+	if _, ok := unicode.Categories[name]; !ok && (len(name) != 1 || !strings.Contains("LMNPSZC", name)) {
+		return "", fmt.Errorf("unsupported category '%s'", name)
+	}
+	return `\p{` + name + `}`, nil
+}
+
+// class reads a character class after its opening '[', including any
+// class subtracted from it.
+func (tr *patternTranslator) class() (string, error) {
+	negated := false
+	if tr.more() && tr.peek() == '^' {
+		negated = true
+		tr.pos++
+	}
+
+	var items strings.Builder
+	first := true
+	for {
+		if !tr.more() {
+			return "", fmt.Errorf("missing ']' to end a character class")
+		}
+		r := tr.peek()
+		tr.pos++
+
+		switch {
+		case r == ']' && !first:
+			return wrapClass(items.String(), negated, false)
+		case r == '-' && tr.more() && tr.peek() == '[' && !first:
+			tr.pos++
+			subtracted, err := tr.class()
+			if err != nil {
+				return "", err
+			}
+			if !tr.more() || tr.peek() != ']' {
+				return "", fmt.Errorf("a subtracted class must end its character class")
+			}
+			tr.pos++
+			base, err := wrapClass(items.String(), negated, false)
+			if err != nil {
+				return "", err
+			}
+			return subtractClass(base, subtracted)
+		case r == '[':
+			return "", fmt.Errorf("unescaped '[' in a character class")
+		case r == '\\':
+			if tr.more() && strings.ContainsRune("pPsSiIcCdDwW", tr.peek()) {
+				ranges, err := tr.escape(true)
+				if err != nil {
+					return "", err
+				}
+				items.WriteString(ranges)
+				break
+			}
+			lo, err := tr.escape(true)
+			if err != nil {
+				return "", err
+			}
+			items.WriteString(lo)
+			err = tr.rangeEnd(&items)
+			if err != nil {
+				return "", err
+			}
+		default:
+			items.WriteString(literal(r))
+			err := tr.rangeEnd(&items)
+			if err != nil {
+				return "", err
+			}
+		}
+		first = false
+	}
+}
+
+// rangeEnd reads the end of a range such as a-z, if there is one after
+// the character just read.
+func (tr *patternTranslator) rangeEnd(items *strings.Builder) error {
+	if tr.pos+1 >= len(tr.src) || tr.peek() != '-' || tr.src[tr.pos+1] == '[' || tr.src[tr.pos+1] == ']' {
+		return nil
+	}
+	tr.pos++
+	r := tr.peek()
+	tr.pos++
+	if r != '\\' {
+		items.WriteString("-" + literal(r))
+		return nil
+	}
+	if tr.more() && strings.ContainsRune("pPsSiIcCdDwW", tr.peek()) {
+		return fmt.Errorf("a range cannot end with '\\%c'", tr.peek())
+	}
+	hi, err := tr.escape(true)
+	if err != nil {
+		return err
+	}
+	items.WriteString("-" + hi)
+	return nil
+}
+
+// wrapClass turns ranges into a class. The inside of a class can only
+// have a negated set added to it once it has been worked out in full.
+func wrapClass(ranges string, negated, inClass bool) (string, error) {
+	switch {
+	case !inClass && negated:
+		return "[^" + ranges + "]", nil
+	case !inClass:
+		return "[" + ranges + "]", nil
+	case !negated:
+		return ranges, nil
+	}
+	runes, err := classRunes("[^" + ranges + "]")
+	if err != nil {
+		return "", err
+	}
+	return formatRanges(runes), nil
+}
+
+// subtractClass gives a class matching what base does but subtracted
+// does not.
+func subtractClass(base, subtracted string) (string, error) {
+	keep, err := classRunes(base)
+	if err != nil {
+		return "", err
+	}
+	drop, err := classRunes(subtracted)
+	if err != nil {
+		return "", err
+	}
+
+	var result []rune
+	for i := 0; i < len(keep); i += 2 {
+		lo, hi := keep[i], keep[i+1]
+		for j := 0; j < len(drop) && lo <= hi; j += 2 {
+			if drop[j+1] < lo || drop[j] > hi {
+				continue
+			}
+			if drop[j] > lo {
+				result = append(result, lo, drop[j]-1)
+			}
+			lo = drop[j+1] + 1
+		}
+		if lo <= hi {
+			result = append(result, lo, hi)
+		}
+	}
+	if len(result) == 0 {
+		// Nothing is left, so the class can never match
+		return `[^\x{0}-\x{10FFFF}]`, nil
+	}
+	return "[" + formatRanges(result) + "]", nil
+}
+
+// classRunes gives the sorted ranges of characters a class matches, as
+// pairs of the first and last character of each.
+func classRunes(class string) ([]rune, error) {
+	re, err := syntax.Parse(class, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	switch re.Op {
+	case syntax.OpCharClass:
+		return re.Rune, nil
+	case syntax.OpLiteral:
+		return []rune{re.Rune[0], re.Rune[0]}, nil
+	case syntax.OpNoMatch:
+		return nil, nil
+	case syntax.OpAnyCharNotNL:
+		return []rune{0, '\n' - 1, '\n' + 1, unicode.MaxRune}, nil
+	}
+	return []rune{0, unicode.MaxRune}, nil
+}
+
+func formatRanges(runes []rune) string {
+	var sb strings.Builder
+	for i := 0; i < len(runes); i += 2 {
+		sb.WriteString(literal(runes[i]))
+		if runes[i+1] != runes[i] {
+			sb.WriteString("-" + literal(runes[i+1]))
+		}
+	}
+	return sb.String()
+}
+
+// literal writes r so that it stands for itself inside or outside a class.
+func literal(r rune) string {
+	if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+		return string(r)
+	}
+	return fmt.Sprintf(`\x{%X}`, r)
+}
+
+// unicodeBlocks are the blocks that \p{Is...} can name.
+var unicodeBlocks = map[string][2]rune{
+	"BasicLatin":                         {0x0000, 0x007F},
+	"Latin-1Supplement":                  {0x0080, 0x00FF},
+	"LatinExtended-A":                    {0x0100, 0x017F},
+	"LatinExtended-B":                    {0x0180, 0x024F},
+	"IPAExtensions":                      {0x0250, 0x02AF},
+	"SpacingModifierLetters":             {0x02B0, 0x02FF},
+	"CombiningDiacriticalMarks":          {0x0300, 0x036F},
+	"Greek":                              {0x0370, 0x03FF},
+	"Cyrillic":                           {0x0400, 0x04FF},
+	"Armenian":                           {0x0530, 0x058F},
+	"Hebrew":                             {0x0590, 0x05FF},
+	"Arabic":                             {0x0600, 0x06FF},
+	"Devanagari":                         {0x0900, 0x097F},
+	"Thai":                               {0x0E00, 0x0E7F},
+	"Georgian":                           {0x10A0, 0x10FF},
+	"HangulJamo":                         {0x1100, 0x11FF},
+	"LatinExtendedAdditional":            {0x1E00, 0x1EFF},
+	"GreekExtended":                      {0x1F00, 0x1FFF},
+	"GeneralPunctuation":                 {0x2000, 0x206F},
+	"SuperscriptsandSubscripts":          {0x2070, 0x209F},
+	"CurrencySymbols":                    {0x20A0, 0x20CF},
+	"LetterlikeSymbols":                  {0x2100, 0x214F},
+	"NumberForms":                        {0x2150, 0x218F},
+	"Arrows":                             {0x2190, 0x21FF},
+	"MathematicalOperators":              {0x2200, 0x22FF},
+	"BoxDrawing":                         {0x2500, 0x257F},
+	"GeometricShapes":                    {0x25A0, 0x25FF},
+	"MiscellaneousSymbols":               {0x2600, 0x26FF},
+	"Dingbats":                           {0x2700, 0x27BF},
+	"CJKSymbolsandPunctuation":           {0x3000, 0x303F},
+	"Hiragana":                           {0x3040, 0x309F},
+	"Katakana":                           {0x30A0, 0x30FF},
+	"CJKUnifiedIdeographs":               {0x4E00, 0x9FFF},
+	"HangulSyllables":                    {0xAC00, 0xD7AF},
+	"PrivateUse":                         {0xE000, 0xF8FF},
+	"AlphabeticPresentationForms":        {0xFB00, 0xFB4F},
+	"HalfwidthandFullwidthForms":         {0xFF00, 0xFFEF},
+	"Specials":                           {0xFFF0, 0xFFFF},
+	"CJKCompatibilityIdeographs":         {0xF900, 0xFAFF},
+	"CombiningMarksforSymbols":           {0x20D0, 0x20FF},
+	"EnclosedAlphanumerics":              {0x2460, 0x24FF},
+	"MiscellaneousTechnical":             {0x2300, 0x23FF},
+	"ControlPictures":                    {0x2400, 0x243F},
+	"BlockElements":                      {0x2580, 0x259F},
+	"ArabicPresentationForms-A":          {0xFB50, 0xFDFF},
+	"ArabicPresentationForms-B":          {0xFE70, 0xFEFF},
+	"CombiningHalfMarks":                 {0xFE20, 0xFE2F},
+	"CJKCompatibilityForms":              {0xFE30, 0xFE4F},
+	"SmallFormVariants":                  {0xFE50, 0xFE6F},
+	"EnclosedCJKLettersandMonths":        {0x3200, 0x32FF},
+	"CJKCompatibility":                   {0x3300, 0x33FF},
+	"Bopomofo":                           {0x3100, 0x312F},
+	"HangulCompatibilityJamo":            {0x3130, 0x318F},
+	"CJKUnifiedIdeographsExtensionA":     {0x3400, 0x4DB5},
+	"IdeographicDescriptionCharacters":   {0x2FF0, 0x2FFF},
+	"KangxiRadicals":                     {0x2F00, 0x2FDF},
+	"OpticalCharacterRecognition":        {0x2440, 0x245F},
+	"Kanbun":                             {0x3190, 0x319F},
+	"BopomofoExtended":                   {0x31A0, 0x31BF},
+	"Syriac":                             {0x0700, 0x074F},
+	"Thaana":                             {0x0780, 0x07BF},
+	"Bengali":                            {0x0980, 0x09FF},
+	"Gurmukhi":                           {0x0A00, 0x0A7F},
+	"Gujarati":                           {0x0A80, 0x0AFF},
+	"Oriya":                              {0x0B00, 0x0B7F},
+	"Tamil":                              {0x0B80, 0x0BFF},
+	"Telugu":                             {0x0C00, 0x0C7F},
+	"Kannada":                            {0x0C80, 0x0CFF},
+	"Malayalam":                          {0x0D00, 0x0D7F},
+	"Sinhala":                            {0x0D80, 0x0DFF},
+	"Lao":                                {0x0E80, 0x0EFF},
+	"Tibetan":                            {0x0F00, 0x0FFF},
+	"Myanmar":                            {0x1000, 0x109F},
+	"Ethiopic":                           {0x1200, 0x137F},
+	"Cherokee":                           {0x13A0, 0x13FF},
+	"UnifiedCanadianAboriginalSyllabics": {0x1400, 0x167F},
+	"Ogham":                              {0x1680, 0x169F},
+	"Runic":                              {0x16A0, 0x16FF},
+	"Khmer":                              {0x1780, 0x17FF},
+	"Mongolian":                          {0x1800, 0x18AF},
+	"BraillePatterns":                    {0x2800, 0x28FF},
+	"CJKRadicalsSupplement":              {0x2E80, 0x2EFF},
+	"YiSyllables":                        {0xA000, 0xA48F},
+	"YiRadicals":                         {0xA490, 0xA4CF},
+}
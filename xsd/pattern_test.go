@@ -0,0 +1,77 @@
+package xsd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCompilePattern(t *testing.T) {
+	table := []struct {
+		pattern string
+		value   string
+		match   bool
+	}{
+		{`[A-Z]{3}-\d+`, "ABC-123", true},
+		{`[A-Z]{3}-\d+`, "abc-123", false},
+		{`\d+`, "١٢٣", true},
+		{`a$b^`, "a$b^", true},
+		{`.+`, "a\nb", false},
+		{`\i\c*`, "_xml:name-1.2", true},
+		{`\i\c*`, "1name", false},
+		{`[\i-[:]][\c-[:]]*`, "ns:name", false},
+		{`[\i-[:]][\c-[:]]*`, "name", true},
+		{`[a-z-[aeiou]]+`, "rhythm", true},
+		{`[a-z-[aeiou]]+`, "rhyme", false},
+		{`[a-z-[a-z]]?`, "", true},
+		{`[^a-c-[x]]+`, "defw", true},
+		{`[^a-c-[x]]+`, "dex", false},
+		{`\p{IsBasicLatin}+`, "plain", true},
+		{`\p{IsBasicLatin}+`, "café", false},
+		{`[\P{IsBasicLatin}a]+`, "éaü", true},
+		{`\p{Lu}\p{Ll}+`, "Hello", true},
+		{`\w+`, "word", true},
+		{`\w+`, "two words", false},
+		{`[\S-]+`, "no-space", true},
+		{`\s`, "\f", false},
+		{`[\-\[\]]+`, "-[]", true},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			p, err := compilePattern(tst.pattern)
+			if err != nil {
+				t.Fatalf("failed on pattern '%v'. %v.", tst.pattern, err)
+			}
+			if got := p.re.MatchString(tst.value); got != tst.match {
+				t.Fatalf("pattern '%v' gave %v for '%v'", tst.pattern, got, tst.value)
+			}
+		})
+	}
+}
+
+func TestCompilePatternErrors(t *testing.T) {
+	table := []struct {
+		pattern string
+		want    string
+	}{
+		{`(?i)abc`, "'(?' is not allowed in a pattern"},
+		{`\p{IsKlingon}`, "unsupported block 'IsKlingon'"},
+		{`\p{Greek}`, "unsupported category 'Greek'"},
+		{`\q`, `unknown escape '\q'`},
+		{`[a-z`, "missing ']' to end a character class"},
+		{`[a-z-[aeiou]b]`, "a subtracted class must end its character class"},
+		{`[a-\d]`, `a range cannot end with '\d'`},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := compilePattern(tst.pattern)
+			if err == nil {
+				t.Fatalf("wanted an error for pattern '%v'", tst.pattern)
+			}
+			if err.Error() != tst.want {
+				t.Fatalf("wrong error for pattern '%v': %v", tst.pattern, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,851 @@
+package xsd
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/danwhitford/xmlparser"
+	"github.com/danwhitford/xmlparser/tokeniser"
+)
+
+const Namespace = "http://www.w3.org/2001/XMLSchema"
+
+// Schema is a compiled XML Schema, ready to validate documents against.
+type Schema struct {
+	TargetNamespace string
+
+	elements map[qname]*elementDecl
+}
+
+type qname struct {
+	space, local string
+}
+
+func (q qname) String() string {
+	return q.local
+}
+
+type elementDecl struct {
+	name     qname
+	simple   *simpleType
+	complex  *complexType
+	def      *string
+	fixed    *string
+	typeName string
+}
+
+type complexType struct {
+	name         string
+	content      *particle
+	mixed        bool
+	simple       *simpleType
+	attributes   []*attributeDecl
+	anyAttribute bool
+}
+
+type attributeDecl struct {
+	name     qname
+	typ      *simpleType
+	required bool
+	def      *string
+	fixed    *string
+}
+
+type particleKind int
+
+const (
+	elementParticle particleKind = iota
+	sequenceParticle
+	choiceParticle
+	allParticle
+	anyParticle
+)
+
+// particle is part of a content model. Max is -1 when unbounded.
+type particle struct {
+	kind     particleKind
+	min, max int
+	element  *elementDecl
+	children []*particle
+
+	// For wildcards, processContents and whether only other namespaces
+	// are allowed
+	process string
+	other   bool
+}
+
+// Parse compiles the schema in input.
+func Parse(input string) (*Schema, error) {
+	root, err := xmlparser.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(root)
+}
+
+// Compile builds a schema from an xs:schema element.
+func Compile(root xmlparser.XmlNode) (*Schema, error) {
+	c, err := newCompiler(root)
+	if err != nil {
+		return nil, err
+	}
+	return c.schema, nil
+}
+
+func newCompiler(root xmlparser.XmlNode) (*compiler, error) {
+	if root.Namespace != Namespace || root.Local() != "schema" {
+		return nil, schemaError(root, "expected an xs:schema element but got '%s'", root.Name)
+	}
+
+	c := &compiler{
+		schema:          &Schema{elements: map[qname]*elementDecl{}},
+		namedElements:   map[qname]xmlparser.XmlNode{},
+		namedTypes:      map[qname]xmlparser.XmlNode{},
+		groups:          map[qname]xmlparser.XmlNode{},
+		attributeGroups: map[qname]xmlparser.XmlNode{},
+		attributes:      map[qname]xmlparser.XmlNode{},
+		simpleTypes:     map[qname]*simpleType{},
+		complexTypes:    map[qname]*complexType{},
+		groupParticles:  map[qname]*particle{},
+		inProgress:      map[definition]bool{},
+	}
+	c.schema.TargetNamespace, _ = root.Attr("targetNamespace")
+	form, _ := root.Attr("elementFormDefault")
+	c.qualified = form == "qualified"
+	form, _ = root.Attr("attributeFormDefault")
+	c.qualifiedAttributes = form == "qualified"
+
+	c.root = c.scope(nil, root)
+	for i := range root.Children {
+		child := &root.Children[i]
+		if child.Type != xmlparser.ElementNode {
+			continue
+		}
+		name, _ := child.Attr("name")
+		key := qname{c.schema.TargetNamespace, name}
+		switch child.Local() {
+		case "element":
+			c.namedElements[key] = *child
+		case "complexType", "simpleType":
+			c.namedTypes[key] = *child
+		case "group":
+			c.groups[key] = *child
+		case "attributeGroup":
+			c.attributeGroups[key] = *child
+		case "attribute":
+			c.attributes[key] = *child
+		case "annotation", "notation":
+		case "import", "include", "redefine", "override":
+			return nil, schemaError(*child, "xs:%s is not supported", child.Local())
+		default:
+			return nil, schemaError(*child, "unexpected xs:%s in xs:schema", child.Local())
+		}
+	}
+
+	for _, child := range root.Children {
+		if child.Type != xmlparser.ElementNode {
+			continue
+		}
+		var err error
+		switch child.Local() {
+		case "element":
+			_, err = c.globalElement(qname{c.schema.TargetNamespace, mustAttr(child, "name")}, child, c.root)
+		case "complexType", "simpleType":
+			_, _, err = c.namedType(qname{c.schema.TargetNamespace, mustAttr(child, "name")}, child)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+type compiler struct {
+	schema              *Schema
+	qualified           bool
+	qualifiedAttributes bool
+
+	// root holds the namespaces declared on xs:schema, which top level
+	// declarations start from when they are compiled out of order.
+	root            map[string]string
+	namedElements   map[qname]xmlparser.XmlNode
+	namedTypes      map[qname]xmlparser.XmlNode
+	groups          map[qname]xmlparser.XmlNode
+	attributeGroups map[qname]xmlparser.XmlNode
+	attributes      map[qname]xmlparser.XmlNode
+	simpleTypes     map[qname]*simpleType
+	complexTypes    map[qname]*complexType
+	groupParticles  map[qname]*particle
+
+	// inProgress holds the groups, attribute groups and simple types
+	// being compiled, so that one referring back to itself is caught.
+	inProgress map[definition]bool
+}
+
+type definition struct {
+	kind string
+	name qname
+}
+
+// enter marks a definition as being compiled, failing if it already is.
+// The caller leaves it once it is done.
+func (c *compiler) enter(node xmlparser.XmlNode, kind string, name qname) error {
+	key := definition{kind, name}
+	if c.inProgress[key] {
+		return schemaError(node, "%s '%s' refers to itself", kind, name)
+	}
+	c.inProgress[key] = true
+	return nil
+}
+
+func (c *compiler) leave(kind string, name qname) {
+	delete(c.inProgress, definition{kind, name})
+}
+
+// Error reports a problem with a schema or a document it validates.
+// Path locates the element it is about, such as /order/item[2]/price.
+type Error struct {
+	Path string
+	Pos  tokeniser.Position
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %s: %s", e.Pos, e.Path, e.Msg)
+}
+
+func schemaError(node xmlparser.XmlNode, format string, args ...any) *Error {
+	return &Error{
+		Path: "xs:" + node.Local(),
+		Pos:  node.Span.Start,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func mustAttr(node xmlparser.XmlNode, key string) string {
+	val, _ := node.Attr(key)
+	return val
+}
+
+func optional(node xmlparser.XmlNode, key string) *string {
+	val, ok := node.Attr(key)
+	if !ok {
+		return nil
+	}
+	return &val
+}
+
+// scope adds the namespaces declared on node to those of its parent.
+func (c *compiler) scope(parent map[string]string, node xmlparser.XmlNode) map[string]string {
+	scope := parent
+	copied := false
+	for _, a := range node.Attributes {
+		if a.Namespace != xmlparser.XMLNSNamespace {
+			continue
+		}
+		if !copied {
+			scope = maps.Clone(parent)
+			if scope == nil {
+				scope = map[string]string{}
+			}
+			copied = true
+		}
+		prefix := ""
+		if a.Key != "xmlns" {
+			prefix = a.Local()
+		}
+		scope[prefix] = a.Value
+	}
+	return scope
+}
+
+// resolve turns a prefixed name from a schema attribute into a qname.
+func (c *compiler) resolve(node xmlparser.XmlNode, scope map[string]string, name string) (qname, error) {
+	prefix, local, found := strings.Cut(name, ":")
+	if !found {
+		prefix, local = "", name
+	}
+	space, ok := scope[prefix]
+	if !ok && prefix != "" {
+		return qname{}, schemaError(node, "namespace prefix '%s' has not been declared", prefix)
+	}
+	return qname{space, local}, nil
+}
+
+func (c *compiler) elements(node xmlparser.XmlNode) []xmlparser.XmlNode {
+	var children []xmlparser.XmlNode
+	for _, child := range node.Children {
+		if child.Type == xmlparser.ElementNode && child.Namespace == Namespace && child.Local() != "annotation" {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+func (c *compiler) globalElement(name qname, node xmlparser.XmlNode, scope map[string]string) (*elementDecl, error) {
+	if el, ok := c.schema.elements[name]; ok {
+		return el, nil
+	}
+	el := &elementDecl{name: name}
+	c.schema.elements[name] = el
+	return el, c.elementType(el, node, scope)
+}
+
+func (c *compiler) localElement(node xmlparser.XmlNode, scope map[string]string) (*elementDecl, error) {
+	scope = c.scope(scope, node)
+	if ref, ok := node.Attr("ref"); ok {
+		name, err := c.resolve(node, scope, ref)
+		if err != nil {
+			return nil, err
+		}
+		global, ok := c.namedElements[name]
+		if !ok {
+			return nil, schemaError(node, "element '%s' is not declared", ref)
+		}
+		return c.globalElement(name, global, c.root)
+	}
+
+	name := qname{local: mustAttr(node, "name")}
+	if name.local == "" {
+		return nil, schemaError(node, "element needs a name or a ref")
+	}
+	form, ok := node.Attr("form")
+	if form == "qualified" || !ok && c.qualified {
+		name.space = c.schema.TargetNamespace
+	}
+	el := &elementDecl{name: name}
+	return el, c.elementType(el, node, scope)
+}
+
+func (c *compiler) elementType(el *elementDecl, node xmlparser.XmlNode, scope map[string]string) error {
+	// Content models can recurse through an element, so whatever the
+	// type refers to starts afresh
+	outer := c.inProgress
+	c.inProgress = map[definition]bool{}
+	defer func() { c.inProgress = outer }()
+
+	scope = c.scope(scope, node)
+	el.def = optional(node, "default")
+	el.fixed = optional(node, "fixed")
+	var err error
+	if ref, ok := node.Attr("type"); ok {
+		var name qname
+		name, err = c.resolve(node, scope, ref)
+		if err != nil {
+			return err
+		}
+		el.simple, el.complex, err = c.lookupType(node, name)
+	} else {
+		el.simple, el.complex, err = c.inlineType(node, scope, fmt.Sprintf("value for '%s'", el.name))
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, value := range []*string{el.def, el.fixed} {
+		if value != nil && el.simple != nil {
+			err := el.simple.validate(*value)
+			if err != nil {
+				return schemaError(node, "bad value for element '%s': %v", el.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// inlineType compiles the anonymous type inside node, or gives xs:anyType
+// if it has none. A simple type is given name to use in error messages.
+func (c *compiler) inlineType(node xmlparser.XmlNode, scope map[string]string, name string) (*simpleType, *complexType, error) {
+	for _, child := range c.elements(node) {
+		switch child.Local() {
+		case "simpleType":
+			t, err := c.simpleType(child, scope, name)
+			return t, nil, err
+		case "complexType":
+			t := &complexType{name: "anonymous"}
+			return nil, t, c.complexType(t, child, scope)
+		}
+	}
+	return nil, anyType, nil
+}
+
+var anyType = &complexType{
+	name:         "xs:anyType",
+	mixed:        true,
+	anyAttribute: true,
+	content: &particle{kind: sequenceParticle, min: 1, max: 1, children: []*particle{
+		{kind: anyParticle, min: 0, max: -1, process: "lax"},
+	}},
+}
+
+func (c *compiler) lookupType(node xmlparser.XmlNode, name qname) (*simpleType, *complexType, error) {
+	if name.space == Namespace {
+		if name.local == "anyType" {
+			return nil, anyType, nil
+		}
+		t, ok := builtins[name.local]
+		if !ok {
+			return nil, nil, schemaError(node, "unknown built in type 'xs:%s'", name.local)
+		}
+		return t, nil, nil
+	}
+
+	if t, ok := c.simpleTypes[name]; ok {
+		return t, nil, nil
+	}
+	if t, ok := c.complexTypes[name]; ok {
+		return nil, t, nil
+	}
+	def, ok := c.namedTypes[name]
+	if !ok {
+		return nil, nil, schemaError(node, "type '%s' is not declared", name)
+	}
+	return c.namedType(name, def)
+}
+
+func (c *compiler) namedType(name qname, node xmlparser.XmlNode) (*simpleType, *complexType, error) {
+	if t, ok := c.simpleTypes[name]; ok {
+		return t, nil, nil
+	}
+	if t, ok := c.complexTypes[name]; ok {
+		return nil, t, nil
+	}
+
+	scope := c.scope(c.root, node)
+	if node.Local() == "simpleType" {
+		err := c.enter(node, "simple type", name)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer c.leave("simple type", name)
+		t, err := c.simpleType(node, scope, name.local)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.simpleTypes[name] = t
+		return t, nil, nil
+	}
+
+	// Registered before compiling so that it can refer to itself
+	t := &complexType{name: name.local}
+	c.complexTypes[name] = t
+	return nil, t, c.complexType(t, node, scope)
+}
+
+func (c *compiler) simpleTypeRef(node xmlparser.XmlNode, scope map[string]string, ref string) (*simpleType, error) {
+	name, err := c.resolve(node, scope, ref)
+	if err != nil {
+		return nil, err
+	}
+	simple, complex, err := c.lookupType(node, name)
+	if err != nil {
+		return nil, err
+	}
+	if complex != nil {
+		if complex.simple != nil {
+			return complex.simple, nil
+		}
+		return nil, schemaError(node, "'%s' is a complex type where a simple type is needed", ref)
+	}
+	return simple, nil
+}
+
+func (c *compiler) simpleType(node xmlparser.XmlNode, scope map[string]string, name string) (*simpleType, error) {
+	scope = c.scope(scope, node)
+	children := c.elements(node)
+	if len(children) != 1 {
+		return nil, schemaError(node, "simple type '%s' needs one of xs:restriction, xs:list or xs:union", name)
+	}
+	child := children[0]
+
+	switch child.Local() {
+	case "restriction":
+		return c.restriction(child, scope, name)
+	case "list":
+		t := newSimpleType(name, nil)
+		t.whiteSpace = collapse
+		var err error
+		if ref, ok := child.Attr("itemType"); ok {
+			t.item, err = c.simpleTypeRef(child, scope, ref)
+		} else {
+			t.item, err = c.inlineSimpleType(child, scope, "item of "+name)
+		}
+		return t, err
+	case "union":
+		t := newSimpleType(name, nil)
+		for _, ref := range strings.Fields(mustAttr(child, "memberTypes")) {
+			member, err := c.simpleTypeRef(child, scope, ref)
+			if err != nil {
+				return nil, err
+			}
+			t.members = append(t.members, member)
+		}
+		for _, inline := range c.elements(child) {
+			member, err := c.simpleType(inline, scope, "member of "+name)
+			if err != nil {
+				return nil, err
+			}
+			t.members = append(t.members, member)
+		}
+		if len(t.members) == 0 {
+			return nil, schemaError(child, "union '%s' has no member types", name)
+		}
+		return t, nil
+	}
+	return nil, schemaError(child, "unexpected xs:%s in simple type '%s'", child.Local(), name)
+}
+
+func (c *compiler) inlineSimpleType(node xmlparser.XmlNode, scope map[string]string, name string) (*simpleType, error) {
+	for _, child := range c.elements(node) {
+		if child.Local() == "simpleType" {
+			return c.simpleType(child, scope, name)
+		}
+	}
+	return nil, schemaError(node, "expected a base type or an inline xs:simpleType")
+}
+
+// restriction derives a simple type from its base by adding facets.
+func (c *compiler) restriction(node xmlparser.XmlNode, scope map[string]string, name string) (*simpleType, error) {
+	var base *simpleType
+	var err error
+	if ref, ok := node.Attr("base"); ok {
+		base, err = c.simpleTypeRef(node, scope, ref)
+	} else {
+		base, err = c.inlineSimpleType(node, scope, "base of "+name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := newSimpleType(name, base)
+	return t, c.facets(t, node)
+}
+
+func (c *compiler) facets(t *simpleType, node xmlparser.XmlNode) error {
+	for _, facet := range c.elements(node) {
+		switch facet.Local() {
+		case "simpleType", "attribute", "attributeGroup", "anyAttribute":
+			// Handled by the caller
+			continue
+		}
+		value, ok := facet.Attr("value")
+		if !ok {
+			return schemaError(facet, "facet xs:%s needs a value", facet.Local())
+		}
+
+		err := t.addFacet(facet.Local(), value)
+		if err != nil {
+			return schemaError(facet, "bad xs:%s facet '%s': %v", facet.Local(), value, err)
+		}
+	}
+	return nil
+}
+
+func (c *compiler) complexType(t *complexType, node xmlparser.XmlNode, scope map[string]string) error {
+	scope = c.scope(scope, node)
+	t.mixed = mustAttr(node, "mixed") == "true"
+
+	for _, child := range c.elements(node) {
+		var err error
+		switch child.Local() {
+		case "sequence", "choice", "all", "group":
+			t.content, err = c.particle(child, scope)
+		case "attribute", "attributeGroup", "anyAttribute":
+			err = c.attribute(t, child, scope)
+		case "simpleContent":
+			err = c.simpleContent(t, child, scope)
+		case "complexContent":
+			err = c.complexContent(t, child, scope)
+		default:
+			err = schemaError(child, "unexpected xs:%s in complex type '%s'", child.Local(), t.name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) derivation(node xmlparser.XmlNode) (xmlparser.XmlNode, error) {
+	children := c.elements(node)
+	if len(children) != 1 || children[0].Local() != "extension" && children[0].Local() != "restriction" {
+		return xmlparser.XmlNode{}, schemaError(node, "xs:%s needs one xs:extension or xs:restriction", node.Local())
+	}
+	return children[0], nil
+}
+
+func (c *compiler) simpleContent(t *complexType, node xmlparser.XmlNode, scope map[string]string) error {
+	derivation, err := c.derivation(node)
+	if err != nil {
+		return err
+	}
+	base, err := c.simpleTypeRef(derivation, scope, mustAttr(derivation, "base"))
+	if err != nil {
+		return err
+	}
+	if name, _ := c.resolve(derivation, scope, mustAttr(derivation, "base")); name.space != Namespace {
+		if _, complex, _ := c.lookupType(derivation, name); complex != nil {
+			t.attributes = append(t.attributes, complex.attributes...)
+			t.anyAttribute = complex.anyAttribute
+		}
+	}
+
+	t.simple = base
+	if derivation.Local() == "restriction" {
+		t.simple = newSimpleType(t.name, base)
+		err = c.facets(t.simple, derivation)
+		if err != nil {
+			return err
+		}
+	}
+	for _, child := range c.elements(derivation) {
+		switch child.Local() {
+		case "attribute", "attributeGroup", "anyAttribute":
+			err = c.attribute(t, child, scope)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *compiler) complexContent(t *complexType, node xmlparser.XmlNode, scope map[string]string) error {
+	derivation, err := c.derivation(node)
+	if err != nil {
+		return err
+	}
+	if mustAttr(node, "mixed") == "true" {
+		t.mixed = true
+	}
+	name, err := c.resolve(derivation, scope, mustAttr(derivation, "base"))
+	if err != nil {
+		return err
+	}
+	_, base, err := c.lookupType(derivation, name)
+	if err != nil {
+		return err
+	}
+	if base == nil {
+		return schemaError(derivation, "'%s' is a simple type where a complex type is needed", name)
+	}
+
+	var own *particle
+	for _, child := range c.elements(derivation) {
+		switch child.Local() {
+		case "sequence", "choice", "all", "group":
+			own, err = c.particle(child, scope)
+		case "attribute", "attributeGroup", "anyAttribute":
+			err = c.attribute(t, child, scope)
+		default:
+			err = schemaError(child, "unexpected xs:%s in xs:%s", child.Local(), derivation.Local())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if derivation.Local() == "restriction" {
+		t.content = own
+		return nil
+	}
+	t.attributes = append(append([]*attributeDecl(nil), base.attributes...), t.attributes...)
+	t.anyAttribute = t.anyAttribute || base.anyAttribute
+	t.mixed = t.mixed || base.mixed
+	switch {
+	case base.content == nil:
+		t.content = own
+	case own == nil:
+		t.content = base.content
+	default:
+		t.content = &particle{kind: sequenceParticle, min: 1, max: 1, children: []*particle{base.content, own}}
+	}
+	return nil
+}
+
+func (c *compiler) occurs(node xmlparser.XmlNode) (int, int, error) {
+	min, max := 1, 1
+	var err error
+	if val, ok := node.Attr("minOccurs"); ok {
+		min, err = strconv.Atoi(val)
+		if err != nil || min < 0 {
+			return 0, 0, schemaError(node, "bad minOccurs '%s'", val)
+		}
+	}
+	if val, ok := node.Attr("maxOccurs"); ok {
+		if val == "unbounded" {
+			max = -1
+		} else {
+			max, err = strconv.Atoi(val)
+			if err != nil || max < min {
+				return 0, 0, schemaError(node, "bad maxOccurs '%s'", val)
+			}
+		}
+	}
+	return min, max, nil
+}
+
+func (c *compiler) particle(node xmlparser.XmlNode, scope map[string]string) (*particle, error) {
+	min, max, err := c.occurs(node)
+	if err != nil {
+		return nil, err
+	}
+	p := &particle{min: min, max: max}
+
+	switch node.Local() {
+	case "element":
+		p.kind = elementParticle
+		p.element, err = c.localElement(node, scope)
+		return p, err
+	case "any":
+		p.kind = anyParticle
+		p.process = mustAttr(node, "processContents")
+		if p.process == "" {
+			p.process = "strict"
+		}
+		p.other = mustAttr(node, "namespace") == "##other"
+		return p, nil
+	case "group":
+		ref, err := c.resolve(node, scope, mustAttr(node, "ref"))
+		if err != nil {
+			return nil, err
+		}
+		group, ok := c.groups[ref]
+		if !ok {
+			return nil, schemaError(node, "group '%s' is not declared", ref)
+		}
+		err = c.enter(node, "group", ref)
+		if err != nil {
+			return nil, err
+		}
+		defer c.leave("group", ref)
+		inner, ok := c.groupParticles[ref]
+		if !ok {
+			children := c.elements(group)
+			if len(children) != 1 {
+				return nil, schemaError(group, "group '%s' needs one xs:sequence, xs:choice or xs:all", ref)
+			}
+			// Registered before compiling so that an element inside it
+			// can refer to it again
+			inner = &particle{}
+			c.groupParticles[ref] = inner
+			compiled, err := c.particle(children[0], c.scope(c.root, group))
+			if err != nil {
+				return nil, err
+			}
+			*inner = *compiled
+		}
+		return &particle{kind: sequenceParticle, min: min, max: max, children: []*particle{inner}}, nil
+	case "sequence":
+		p.kind = sequenceParticle
+	case "choice":
+		p.kind = choiceParticle
+	case "all":
+		p.kind = allParticle
+	default:
+		return nil, schemaError(node, "unexpected xs:%s in a content model", node.Local())
+	}
+
+	for _, child := range c.elements(node) {
+		inner, err := c.particle(child, scope)
+		if err != nil {
+			return nil, err
+		}
+		if p.kind == allParticle && (inner.kind != elementParticle || inner.max > 1 || inner.max < 0) {
+			return nil, schemaError(child, "xs:all can only hold elements that occur at most once")
+		}
+		p.children = append(p.children, inner)
+	}
+	return p, nil
+}
+
+func (c *compiler) attribute(t *complexType, node xmlparser.XmlNode, scope map[string]string) error {
+	switch node.Local() {
+	case "anyAttribute":
+		t.anyAttribute = true
+		return nil
+	case "attributeGroup":
+		ref, err := c.resolve(node, scope, mustAttr(node, "ref"))
+		if err != nil {
+			return err
+		}
+		group, ok := c.attributeGroups[ref]
+		if !ok {
+			return schemaError(node, "attribute group '%s' is not declared", ref)
+		}
+		err = c.enter(node, "attribute group", ref)
+		if err != nil {
+			return err
+		}
+		defer c.leave("attribute group", ref)
+		groupScope := c.scope(c.root, group)
+		for _, child := range c.elements(group) {
+			err := c.attribute(t, child, groupScope)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	scope = c.scope(scope, node)
+	decl := &attributeDecl{
+		required: mustAttr(node, "use") == "required",
+		def:      optional(node, "default"),
+		fixed:    optional(node, "fixed"),
+	}
+	if mustAttr(node, "use") == "prohibited" {
+		return nil
+	}
+
+	def := node
+	if ref, ok := node.Attr("ref"); ok {
+		name, err := c.resolve(node, scope, ref)
+		if err != nil {
+			return err
+		}
+		global, ok := c.attributes[name]
+		if !ok {
+			return schemaError(node, "attribute '%s' is not declared", ref)
+		}
+		decl.name = name
+		def = global
+		scope = c.scope(c.root, global)
+		if decl.def == nil {
+			decl.def = optional(global, "default")
+		}
+		if decl.fixed == nil {
+			decl.fixed = optional(global, "fixed")
+		}
+	} else {
+		decl.name = qname{local: mustAttr(node, "name")}
+		form, ok := node.Attr("form")
+		if form == "qualified" || !ok && c.qualifiedAttributes {
+			decl.name.space = c.schema.TargetNamespace
+		}
+	}
+
+	var err error
+	if ref, ok := def.Attr("type"); ok {
+		decl.typ, err = c.simpleTypeRef(def, scope, ref)
+	} else if len(c.elements(def)) > 0 {
+		decl.typ, err = c.inlineSimpleType(def, scope, fmt.Sprintf("value for '@%s'", decl.name))
+	} else {
+		decl.typ = builtins["anySimpleType"]
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, value := range []*string{decl.def, decl.fixed} {
+		if value != nil {
+			err := decl.typ.validate(*value)
+			if err != nil {
+				return schemaError(node, "bad value for attribute '%s': %v", decl.name, err)
+			}
+		}
+	}
+	t.attributes = append(t.attributes, decl)
+	return nil
+}
@@ -0,0 +1,155 @@
+package xsd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/danwhitford/xmlparser"
+	"github.com/google/go-cmp/cmp"
+)
+
+// compile builds a schema, keeping hold of the compiler so tests can
+// look at the types in it.
+func compile(t *testing.T, input string) *compiler {
+	root, err := xmlparser.Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newCompiler(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCompileErrors(t *testing.T) {
+	table := []struct {
+		input string
+		want  string
+	}{
+		{
+			`<schema/>`,
+			"1:1: xs:schema: expected an xs:schema element but got 'schema'",
+		},
+		{
+			`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:include schemaLocation="a.xsd"/></xs:schema>`,
+			"1:56: xs:include: xs:include is not supported",
+		},
+		{
+			`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a" type="b"/></xs:schema>`,
+			"1:56: xs:element: type 'b' is not declared",
+		},
+		{
+			`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a" type="xs:strung"/></xs:schema>`,
+			"1:56: xs:element: unknown built in type 'xs:strung'",
+		},
+		{
+			`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a" type="q:b"/></xs:schema>`,
+			"1:56: xs:element: namespace prefix 'q' has not been declared",
+		},
+		{
+			`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+				<xs:element name="a" type="xs:int" default="lots"/>
+			</xs:schema>`,
+			"2:5: xs:element: bad value for element 'a': 'lots' is not a valid xs:int: it is not a decimal number",
+		},
+		{
+			`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+				<xs:simpleType name="a">
+					<xs:restriction base="xs:string"><xs:pattern value="(unclosed"/></xs:restriction>
+				</xs:simpleType>
+			</xs:schema>`,
+			"3:39: xs:pattern: bad xs:pattern facet '(unclosed': error parsing regexp: missing closing ): `^(?:(unclosed)$`",
+		},
+		{
+			`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+				<xs:simpleType name="a">
+					<xs:restriction base="xs:string"><xs:pattern value="\p{IsKlingon}+"/></xs:restriction>
+				</xs:simpleType>
+			</xs:schema>`,
+			"3:39: xs:pattern: bad xs:pattern facet '\\p{IsKlingon}+': unsupported block 'IsKlingon'",
+		},
+		{
+			`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+				<xs:complexType name="a">
+					<xs:all><xs:element name="b" maxOccurs="2"/></xs:all>
+				</xs:complexType>
+			</xs:schema>`,
+			"3:14: xs:element: xs:all can only hold elements that occur at most once",
+		},
+		{
+			`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+				<xs:complexType name="a">
+					<xs:sequence><xs:element name="b" minOccurs="2" maxOccurs="1"/></xs:sequence>
+				</xs:complexType>
+			</xs:schema>`,
+			"3:19: xs:element: bad maxOccurs '1'",
+		},
+		{
+			`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+				<xs:group name="g"><xs:sequence><xs:group ref="h"/></xs:sequence></xs:group>
+				<xs:group name="h"><xs:choice><xs:group ref="g"/></xs:choice></xs:group>
+				<xs:element name="a"><xs:complexType><xs:group ref="g"/></xs:complexType></xs:element>
+			</xs:schema>`,
+			"3:35: xs:group: group 'g' refers to itself",
+		},
+		{
+			`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+				<xs:attributeGroup name="g"><xs:attributeGroup ref="g"/></xs:attributeGroup>
+				<xs:element name="a"><xs:complexType><xs:attributeGroup ref="g"/></xs:complexType></xs:element>
+			</xs:schema>`,
+			"2:33: xs:attributeGroup: attribute group 'g' refers to itself",
+		},
+		{
+			`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+				<xs:simpleType name="a"><xs:restriction base="b"/></xs:simpleType>
+				<xs:simpleType name="b"><xs:list itemType="a"/></xs:simpleType>
+			</xs:schema>`,
+			"2:5: xs:simpleType: simple type 'a' refers to itself",
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			_, err := Parse(tst.input)
+			if err == nil {
+				t.Fatal("wanted an error")
+			}
+			if diff := cmp.Diff(tst.want, err.Error()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCompileRecursiveGroup(t *testing.T) {
+	schema, err := Parse(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+		<xs:group name="items">
+			<xs:sequence>
+				<xs:element name="item" minOccurs="0" maxOccurs="unbounded">
+					<xs:complexType><xs:group ref="items"/></xs:complexType>
+				</xs:element>
+			</xs:sequence>
+		</xs:group>
+		<xs:element name="list"><xs:complexType><xs:group ref="items"/></xs:complexType></xs:element>
+	</xs:schema>`)
+	if err != nil {
+		t.Fatalf("did not want an error. %v", err)
+	}
+
+	root, err := xmlparser.Parse(`<list><item><item/><item><item/></item></item></list>`)
+	if err != nil {
+		t.Fatalf("did not want an error. %v", err)
+	}
+	if errs := schema.Validate(root); len(errs) > 0 {
+		t.Fatalf("wanted a valid document but got %v", errs)
+	}
+
+	root, err = xmlparser.Parse(`<list><item><item><oops/></item></item></list>`)
+	if err != nil {
+		t.Fatalf("did not want an error. %v", err)
+	}
+	if errs := schema.Validate(root); len(errs) == 0 {
+		t.Fatal("wanted an error for the unexpected element")
+	}
+}
@@ -0,0 +1,539 @@
+package xsd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/danwhitford/xmlparser/dtd"
+)
+
+// primitive is the built in type a simple type is derived from, which
+// decides how its values are ordered.
+type primitive int
+
+const (
+	stringPrimitive primitive = iota
+	booleanPrimitive
+	decimalPrimitive
+	floatPrimitive
+	dateTimePrimitive
+	datePrimitive
+	timePrimitive
+	gYearPrimitive
+	otherPrimitive
+)
+
+type whiteSpace int
+
+const (
+	preserve whiteSpace = iota
+	replace
+	collapse
+)
+
+// simpleType is a built in or derived type of text. Each derivation step
+// keeps its own facets, and a value has to satisfy those of every step.
+type simpleType struct {
+	name       string
+	base       *simpleType
+	primitive  primitive
+	whiteSpace whiteSpace
+	lexical    func(string) error
+	item       *simpleType
+	members    []*simpleType
+
+	patterns       []pattern
+	enumeration    []string
+	length         int
+	minLength      int
+	maxLength      int
+	minInclusive   *string
+	maxInclusive   *string
+	minExclusive   *string
+	maxExclusive   *string
+	totalDigits    int
+	fractionDigits int
+}
+
+func newSimpleType(name string, base *simpleType) *simpleType {
+	t := &simpleType{
+		name:           name,
+		base:           base,
+		length:         -1,
+		minLength:      -1,
+		maxLength:      -1,
+		totalDigits:    -1,
+		fractionDigits: -1,
+	}
+	if base != nil {
+		t.primitive = base.primitive
+		t.whiteSpace = base.whiteSpace
+		t.item = base.item
+		t.members = base.members
+	}
+	return t
+}
+
+// validate checks value, giving an error that names the type if it is
+// not valid.
+func (t *simpleType) validate(value string) error {
+	err := t.check(t.normalise(value))
+	if err != nil {
+		return fmt.Errorf("'%s' is not a valid %s: %v", value, t.name, err)
+	}
+	return nil
+}
+
+func (t *simpleType) normalise(value string) string {
+	switch t.whiteSpace {
+	case replace:
+		return strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\n' || r == '\r' {
+				return ' '
+			}
+			return r
+		}, value)
+	case collapse:
+		return strings.Join(strings.Fields(value), " ")
+	}
+	return value
+}
+
+func (t *simpleType) check(value string) error {
+	if t.base != nil {
+		err := t.base.check(value)
+		if err != nil {
+			return err
+		}
+	} else if t.item != nil {
+		for _, item := range strings.Fields(value) {
+			err := t.item.validate(item)
+			if err != nil {
+				return err
+			}
+		}
+	} else if len(t.members) > 0 {
+		var names []string
+		for _, member := range t.members {
+			if member.validate(value) == nil {
+				return nil
+			}
+			names = append(names, member.name)
+		}
+		return fmt.Errorf("it is not any of %s", strings.Join(names, ", "))
+	}
+	if t.lexical != nil {
+		err := t.lexical(value)
+		if err != nil {
+			return err
+		}
+	}
+	return t.checkFacets(value)
+}
+
+func (t *simpleType) checkFacets(value string) error {
+	if len(t.patterns) > 0 && !slices.ContainsFunc(t.patterns, func(p pattern) bool { return p.re.MatchString(value) }) {
+		return fmt.Errorf("it does not match the pattern %s", patternSource(t.patterns))
+	}
+	if len(t.enumeration) > 0 && !slices.Contains(t.enumeration, value) {
+		return fmt.Errorf("it is not one of '%s'", strings.Join(t.enumeration, "', '"))
+	}
+
+	length := utf8.RuneCountInString(value)
+	unit := "characters"
+	if t.item != nil {
+		length = len(strings.Fields(value))
+		unit = "items"
+	}
+	switch {
+	case t.length >= 0 && length != t.length:
+		return fmt.Errorf("it has %d %s rather than %d", length, unit, t.length)
+	case t.minLength >= 0 && length < t.minLength:
+		return fmt.Errorf("it has %d %s but needs at least %d", length, unit, t.minLength)
+	case t.maxLength >= 0 && length > t.maxLength:
+		return fmt.Errorf("it has %d %s but can have at most %d", length, unit, t.maxLength)
+	}
+
+	bounds := []struct {
+		limit *string
+		ok    func(int) bool
+		what  string
+	}{
+		{t.minInclusive, func(c int) bool { return c >= 0 }, "less than the minimum of"},
+		{t.maxInclusive, func(c int) bool { return c <= 0 }, "greater than the maximum of"},
+		{t.minExclusive, func(c int) bool { return c > 0 }, "not greater than"},
+		{t.maxExclusive, func(c int) bool { return c < 0 }, "not less than"},
+	}
+	for _, bound := range bounds {
+		if bound.limit == nil {
+			continue
+		}
+		c, err := compareValues(t.primitive, value, *bound.limit)
+		if err != nil {
+			return err
+		}
+		if !bound.ok(c) {
+			return fmt.Errorf("it is %s %s", bound.what, *bound.limit)
+		}
+	}
+
+	if t.totalDigits >= 0 || t.fractionDigits >= 0 {
+		whole, fraction, _ := strings.Cut(strings.TrimLeft(value, "+-"), ".")
+		whole = strings.TrimLeft(whole, "0")
+		fraction = strings.TrimRight(fraction, "0")
+		if t.totalDigits >= 0 && len(whole)+len(fraction) > t.totalDigits {
+			return fmt.Errorf("it has more than %d digits", t.totalDigits)
+		}
+		if t.fractionDigits >= 0 && len(fraction) > t.fractionDigits {
+			return fmt.Errorf("it has more than %d fraction digits", t.fractionDigits)
+		}
+	}
+	return nil
+}
+
+func (t *simpleType) addFacet(name, value string) error {
+	var err error
+	switch name {
+	case "pattern":
+		var p pattern
+		p, err = compilePattern(value)
+		t.patterns = append(t.patterns, p)
+	case "enumeration":
+		t.enumeration = append(t.enumeration, value)
+	case "length":
+		t.length, err = strconv.Atoi(value)
+	case "minLength":
+		t.minLength, err = strconv.Atoi(value)
+	case "maxLength":
+		t.maxLength, err = strconv.Atoi(value)
+	case "totalDigits":
+		t.totalDigits, err = strconv.Atoi(value)
+	case "fractionDigits":
+		t.fractionDigits, err = strconv.Atoi(value)
+	case "minInclusive", "maxInclusive", "minExclusive", "maxExclusive":
+		_, err = compareValues(t.primitive, value, value)
+		if err == nil && t.base != nil {
+			err = t.base.validate(value)
+		}
+		bound := map[string]**string{
+			"minInclusive": &t.minInclusive,
+			"maxInclusive": &t.maxInclusive,
+			"minExclusive": &t.minExclusive,
+			"maxExclusive": &t.maxExclusive,
+		}[name]
+		*bound = limit(value)
+	case "whiteSpace":
+		switch value {
+		case "preserve":
+			t.whiteSpace = preserve
+		case "replace":
+			t.whiteSpace = replace
+		case "collapse":
+			t.whiteSpace = collapse
+		default:
+			err = fmt.Errorf("unknown whiteSpace '%s'", value)
+		}
+	default:
+		err = fmt.Errorf("unknown facet")
+	}
+	return err
+}
+
+// Datatype is a built in XML Schema datatype, possibly restricted by
+// facets, for other schema languages to check text against.
+type Datatype struct {
+	t *simpleType
+}
+
+type Facet struct {
+	Name, Value string
+}
+
+// NewDatatype restricts the built in type with the given local name by
+// facets, such as {"maxLength", "10"}.
+func NewDatatype(name string, facets []Facet) (*Datatype, error) {
+	base, ok := builtins[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown built in type 'xs:%s'", name)
+	}
+	if len(facets) == 0 {
+		return &Datatype{base}, nil
+	}
+	t := newSimpleType(base.name, base)
+	for _, facet := range facets {
+		err := t.addFacet(facet.Name, facet.Value)
+		if err != nil {
+			return nil, fmt.Errorf("bad %s facet '%s': %v", facet.Name, facet.Value, err)
+		}
+	}
+	return &Datatype{t}, nil
+}
+
+func (d *Datatype) Name() string {
+	return d.t.name
+}
+
+func (d *Datatype) Validate(value string) error {
+	return d.t.validate(value)
+}
+
+// Equal reports whether a and b are the same value of the type, so that
+// 1.0 and 1 are equal as decimals.
+func (d *Datatype) Equal(a, b string) bool {
+	a, b = d.t.normalise(a), d.t.normalise(b)
+	c, err := compareValues(d.t.primitive, a, b)
+	if err == nil {
+		return c == 0
+	}
+	return a == b
+}
+
+func patternSource(patterns []pattern) string {
+	sources := make([]string, len(patterns))
+	for i, p := range patterns {
+		sources[i] = "'" + p.source + "'"
+	}
+	return strings.Join(sources, " or ")
+}
+
+// compareValues orders two values of a type, giving a negative number if
+// a comes first, zero if they are equal and a positive number otherwise.
+func compareValues(prim primitive, a, b string) (int, error) {
+	switch prim {
+	case decimalPrimitive:
+		ra, okA := new(big.Rat).SetString(a)
+		rb, okB := new(big.Rat).SetString(b)
+		if !okA || !okB {
+			return 0, fmt.Errorf("cannot compare '%s' with '%s'", a, b)
+		}
+		return ra.Cmp(rb), nil
+	case floatPrimitive:
+		fa, errA := parseFloat(a)
+		fb, errB := parseFloat(b)
+		if errA != nil || errB != nil {
+			return 0, fmt.Errorf("cannot compare '%s' with '%s'", a, b)
+		}
+		switch {
+		case fa < fb:
+			return -1, nil
+		case fa > fb:
+			return 1, nil
+		}
+		return 0, nil
+	case dateTimePrimitive, datePrimitive, timePrimitive, gYearPrimitive:
+		ta, errA := parseTime(prim, a)
+		tb, errB := parseTime(prim, b)
+		if errA != nil || errB != nil {
+			return 0, fmt.Errorf("cannot compare '%s' with '%s'", a, b)
+		}
+		return ta.Compare(tb), nil
+	}
+	return 0, fmt.Errorf("values of this type have no order")
+}
+
+func parseFloat(s string) (float64, error) {
+	switch s {
+	case "INF", "+INF":
+		return strconv.ParseFloat("+Inf", 64)
+	case "-INF":
+		return strconv.ParseFloat("-Inf", 64)
+	case "NaN":
+		return strconv.ParseFloat("NaN", 64)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+var timeLayouts = map[primitive][]string{
+	dateTimePrimitive: {"2006-01-02T15:04:05Z07:00", "2006-01-02T15:04:05"},
+	datePrimitive:     {"2006-01-02Z07:00", "2006-01-02"},
+	timePrimitive:     {"15:04:05Z07:00", "15:04:05"},
+	gYearPrimitive:    {"2006Z07:00", "2006"},
+}
+
+func parseTime(prim primitive, s string) (time.Time, error) {
+	var err error
+	for _, layout := range timeLayouts[prim] {
+		var t time.Time
+		t, err = time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func matching(pattern, what string) func(string) error {
+	re := regexp.MustCompile(pattern)
+	return func(s string) error {
+		if !re.MatchString(s) {
+			return fmt.Errorf("it is not %s", what)
+		}
+		return nil
+	}
+}
+
+func timeValue(prim primitive, pattern, what string) func(string) error {
+	lexical := matching(pattern, what)
+	return func(s string) error {
+		err := lexical(s)
+		if err != nil {
+			return err
+		}
+		_, err = parseTime(prim, s)
+		if err != nil {
+			return fmt.Errorf("it is not %s", what)
+		}
+		return nil
+	}
+}
+
+const timezone = `(Z|[+-]\d{2}:\d{2})?`
+
+// builtins are the XML Schema datatypes, keyed by local name.
+var builtins = map[string]*simpleType{}
+
+func builtin(name string, base *simpleType, setup func(t *simpleType)) *simpleType {
+	t := newSimpleType("xs:"+name, base)
+	if setup != nil {
+		setup(t)
+	}
+	builtins[name] = t
+	return t
+}
+
+func limit(s string) *string {
+	return &s
+}
+
+func integerType(name string, base *simpleType, min, max string) *simpleType {
+	return builtin(name, base, func(t *simpleType) {
+		if min != "" {
+			t.minInclusive = limit(min)
+		}
+		if max != "" {
+			t.maxInclusive = limit(max)
+		}
+	})
+}
+
+func init() {
+	anySimpleType := builtin("anySimpleType", nil, nil)
+	str := builtin("string", anySimpleType, nil)
+	normalizedString := builtin("normalizedString", str, func(t *simpleType) { t.whiteSpace = replace })
+	token := builtin("token", normalizedString, func(t *simpleType) { t.whiteSpace = collapse })
+	builtin("language", token, func(t *simpleType) {
+		t.lexical = matching(`^[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*$`, "a language tag")
+	})
+	nmtoken := builtin("NMTOKEN", token, func(t *simpleType) {
+		t.lexical = func(s string) error {
+			if !dtd.IsNmtoken(s) {
+				return fmt.Errorf("it is not a name token")
+			}
+			return nil
+		}
+	})
+	builtin("NMTOKENS", nil, func(t *simpleType) {
+		t.whiteSpace = collapse
+		t.item = nmtoken
+		t.minLength = 1
+	})
+	name := builtin("Name", token, func(t *simpleType) {
+		t.lexical = func(s string) error {
+			if !dtd.IsName(s) {
+				return fmt.Errorf("it is not a name")
+			}
+			return nil
+		}
+	})
+	ncName := builtin("NCName", name, func(t *simpleType) {
+		t.lexical = func(s string) error {
+			if strings.Contains(s, ":") {
+				return fmt.Errorf("it has a colon")
+			}
+			return nil
+		}
+	})
+	builtin("ID", ncName, nil)
+	idref := builtin("IDREF", ncName, nil)
+	builtin("IDREFS", nil, func(t *simpleType) {
+		t.whiteSpace = collapse
+		t.item = idref
+		t.minLength = 1
+	})
+	entity := builtin("ENTITY", ncName, nil)
+	builtin("ENTITIES", nil, func(t *simpleType) {
+		t.whiteSpace = collapse
+		t.item = entity
+		t.minLength = 1
+	})
+
+	collapsed := func(prim primitive, lexical func(string) error) func(t *simpleType) {
+		return func(t *simpleType) {
+			t.primitive = prim
+			t.whiteSpace = collapse
+			t.lexical = lexical
+		}
+	}
+	builtin("boolean", anySimpleType, collapsed(booleanPrimitive, matching(`^(true|false|1|0)$`, "true, false, 1 or 0")))
+	builtin("anyURI", anySimpleType, collapsed(otherPrimitive, func(s string) error {
+		_, err := url.Parse(s)
+		if err != nil {
+			return fmt.Errorf("it is not a URI")
+		}
+		return nil
+	}))
+	builtin("QName", anySimpleType, collapsed(otherPrimitive, func(s string) error {
+		prefix, local, found := strings.Cut(s, ":")
+		if !dtd.IsName(local) || strings.Contains(local, ":") || found && !dtd.IsName(prefix) {
+			return fmt.Errorf("it is not a qualified name")
+		}
+		return nil
+	}))
+	builtin("hexBinary", anySimpleType, collapsed(otherPrimitive, matching(`^([0-9a-fA-F]{2})*$`, "hex encoded")))
+	builtin("base64Binary", anySimpleType, collapsed(otherPrimitive, func(s string) error {
+		_, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(s, " ", ""))
+		if err != nil {
+			return fmt.Errorf("it is not base64 encoded")
+		}
+		return nil
+	}))
+	builtin("duration", anySimpleType, collapsed(otherPrimitive, func(s string) error {
+		re := regexp.MustCompile(`^-?P(\d+Y)?(\d+M)?(\d+D)?(T(\d+H)?(\d+M)?(\d+(\.\d+)?S)?)?$`)
+		if !re.MatchString(s) || strings.HasSuffix(s, "P") || strings.HasSuffix(s, "T") {
+			return fmt.Errorf("it is not a duration")
+		}
+		return nil
+	}))
+
+	builtin("float", anySimpleType, collapsed(floatPrimitive, matching(`^([+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?|[+-]?INF|NaN)$`, "a floating point number")))
+	builtin("double", anySimpleType, collapsed(floatPrimitive, matching(`^([+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?|[+-]?INF|NaN)$`, "a floating point number")))
+	decimal := builtin("decimal", anySimpleType, collapsed(decimalPrimitive, matching(`^[+-]?(\d+(\.\d*)?|\.\d+)$`, "a decimal number")))
+	integer := builtin("integer", decimal, func(t *simpleType) {
+		t.lexical = matching(`^[+-]?\d+$`, "an integer")
+	})
+	long := integerType("long", integer, "-9223372036854775808", "9223372036854775807")
+	integerType("int", long, "-2147483648", "2147483647")
+	integerType("short", long, "-32768", "32767")
+	integerType("byte", long, "-128", "127")
+	nonNegative := integerType("nonNegativeInteger", integer, "0", "")
+	integerType("positiveInteger", nonNegative, "1", "")
+	nonPositive := integerType("nonPositiveInteger", integer, "", "0")
+	integerType("negativeInteger", nonPositive, "", "-1")
+	unsignedLong := integerType("unsignedLong", nonNegative, "", "18446744073709551615")
+	integerType("unsignedInt", unsignedLong, "", "4294967295")
+	integerType("unsignedShort", unsignedLong, "", "65535")
+	integerType("unsignedByte", unsignedLong, "", "255")
+
+	builtin("dateTime", anySimpleType, collapsed(dateTimePrimitive, timeValue(dateTimePrimitive, `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?`+timezone+`$`, "a date and time")))
+	builtin("date", anySimpleType, collapsed(datePrimitive, timeValue(datePrimitive, `^\d{4}-\d{2}-\d{2}`+timezone+`$`, "a date")))
+	builtin("time", anySimpleType, collapsed(timePrimitive, timeValue(timePrimitive, `^\d{2}:\d{2}:\d{2}(\.\d+)?`+timezone+`$`, "a time")))
+	builtin("gYear", anySimpleType, collapsed(gYearPrimitive, timeValue(gYearPrimitive, `^\d{4}`+timezone+`$`, "a year")))
+}
@@ -0,0 +1,202 @@
+package xsd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBuiltinTypes(t *testing.T) {
+	table := []struct {
+		typ   string
+		value string
+		valid bool
+	}{
+		{"string", " any\tthing ", true},
+		{"token", "  collapsed   words ", true},
+		{"boolean", "true", true},
+		{"boolean", " 0 ", true},
+		{"boolean", "yes", false},
+		{"decimal", "-12.50", true},
+		{"decimal", ".5", true},
+		{"decimal", "1e5", false},
+		{"integer", "+42", true},
+		{"integer", "4.2", false},
+		{"int", "2147483647", true},
+		{"int", "2147483648", false},
+		{"byte", "-129", false},
+		{"unsignedByte", "255", true},
+		{"unsignedByte", "-1", false},
+		{"positiveInteger", "0", false},
+		{"nonNegativeInteger", "0", true},
+		{"negativeInteger", "-1", true},
+		{"double", "1.5E-3", true},
+		{"float", "INF", true},
+		{"float", "inf", false},
+		{"date", "2024-02-29", true},
+		{"date", "2023-02-29", false},
+		{"date", "2024-02-29Z", true},
+		{"dateTime", "2024-01-02T03:04:05.123+01:00", true},
+		{"dateTime", "2024-01-02 03:04:05", false},
+		{"time", "23:59:59", true},
+		{"time", "24:00:01", false},
+		{"gYear", "2024", true},
+		{"duration", "P1Y2M3DT4H5M6.5S", true},
+		{"duration", "P", false},
+		{"duration", "PT", false},
+		{"hexBinary", "0aFF", true},
+		{"hexBinary", "0aF", false},
+		{"base64Binary", "aGVsbG8=", true},
+		{"base64Binary", "aGVsbG8", false},
+		{"language", "en-GB", true},
+		{"language", "english language", false},
+		{"NCName", "a-b.c", true},
+		{"NCName", "a:b", false},
+		{"Name", "a:b", true},
+		{"ID", "1a", false},
+		{"NMTOKEN", "1a", true},
+		{"NMTOKENS", " a  b c ", true},
+		{"NMTOKENS", "", false},
+		{"QName", "xs:string", true},
+		{"QName", "a:b:c", false},
+		{"anyURI", "http://example.com/a?b=c", true},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			err := builtins[tst.typ].validate(tst.value)
+			if tst.valid && err != nil {
+				t.Errorf("wanted '%s' to be a valid %s but got %v", tst.value, tst.typ, err)
+			}
+			if !tst.valid && err == nil {
+				t.Errorf("wanted '%s' to be an invalid %s", tst.value, tst.typ)
+			}
+		})
+	}
+}
+
+func TestFacets(t *testing.T) {
+	schema := `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+		<xs:simpleType name="sku">
+			<xs:restriction base="xs:string">
+				<xs:pattern value="[A-Z]{3}-\d+"/>
+				<xs:pattern value="none"/>
+			</xs:restriction>
+		</xs:simpleType>
+		<xs:simpleType name="shortSku">
+			<xs:restriction base="sku">
+				<xs:maxLength value="6"/>
+			</xs:restriction>
+		</xs:simpleType>
+		<xs:simpleType name="size">
+			<xs:restriction base="xs:token">
+				<xs:enumeration value="S"/>
+				<xs:enumeration value="M"/>
+				<xs:enumeration value="L"/>
+			</xs:restriction>
+		</xs:simpleType>
+		<xs:simpleType name="percent">
+			<xs:restriction base="xs:decimal">
+				<xs:minInclusive value="0"/>
+				<xs:maxExclusive value="100"/>
+				<xs:fractionDigits value="2"/>
+			</xs:restriction>
+		</xs:simpleType>
+		<xs:simpleType name="code">
+			<xs:restriction base="xs:string">
+				<xs:length value="2"/>
+			</xs:restriction>
+		</xs:simpleType>
+		<xs:simpleType name="codes">
+			<xs:list itemType="code"/>
+		</xs:simpleType>
+		<xs:simpleType name="fewCodes">
+			<xs:restriction base="codes">
+				<xs:maxLength value="2"/>
+			</xs:restriction>
+		</xs:simpleType>
+		<xs:simpleType name="sizeOrNumber">
+			<xs:union memberTypes="size xs:integer"/>
+		</xs:simpleType>
+		<xs:simpleType name="recent">
+			<xs:restriction base="xs:date">
+				<xs:minInclusive value="2020-01-01"/>
+			</xs:restriction>
+		</xs:simpleType>
+	</xs:schema>`
+	c := compile(t, schema)
+
+	table := []struct {
+		typ   string
+		value string
+		want  string
+	}{
+		{"sku", "ABC-123", ""},
+		{"sku", "none", ""},
+		{"sku", "abc-123", `'abc-123' is not a valid sku: it does not match the pattern '[A-Z]{3}-\d+' or 'none'`},
+		{"shortSku", "ABC-12", ""},
+		{"shortSku", "ABC-123", "'ABC-123' is not a valid shortSku: it has 7 characters but can have at most 6"},
+		{"size", " M ", ""},
+		{"size", "XL", "'XL' is not a valid size: it is not one of 'S', 'M', 'L'"},
+		{"percent", "99.99", ""},
+		{"percent", "100", "'100' is not a valid percent: it is not less than 100"},
+		{"percent", "-1", "'-1' is not a valid percent: it is less than the minimum of 0"},
+		{"percent", "1.234", "'1.234' is not a valid percent: it has more than 2 fraction digits"},
+		{"percent", "lots", "'lots' is not a valid percent: it is not a decimal number"},
+		{"codes", "ab cd ef", ""},
+		{"codes", "ab cde", "'ab cde' is not a valid codes: 'cde' is not a valid code: it has 3 characters rather than 2"},
+		{"fewCodes", "ab cd ef", "'ab cd ef' is not a valid fewCodes: it has 3 items but can have at most 2"},
+		{"sizeOrNumber", "12", ""},
+		{"sizeOrNumber", "XL", "'XL' is not a valid sizeOrNumber: it is not any of size, xs:integer"},
+		{"recent", "2024-06-01", ""},
+		{"recent", "2019-12-31", "'2019-12-31' is not a valid recent: it is less than the minimum of 2020-01-01"},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			typ := c.simpleTypes[qname{"", tst.typ}]
+			if typ == nil {
+				t.Fatalf("no type %s", tst.typ)
+			}
+			got := ""
+			if err := typ.validate(tst.value); err != nil {
+				got = err.Error()
+			}
+			if got != tst.want {
+				t.Errorf("wanted %q but got %q", tst.want, got)
+			}
+		})
+	}
+}
+
+func TestDatatype(t *testing.T) {
+	d, err := NewDatatype("decimal", []Facet{{"maxInclusive", "10"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Validate("9.5"); err != nil {
+		t.Error(err)
+	}
+	if err := d.Validate("11"); err == nil {
+		t.Error("wanted 11 to be over the maximum")
+	}
+	if !d.Equal("1.0", " 1") {
+		t.Error("wanted 1.0 and 1 to be equal decimals")
+	}
+
+	s, err := NewDatatype("token", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Equal("a  b", " a b ") || s.Equal("a", "b") {
+		t.Error("wrong token equality")
+	}
+
+	_, err = NewDatatype("strung", nil)
+	if err == nil || err.Error() != "unknown built in type 'xs:strung'" {
+		t.Errorf("wrong error %v", err)
+	}
+	_, err = NewDatatype("string", []Facet{{"length", "two"}})
+	if err == nil {
+		t.Error("wanted an error for a bad facet")
+	}
+}
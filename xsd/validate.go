@@ -0,0 +1,371 @@
+package xsd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/danwhitford/xmlparser"
+)
+
+const instanceNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+type validator struct {
+	schema *Schema
+	errs   []*Error
+}
+
+// Validate checks root against the schema, returning every problem it
+// finds. It gives nil if root is valid.
+func (s *Schema) Validate(root xmlparser.XmlNode) []*Error {
+	v := &validator{schema: s}
+	path := "/" + root.Name
+	decl, ok := s.elements[qname{root.Namespace, root.Local()}]
+	if !ok {
+		v.errorf(root, path, "no global element '%s' is declared", root.Local())
+		return v.errs
+	}
+	v.element(root, decl, path)
+	return v.errs
+}
+
+func (v *validator) errorf(node xmlparser.XmlNode, path, format string, args ...any) {
+	v.errs = append(v.errs, &Error{
+		Path: path,
+		Pos:  node.Span.Start,
+		Msg:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) element(node xmlparser.XmlNode, decl *elementDecl, path string) {
+	text, hasElements := textOf(node)
+
+	if decl.simple != nil {
+		v.attributes(node, nil, decl.simple.name, path)
+		if hasElements {
+			v.errorf(node, path, "element '%s' cannot contain elements (type %s)", node.Name, decl.simple.name)
+			return
+		}
+		v.value(node, decl, decl.simple, text, path)
+		return
+	}
+
+	t := decl.complex
+	v.attributes(node, t, t.name, path)
+	if t.simple != nil {
+		if hasElements {
+			v.errorf(node, path, "element '%s' cannot contain elements (type %s)", node.Name, t.name)
+			return
+		}
+		v.value(node, decl, t.simple, text, path)
+		return
+	}
+
+	if !t.mixed && strings.TrimSpace(text) != "" {
+		v.errorf(node, path, "element '%s' cannot contain text (type %s)", node.Name, t.name)
+	}
+	v.content(node, t, path)
+}
+
+// textOf joins the text directly inside node, and reports whether it has
+// any element children too.
+func textOf(node xmlparser.XmlNode) (string, bool) {
+	if len(node.Children) == 0 {
+		return node.Contents, false
+	}
+	var sb strings.Builder
+	hasElements := false
+	for _, child := range node.Children {
+		switch child.Type {
+		case xmlparser.ElementNode:
+			hasElements = true
+		case xmlparser.TextNode, xmlparser.CDataNode:
+			sb.WriteString(child.Contents)
+		}
+	}
+	return sb.String(), hasElements
+}
+
+func (v *validator) value(node xmlparser.XmlNode, decl *elementDecl, t *simpleType, text, path string) {
+	if text == "" && decl.def != nil {
+		text = *decl.def
+	}
+	if decl.fixed != nil {
+		if text == "" {
+			text = *decl.fixed
+		}
+		if t.normalise(text) != t.normalise(*decl.fixed) {
+			v.errorf(node, path, "element '%s' must be '%s' but is '%s'", node.Name, *decl.fixed, text)
+			return
+		}
+	}
+	err := t.validate(text)
+	if err != nil {
+		v.errorf(node, path, "%v", err)
+	}
+}
+
+func (v *validator) attributes(node xmlparser.XmlNode, t *complexType, typeName, path string) {
+	var decls []*attributeDecl
+	anyAttribute := false
+	if t != nil {
+		decls = t.attributes
+		anyAttribute = t.anyAttribute
+	}
+
+	for _, a := range node.Attributes {
+		if a.Namespace == xmlparser.XMLNSNamespace || a.Namespace == instanceNamespace {
+			continue
+		}
+		name := qname{a.Namespace, a.Local()}
+		var decl *attributeDecl
+		for _, d := range decls {
+			if d.name == name {
+				decl = d
+			}
+		}
+		if decl == nil {
+			if !anyAttribute {
+				v.errorf(node, path, "attribute '%s' is not allowed (type %s)", a.Key, typeName)
+			}
+			continue
+		}
+		if decl.fixed != nil && decl.typ.normalise(a.Value) != decl.typ.normalise(*decl.fixed) {
+			v.errorf(node, path, "attribute '%s' must be '%s' but is '%s'", a.Key, *decl.fixed, a.Value)
+			continue
+		}
+		err := decl.typ.validate(a.Value)
+		if err != nil {
+			v.errorf(node, path, "attribute '%s': %v", a.Key, err)
+		}
+	}
+
+	for _, decl := range decls {
+		if !decl.required {
+			continue
+		}
+		found := false
+		for _, a := range node.Attributes {
+			found = found || a.Namespace == decl.name.space && a.Local() == decl.name.local
+		}
+		if !found {
+			v.errorf(node, path, "missing required attribute '%s' (type %s)", decl.name, typeName)
+		}
+	}
+}
+
+// matcher checks the element children of one element against its
+// content model. Schemas have to be unambiguous, so the children can be
+// matched greedily with one element of lookahead.
+type matcher struct {
+	v      *validator
+	parent xmlparser.XmlNode
+	t      *complexType
+	path   string
+	kids   []xmlparser.XmlNode
+	paths  []string
+}
+
+func (v *validator) content(node xmlparser.XmlNode, t *complexType, path string) {
+	m := &matcher{v: v, parent: node, t: t, path: path}
+	counts := map[string]int{}
+	for _, child := range node.Children {
+		if child.Type == xmlparser.ElementNode {
+			counts[child.Name]++
+		}
+	}
+	seen := map[string]int{}
+	for _, child := range node.Children {
+		if child.Type != xmlparser.ElementNode {
+			continue
+		}
+		seen[child.Name]++
+		childPath := path + "/" + child.Name
+		if counts[child.Name] > 1 {
+			childPath += fmt.Sprintf("[%d]", seen[child.Name])
+		}
+		m.kids = append(m.kids, child)
+		m.paths = append(m.paths, childPath)
+	}
+
+	if t.content == nil {
+		if len(m.kids) > 0 {
+			v.errorf(m.kids[0], m.paths[0], "unexpected element '%s', '%s' must be empty (type %s)", m.kids[0].Name, node.Name, t.name)
+		}
+		return
+	}
+	i, ok := m.occurrences(t.content, 0)
+	if ok && i < len(m.kids) {
+		v.errorf(m.kids[i], m.paths[i], "unexpected element '%s' in '%s' (type %s)", m.kids[i].Name, node.Name, t.name)
+	}
+}
+
+func (m *matcher) fail(p *particle, i int) {
+	expected := strings.Join(firsts(p), " or ")
+	if i < len(m.kids) {
+		m.v.errorf(m.kids[i], m.paths[i], "unexpected element '%s', expected %s (type %s)", m.kids[i].Name, expected, m.t.name)
+		return
+	}
+	m.v.errorf(m.parent, m.path, "content of '%s' is incomplete, expected %s (type %s)", m.parent.Name, expected, m.t.name)
+}
+
+// occurrences matches p as many times as it can up to its maxOccurs,
+// giving the index of the first child left over.
+func (m *matcher) occurrences(p *particle, i int) (int, bool) {
+	count := 0
+	for p.max < 0 || count < p.max {
+		if i >= len(m.kids) || !m.starts(p, m.kids[i]) {
+			break
+		}
+		j, ok := m.term(p, i)
+		if !ok {
+			return j, false
+		}
+		i = j
+		count++
+	}
+	if count < p.min && !nullableTerm(p) {
+		m.fail(p, i)
+		return i, false
+	}
+	return i, true
+}
+
+// term matches p once, starting from a child that p can start with.
+func (m *matcher) term(p *particle, i int) (int, bool) {
+	switch p.kind {
+	case elementParticle:
+		m.v.element(m.kids[i], p.element, m.paths[i])
+		return i + 1, true
+	case anyParticle:
+		m.wildcard(p, i)
+		return i + 1, true
+	case sequenceParticle:
+		for _, child := range p.children {
+			j, ok := m.occurrences(child, i)
+			if !ok {
+				return j, false
+			}
+			i = j
+		}
+		return i, true
+	case choiceParticle:
+		for _, child := range p.children {
+			if m.starts(child, m.kids[i]) {
+				return m.occurrences(child, i)
+			}
+		}
+	case allParticle:
+		used := map[*particle]bool{}
+		for i < len(m.kids) {
+			var next *particle
+			for _, child := range p.children {
+				if !used[child] && m.starts(child, m.kids[i]) {
+					next = child
+				}
+			}
+			if next == nil {
+				break
+			}
+			used[next] = true
+			m.v.element(m.kids[i], next.element, m.paths[i])
+			i++
+		}
+		for _, child := range p.children {
+			if !used[child] && child.min > 0 {
+				m.fail(child, i)
+				return i, false
+			}
+		}
+		return i, true
+	}
+	return i, true
+}
+
+func (m *matcher) wildcard(p *particle, i int) {
+	if p.process == "skip" {
+		return
+	}
+	node := m.kids[i]
+	decl, ok := m.v.schema.elements[qname{node.Namespace, node.Local()}]
+	if ok {
+		m.v.element(node, decl, m.paths[i])
+	} else if p.process == "strict" {
+		m.v.errorf(node, m.paths[i], "no global element '%s' is declared", node.Local())
+	}
+}
+
+func (m *matcher) starts(p *particle, node xmlparser.XmlNode) bool {
+	switch p.kind {
+	case elementParticle:
+		return node.Namespace == p.element.name.space && node.Local() == p.element.name.local
+	case anyParticle:
+		return !p.other || node.Namespace != m.v.schema.TargetNamespace && node.Namespace != ""
+	case sequenceParticle:
+		for _, child := range p.children {
+			if m.starts(child, node) {
+				return true
+			}
+			if !nullable(child) {
+				return false
+			}
+		}
+		return false
+	default:
+		for _, child := range p.children {
+			if m.starts(child, node) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func nullable(p *particle) bool {
+	return p.min == 0 || nullableTerm(p)
+}
+
+// nullableTerm reports whether a single occurrence of p can match no
+// elements at all.
+func nullableTerm(p *particle) bool {
+	switch p.kind {
+	case sequenceParticle, allParticle:
+		for _, child := range p.children {
+			if !nullable(child) {
+				return false
+			}
+		}
+		return true
+	case choiceParticle:
+		for _, child := range p.children {
+			if nullable(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// firsts names the elements p could start with, for error messages.
+func firsts(p *particle) []string {
+	switch p.kind {
+	case elementParticle:
+		return []string{"'" + p.element.name.local + "'"}
+	case anyParticle:
+		return []string{"any element"}
+	case sequenceParticle:
+		var names []string
+		for _, child := range p.children {
+			names = append(names, firsts(child)...)
+			if !nullable(child) {
+				break
+			}
+		}
+		return names
+	default:
+		var names []string
+		for _, child := range p.children {
+			names = append(names, firsts(child)...)
+		}
+		return names
+	}
+}
@@ -0,0 +1,221 @@
+package xsd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/danwhitford/xmlparser"
+	"github.com/google/go-cmp/cmp"
+)
+
+const orderSchema = `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"
+	xmlns:o="urn:orders" targetNamespace="urn:orders" elementFormDefault="qualified">
+
+	<xs:element name="order" type="o:Order"/>
+	<xs:element name="note" type="xs:string"/>
+
+	<xs:complexType name="Order">
+		<xs:sequence>
+			<xs:element name="customer" type="o:Customer"/>
+			<xs:element name="item" type="o:Item" maxOccurs="unbounded"/>
+			<xs:choice minOccurs="0">
+				<xs:element name="pickup" type="xs:date"/>
+				<xs:element name="delivery" type="o:Address"/>
+			</xs:choice>
+			<xs:group ref="o:extras"/>
+		</xs:sequence>
+		<xs:attribute name="id" type="xs:positiveInteger" use="required"/>
+		<xs:attribute name="status" default="new">
+			<xs:simpleType>
+				<xs:restriction base="xs:token">
+					<xs:enumeration value="new"/>
+					<xs:enumeration value="paid"/>
+				</xs:restriction>
+			</xs:simpleType>
+		</xs:attribute>
+		<xs:attribute name="version" type="xs:string" fixed="2"/>
+	</xs:complexType>
+
+	<xs:group name="extras">
+		<xs:sequence>
+			<xs:any namespace="##other" processContents="skip" minOccurs="0" maxOccurs="unbounded"/>
+		</xs:sequence>
+	</xs:group>
+
+	<xs:complexType name="Customer">
+		<xs:all>
+			<xs:element name="name" type="xs:string"/>
+			<xs:element name="email" minOccurs="0">
+				<xs:simpleType>
+					<xs:restriction base="xs:string">
+						<xs:pattern value="[^@]+@[^@]+"/>
+					</xs:restriction>
+				</xs:simpleType>
+			</xs:element>
+		</xs:all>
+	</xs:complexType>
+
+	<xs:complexType name="Item">
+		<xs:sequence>
+			<xs:element name="sku" type="xs:token"/>
+			<xs:element name="qty" type="xs:positiveInteger" default="1"/>
+			<xs:element name="price" type="o:Price"/>
+			<xs:element ref="o:note" minOccurs="0"/>
+		</xs:sequence>
+	</xs:complexType>
+
+	<xs:complexType name="Price">
+		<xs:simpleContent>
+			<xs:extension base="xs:decimal">
+				<xs:attributeGroup ref="o:currency"/>
+			</xs:extension>
+		</xs:simpleContent>
+	</xs:complexType>
+
+	<xs:attributeGroup name="currency">
+		<xs:attribute name="currency" type="xs:string" use="required"/>
+	</xs:attributeGroup>
+
+	<xs:complexType name="Address">
+		<xs:sequence>
+			<xs:element name="line" type="xs:string" maxOccurs="3"/>
+		</xs:sequence>
+	</xs:complexType>
+
+	<xs:complexType name="UKAddress">
+		<xs:complexContent>
+			<xs:extension base="o:Address">
+				<xs:sequence>
+					<xs:element name="postcode" type="xs:string"/>
+				</xs:sequence>
+			</xs:extension>
+		</xs:complexContent>
+	</xs:complexType>
+</xs:schema>`
+
+func TestValidate(t *testing.T) {
+	schema, err := Parse(orderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		input string
+		want  []string
+	}{
+		{
+			`<order xmlns="urn:orders" xmlns:x="urn:other" id="7">
+				<customer><email>a@b.com</email><name>Ann</name></customer>
+				<item><sku>A1</sku><qty/><price currency="GBP">1.50</price></item>
+				<item><sku> B2 </sku><qty>3</qty><price currency="GBP">2</price><note>fragile</note></item>
+				<delivery><line>1 High St</line><line>Town</line></delivery>
+				<x:anything><x:goes/></x:anything>
+			</order>`,
+			nil,
+		},
+		{
+			`<order xmlns="urn:orders" id="0" status="lost" version="3" colour="red">
+				<customer><email>nope</email></customer>
+				<item><sku>A1</sku><qty>-2</qty><price>cheap</price></item>
+				<item><qty>1</qty></item>
+				<pickup>soon</pickup>
+			</order>`,
+			[]string{
+				"1:1: /order: attribute 'id': '0' is not a valid xs:positiveInteger: it is less than the minimum of 1",
+				"1:1: /order: attribute 'status': 'lost' is not a valid value for '@status': it is not one of 'new', 'paid'",
+				"1:1: /order: attribute 'version' must be '2' but is '3'",
+				"1:1: /order: attribute 'colour' is not allowed (type Order)",
+				"2:15: /order/customer/email: 'nope' is not a valid value for 'email': it does not match the pattern '[^@]+@[^@]+'",
+				"2:5: /order/customer: content of 'customer' is incomplete, expected 'name' (type Customer)",
+				"3:24: /order/item[1]/qty: '-2' is not a valid xs:positiveInteger: it is less than the minimum of 0",
+				"3:37: /order/item[1]/price: missing required attribute 'currency' (type Price)",
+				"3:37: /order/item[1]/price: 'cheap' is not a valid xs:decimal: it is not a decimal number",
+				"4:11: /order/item[2]/qty: unexpected element 'qty', expected 'sku' (type Item)",
+				"5:5: /order/pickup: 'soon' is not a valid xs:date: it is not a date",
+			},
+		},
+		{
+			`<order xmlns="urn:orders" id="1"><item/><customer/></order>`,
+			[]string{
+				"1:34: /order/item: unexpected element 'item', expected 'customer' (type Order)",
+			},
+		},
+		{
+			`<order xmlns="urn:orders" id="1">
+				<customer><name>A</name></customer>
+				<item><sku>A</sku><qty>1</qty><price currency="GBP">1</price></item>
+				text
+				<delivery/>
+				<note>stray</note>
+			</order>`,
+			[]string{
+				"1:1: /order: element 'order' cannot contain text (type Order)",
+				"5:5: /order/delivery: content of 'delivery' is incomplete, expected 'line' (type Address)",
+				"6:5: /order/note: unexpected element 'note' in 'order' (type Order)",
+			},
+		},
+		{
+			`<order id="1"/>`,
+			[]string{
+				"1:1: /order: no global element 'order' is declared",
+			},
+		},
+		{
+			`<note xmlns="urn:orders">a <b/> c</note>`,
+			[]string{
+				"1:1: /note: element 'note' cannot contain elements (type xs:string)",
+			},
+		},
+	}
+
+	for i, tst := range table {
+		t.Run(fmt.Sprintf("Test %d of %d", i+1, len(table)), func(t *testing.T) {
+			root, err := xmlparser.Parse(tst.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, err := range schema.Validate(root) {
+				got = append(got, err.Error())
+			}
+			if diff := cmp.Diff(tst.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestValidateExtension(t *testing.T) {
+	schema, err := Parse(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+		<xs:element name="address" type="UKAddress"/>
+		<xs:complexType name="Address">
+			<xs:sequence>
+				<xs:element name="line" type="xs:string" maxOccurs="3"/>
+			</xs:sequence>
+			<xs:attribute name="kind" type="xs:string"/>
+		</xs:complexType>
+		<xs:complexType name="UKAddress">
+			<xs:complexContent>
+				<xs:extension base="Address">
+					<xs:sequence>
+						<xs:element name="postcode" type="xs:string"/>
+					</xs:sequence>
+				</xs:extension>
+			</xs:complexContent>
+		</xs:complexType>
+	</xs:schema>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, _ := xmlparser.Parse(`<address kind="home"><line>1</line><postcode>AB1 2CD</postcode></address>`)
+	if errs := schema.Validate(valid); errs != nil {
+		t.Errorf("wanted no errors but got %v", errs)
+	}
+	invalid, _ := xmlparser.Parse(`<address><line>1</line><line>2</line><line>3</line><line>4</line></address>`)
+	want := "1:52: /address/line[4]: unexpected element 'line', expected 'postcode' (type UKAddress)"
+	errs := schema.Validate(invalid)
+	if len(errs) != 1 || errs[0].Error() != want {
+		t.Errorf("wanted %s but got %v", want, errs)
+	}
+}